@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+)
+
+const usage = `usage: diff [-ignore-loopback] BASELINE_DIR CURRENT_DIR
+
+  compares the results written with -output-dir by two runs of the suite, e.g. on two proxies, and prints the
+  regressions, fixes and unchanged failures of each test case, exits with 1 on regressions`
+
+func main() {
+	ignoreLoopback := flag.Bool("ignore-loopback", false, "Do not compare the probes from a pod to itself.")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	baseline, err := matrix.LoadResultSet(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	current, err := matrix.LoadResultSet(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	diff := matrix.DiffResultSets(baseline, current, *ignoreLoopback)
+	fmt.Println(diff.PrettyPrint(""))
+	if diff.Regressions() > 0 {
+		os.Exit(1)
+	}
+}
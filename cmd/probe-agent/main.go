@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/agent"
+)
+
+const usage = `usage: probe-agent [-workers N] batch|sleep
+
+  batch  probes the JSON array of requests read on stdin and writes the JSON array of responses on stdout
+  sleep  waits for a termination signal, keeps the sidecar running between the batches`
+
+func main() {
+	workers := flag.Int("workers", agent.DefaultWorkers, "Number of probes of a batch running concurrently.")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	switch flag.Arg(0) {
+	case "batch":
+		if err := agent.ServeBatch(ctx, os.Stdin, os.Stdout, *workers); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "sleep":
+		<-ctx.Done()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -13,6 +13,7 @@ require (
 	k8s.io/apimachinery v0.22.3
 	k8s.io/client-go v0.22.3
 	sigs.k8s.io/e2e-framework v0.0.6-0.20220121212306-8b8ee441701c
+	sigs.k8s.io/yaml v1.2.0
 )
 
 require (
@@ -56,5 +57,4 @@ require (
 	k8s.io/utils v0.0.0-20210819203725-bdf08cb9a70a // indirect
 	sigs.k8s.io/controller-runtime v0.9.0 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.1.2 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
@@ -0,0 +1,192 @@
+// Package agent is the probe agent running as a sidecar of the client pods. It probes a batch of targets read
+// on its input and writes the results on its output, so a whole row of the matrix costs a single exec.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultWorkers is the number of probes of a batch running concurrently
+	DefaultWorkers = 16
+	// DefaultTimeout bounds a probe without timeout
+	DefaultTimeout = 5 * time.Second
+
+	// maxAnswerSize bounds the answer read from the servers, a hostname
+	maxAnswerSize = 256
+)
+
+// Outcomes of the probes, matching the outcomes of the matrix
+const (
+	OutcomeConnected  = "connected"
+	OutcomeDNSFailure = "dns-failure"
+	OutcomeRefused    = "refused"
+	OutcomeTimeout    = "timeout"
+	OutcomeFailed     = "failed"
+)
+
+// Request is a single probe of a batch
+type Request struct {
+	ID       int    `json:"id"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	// Hostname reads the hostname answered by the server as endpoint, agnhost serve-hostname answers it
+	// on TCP connections and UDP datagrams
+	Hostname bool `json:"hostname,omitempty"`
+	// Timeout bounds the probe, DefaultTimeout if zero
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Connects is the number of connects timed one after the other, the probe failing on the first failed
+	// connect, a single untimed connect if zero
+	Connects int `json:"connects,omitempty"`
+}
+
+// Response is the result of a probe of the batch
+type Response struct {
+	ID        int           `json:"id"`
+	Connected bool          `json:"connected"`
+	Outcome   string        `json:"outcome"`
+	Endpoint  string        `json:"endpoint,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	// Durations are the durations of each of the Request.Connects connects
+	Durations []time.Duration `json:"durations,omitempty"`
+}
+
+// Probe connects to the target of the request, UDP targets must answer the datagram to be connected.
+// The connects are timed in process, so the durations do not include the start-up of a command.
+func Probe(ctx context.Context, req *Request) *Response {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	endpoint, err := dial(ctx, req)
+	durations := []time.Duration{time.Since(start)}
+	for len(durations) < req.Connects && err == nil {
+		connectStart := time.Now()
+		endpoint, err = dial(ctx, req)
+		durations = append(durations, time.Since(connectStart))
+	}
+	resp := &Response{ID: req.ID, Outcome: outcomeOf(err), Duration: time.Since(start)}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Connected = true
+	resp.Endpoint = endpoint
+	if req.Connects > 0 {
+		resp.Durations = durations
+	}
+	return resp
+}
+
+// dial connects to the target and returns the hostname answered by the server if requested
+func dial(ctx context.Context, req *Request) (string, error) {
+	var network string
+	switch strings.ToUpper(req.Protocol) {
+	case "TCP":
+		network = "tcp"
+	case "UDP":
+		network = "udp"
+	default:
+		return "", errors.Errorf("protocol %s not supported", req.Protocol)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(req.Address, strconv.Itoa(req.Port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return "", err
+		}
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write([]byte("hostname\n")); err != nil {
+			return "", err
+		}
+		answer := make([]byte, maxAnswerSize)
+		n, err := conn.Read(answer)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(answer[:n])), nil
+	}
+	if !req.Hostname {
+		return "", nil
+	}
+	answer, err := io.ReadAll(io.LimitReader(conn, maxAnswerSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(answer)), nil
+}
+
+// outcomeOf classifies the error of a probe
+func outcomeOf(err error) string {
+	var (
+		dnsErr *net.DNSError
+		netErr net.Error
+	)
+	switch {
+	case err == nil:
+		return OutcomeConnected
+	case errors.As(err, &dnsErr):
+		return OutcomeDNSFailure
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return OutcomeRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return OutcomeTimeout
+	}
+	return OutcomeFailed
+}
+
+// ServeBatch decodes a batch of requests from in, probes them with workers running concurrently, and encodes
+// the responses, in the order of the requests, to out
+func ServeBatch(ctx context.Context, in io.Reader, out io.Writer, workers int) error {
+	var requests []*Request
+	if err := json.NewDecoder(in).Decode(&requests); err != nil {
+		return errors.Wrap(err, "unable to decode the probe requests")
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	responses := make([]*Response, len(requests))
+	indexes := make(chan int, len(requests))
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				responses[i] = Probe(ctx, requests[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Wrap(json.NewEncoder(out).Encode(responses), "unable to encode the probe responses")
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// serveHostname answers the hostname on every TCP connection and UDP datagram, like agnhost serve-hostname
+func serveHostname(hostname string) (tcpPort, udpPort int, stop func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(hostname))
+			conn.Close()
+		}
+	}()
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			_, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = packetConn.WriteTo([]byte(hostname), addr)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, packetConn.LocalAddr().(*net.UDPAddr).Port, func() {
+		listener.Close()
+		packetConn.Close()
+	}
+}
+
+// closedPort returns a local TCP port nothing listens on
+func closedPort() int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	listener.Close()
+	p, err := strconv.Atoi(port)
+	Expect(err).NotTo(HaveOccurred())
+	return p
+}
+
+var _ = Describe("probe agent", func() {
+	var (
+		ctx              context.Context
+		tcpPort, udpPort int
+		stop             func()
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		tcpPort, udpPort, stop = serveHostname("pod-2")
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	It("should read the hostname answered on TCP and UDP", func() {
+		resp := Probe(ctx, &Request{Address: "127.0.0.1", Port: tcpPort, Protocol: "TCP", Hostname: true})
+		Expect(resp.Connected).To(BeTrue())
+		Expect(resp.Outcome).To(Equal(OutcomeConnected))
+		Expect(resp.Endpoint).To(Equal("pod-2"))
+
+		resp = Probe(ctx, &Request{Address: "127.0.0.1", Port: udpPort, Protocol: "UDP"})
+		Expect(resp.Connected).To(BeTrue())
+		Expect(resp.Endpoint).To(Equal("pod-2"))
+	})
+
+	It("should time each of the connects", func() {
+		resp := Probe(ctx, &Request{Address: "127.0.0.1", Port: tcpPort, Protocol: "TCP", Connects: 5})
+		Expect(resp.Connected).To(BeTrue())
+		Expect(resp.Durations).To(HaveLen(5))
+		for _, duration := range resp.Durations {
+			Expect(duration).To(BeNumerically(">", 0))
+			Expect(duration).To(BeNumerically("<=", resp.Duration))
+		}
+
+		resp = Probe(ctx, &Request{Address: "127.0.0.1", Port: closedPort(), Protocol: "TCP", Connects: 5})
+		Expect(resp.Connected).To(BeFalse())
+		Expect(resp.Durations).To(BeEmpty())
+
+		resp = Probe(ctx, &Request{Address: "127.0.0.1", Port: tcpPort, Protocol: "TCP"})
+		Expect(resp.Durations).To(BeEmpty())
+	})
+
+	It("should classify the failed probes", func() {
+		resp := Probe(ctx, &Request{Address: "127.0.0.1", Port: closedPort(), Protocol: "TCP"})
+		Expect(resp.Connected).To(BeFalse())
+		Expect(resp.Outcome).To(Equal(OutcomeRefused))
+		Expect(resp.Error).NotTo(BeEmpty())
+
+		resp = Probe(ctx, &Request{Address: "127.0.0.1", Port: tcpPort, Protocol: "SCTP"})
+		Expect(resp.Outcome).To(Equal(OutcomeFailed))
+	})
+
+	It("should answer a batch in the order of the requests", func() {
+		requests := []*Request{
+			{ID: 1, Address: "127.0.0.1", Port: tcpPort, Protocol: "TCP", Hostname: true},
+			{ID: 2, Address: "127.0.0.1", Port: closedPort(), Protocol: "TCP"},
+			{ID: 3, Address: "127.0.0.1", Port: udpPort, Protocol: "UDP"},
+		}
+		in, err := json.Marshal(requests)
+		Expect(err).NotTo(HaveOccurred())
+		var out bytes.Buffer
+		Expect(ServeBatch(ctx, bytes.NewReader(in), &out, 2)).To(Succeed())
+
+		var responses []*Response
+		Expect(json.Unmarshal(out.Bytes(), &responses)).To(Succeed())
+		Expect(responses).To(HaveLen(3))
+		for i, resp := range responses {
+			Expect(resp.ID).To(Equal(requests[i].ID))
+		}
+		Expect(responses[0].Connected).To(BeTrue())
+		Expect(responses[1].Outcome).To(Equal(OutcomeRefused))
+		Expect(responses[2].Endpoint).To(Equal("pod-2"))
+	})
+
+	It("should fail on malformed requests", func() {
+		Expect(ServeBatch(ctx, strings.NewReader("not json"), &bytes.Buffer{}, 0)).NotTo(Succeed())
+	})
+})
@@ -19,6 +19,8 @@ func (c *agnCommand) ConnectCommand() (cmd []string) {
 		cmd = []string{"/agnhost", "connect", net.JoinHostPort(c.addrTo, c.port), "--timeout=5s", "--protocol=tcp"}
 	case v1.ProtocolUDP:
 		cmd = []string{"/agnhost", "connect", net.JoinHostPort(c.addrTo, c.port), "--timeout=5s", "--protocol=udp"}
+	case v1.ProtocolSCTP:
+		cmd = []string{"/agnhost", "connect", net.JoinHostPort(c.addrTo, c.port), "--timeout=5s", "--protocol=sctp"}
 	default:
 		zap.L().Error(fmt.Sprintf("protocol %s not supported", c.protocol))
 	}
@@ -32,6 +34,9 @@ func (c *agnCommand) ServeCommand() (cmd []string) {
 		cmd = []string{"/agnhost", "serve-hostname", "--tcp", "--http=false", "--port", c.port}
 	case v1.ProtocolUDP:
 		cmd = []string{"/agnhost", "serve-hostname", "--udp", "--http=false", "--port", c.port}
+	case v1.ProtocolSCTP:
+		// serve-hostname has no SCTP server, porter answers the SCTP connections with the value of its env
+		cmd = []string{"/bin/sh", "-c", fmt.Sprintf("SERVE_SCTP_PORT_%s=$(hostname) exec /agnhost porter", c.port)}
 	default:
 		zap.L().Error(fmt.Sprintf("invalid protocol %v", c.protocol))
 	}
@@ -19,6 +19,9 @@ var _ = Describe("Agnhost command test", func() {
 			Expect(client.ConnectCommand()).To(Equal([]string{"/agnhost", "connect", "192.168.0.2:8080", "--timeout=5s", "--protocol=udp"}))
 
 			client = NewAgnHostClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolSCTP)
+			Expect(client.ConnectCommand()).To(Equal([]string{"/agnhost", "connect", "192.168.0.2:8080", "--timeout=5s", "--protocol=sctp"}))
+
+			client = NewAgnHostClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.Protocol("ICMP"))
 			Expect(client.ConnectCommand()).To(BeNil())
 		})
 	})
@@ -32,7 +35,7 @@ var _ = Describe("Agnhost command test", func() {
 			Expect(server.ServeCommand()).To(Equal([]string{"/agnhost", "serve-hostname", "--udp", "--http=false", "--port", "8080"}))
 
 			server = NewAgnHostServer(8080, v1.ProtocolSCTP)
-			Expect(server.ServeCommand()).To(BeNil())
+			Expect(server.ServeCommand()).To(Equal([]string{"/bin/sh", "-c", "SERVE_SCTP_PORT_8080=$(hostname) exec /agnhost porter"}))
 		})
 	})
 })
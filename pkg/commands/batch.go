@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// batchLinePrefix starts the line printed by each probe of a batch
+const batchLinePrefix = "probe"
+
+// BatchProbe is a client command of a batch, tried up to Tries times until it succeeds
+type BatchProbe struct {
+	Client Client
+	Tries  int
+}
+
+// BatchResult is the exit code and the output, stdout and stderr, of the last try of a probe of a batch
+type BatchResult struct {
+	ExitCode int
+	Output   string
+}
+
+// batchCommand represents the client command running the probes of a source pod in a single shell
+type batchCommand struct {
+	commandImpl
+	probes []BatchProbe
+}
+
+// ConnectCommand returns a shell script running all the probes concurrently, each printing a single line
+// "probe <index> <exit code> <output>" with the output on one line
+func (c *batchCommand) ConnectCommand() (cmd []string) {
+	script := []string{"set -f"}
+	for i, probe := range c.probes {
+		connect := probe.Client.ConnectCommand()
+		if connect == nil {
+			return nil
+		}
+		tries := probe.Tries
+		if tries < 1 {
+			tries = 1
+		}
+		script = append(script, fmt.Sprintf(
+			"(for try in $(seq %d); do out=$(%s 2>&1); rc=$?; [ $rc -eq 0 ] && break; done; "+
+				"line=$(printf '%%s ' $out); printf '%s %d %%d %%s\\n' \"$rc\" \"$line\") &",
+			tries, strings.Join(connect, " "), batchLinePrefix, i,
+		))
+	}
+	script = append(script, "wait")
+	return []string{"/bin/sh", "-c", strings.Join(script, "\n")}
+}
+
+// NewBatchClient returns an instance of the batch client command, running the probes from the same source pod
+func NewBatchClient(nsFrom, podFrom, containerFrom string, probes []BatchProbe) Client {
+	batch := &batchCommand{commandImpl: commandImpl{
+		nsFrom: nsFrom, podFrom: podFrom, containerFrom: containerFrom,
+	}, probes: probes}
+	batch.cmd = batch.ConnectCommand()
+	return batch
+}
+
+// ParseBatchOutput parses the lines printed by a batch of the given number of probes into a result per probe,
+// in order. The results of the probes which printed no line are nil.
+func ParseBatchOutput(stdout string, probes int) ([]*BatchResult, error) {
+	results := make([]*BatchResult, probes)
+	for _, line := range strings.Split(stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 || fields[0] != batchLinePrefix {
+			return nil, errors.Errorf("invalid batch line %q", line)
+		}
+		index, err := strconv.Atoi(fields[1])
+		if err != nil || index < 0 || index >= probes {
+			return nil, errors.Errorf("invalid probe index in batch line %q", line)
+		}
+		exitCode, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exit code in batch line %q", line)
+		}
+		result := &BatchResult{ExitCode: exitCode}
+		if len(fields) == 4 {
+			result.Output = strings.TrimSpace(fields[3])
+		}
+		results[index] = result
+	}
+	return results, nil
+}
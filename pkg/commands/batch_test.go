@@ -0,0 +1,49 @@
+package commands
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("batch command test", func() {
+	Context("batch client test", func() {
+		It("render a line per probe in the shell script", func() {
+			client := NewBatchClient("test-ns", "from-pod", "from-container", []BatchProbe{
+				{Client: NewAgnHostClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolTCP)},
+				{Client: NewNcClient("test-ns", "from-pod", "from-container", "192.168.0.3", 8080, v1.ProtocolUDP), Tries: 3},
+			})
+			Expect(client.ConnectCommand()).To(Equal([]string{"/bin/sh", "-c", "set -f\n" +
+				"(for try in $(seq 1); do out=$(/agnhost connect 192.168.0.2:8080 --timeout=5s --protocol=tcp 2>&1); rc=$?; [ $rc -eq 0 ] && break; done; " +
+				"line=$(printf '%s ' $out); printf 'probe 0 %d %s\\n' \"$rc\" \"$line\") &\n" +
+				"(for try in $(seq 3); do out=$(nc -u -w10 192.168.0.3 8080 2>&1); rc=$?; [ $rc -eq 0 ] && break; done; " +
+				"line=$(printf '%s ' $out); printf 'probe 1 %d %s\\n' \"$rc\" \"$line\") &\n" +
+				"wait",
+			}))
+
+			client = NewBatchClient("test-ns", "from-pod", "from-container", []BatchProbe{
+				{Client: NewNcClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolSCTP)},
+			})
+			Expect(client.ConnectCommand()).To(Equal([]string{"/bin/sh", "-c", "set -f\n" +
+				"(for try in $(seq 1); do out=$(nc --sctp -w10 192.168.0.2 8080 2>&1); rc=$?; [ $rc -eq 0 ] && break; done; " +
+				"line=$(printf '%s ' $out); printf 'probe 0 %d %s\\n' \"$rc\" \"$line\") &\n" +
+				"wait",
+			}))
+		})
+
+		It("parse a result per probe", func() {
+			results, err := ParseBatchOutput("probe 1 0 pod-2 \nprobe 0 1 nc: connect to 192.168.0.2 port 8080 (tcp) failed: Connection refused\n", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]*BatchResult{
+				{ExitCode: 1, Output: "nc: connect to 192.168.0.2 port 8080 (tcp) failed: Connection refused"},
+				{ExitCode: 0, Output: "pod-2"},
+				nil,
+			}))
+
+			_, err = ParseBatchOutput("probe 3 0", 3)
+			Expect(err).To(HaveOccurred())
+			_, err = ParseBatchOutput("unexpected output", 3)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+)
+
+// HTTPWriteOut is the trailer written by the HTTP client after the response body, the status code and
+// the duration of the request in seconds
+const HTTPWriteOut = `\n%{http_code} %{time_total}`
+
+// httpCommand represents the server or client HTTP command
+type httpCommand struct {
+	commandImpl
+	path string
+}
+
+// ConnectCommand returns the curl command requesting the path of the server
+func (c *httpCommand) ConnectCommand() (cmd []string) {
+	switch c.protocol {
+	case v1.ProtocolTCP:
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort(c.addrTo, c.port), c.path)
+		cmd = []string{"curl", "-g", "-q", "-s", "-S", "--max-time", "5", "-w", HTTPWriteOut, url}
+	default:
+		zap.L().Error(fmt.Sprintf("protocol %s not supported", c.protocol))
+	}
+	return cmd
+}
+
+// ServeCommand returns the agnhost command answering the HTTP requests with the hostname
+func (c *httpCommand) ServeCommand() (cmd []string) {
+	switch c.protocol {
+	case v1.ProtocolTCP:
+		cmd = []string{"/agnhost", "serve-hostname", "--http=true", "--port", c.port}
+	default:
+		zap.L().Error(fmt.Sprintf("protocol %s not supported", c.protocol))
+	}
+	return cmd
+}
+
+// NewHTTPClient returns an instance of the HTTP client command, requesting the hostname of the server
+func NewHTTPClient(nsFrom, podFrom, containerFrom, addrTo string, port int, protocol v1.Protocol) Client {
+	http := &httpCommand{commandImpl: commandImpl{
+		nsFrom: nsFrom, podFrom: podFrom, containerFrom: containerFrom,
+		addrTo: addrTo, port: strconv.Itoa(port), protocol: protocol,
+	}, path: "/hostname"}
+	http.cmd = http.ConnectCommand()
+	return http
+}
+
+// NewClientIPClient returns an instance of the HTTP client command, requesting the client address seen by
+// an agnhost netexec server
+func NewClientIPClient(nsFrom, podFrom, containerFrom, addrTo string, port int, protocol v1.Protocol) Client {
+	http := &httpCommand{commandImpl: commandImpl{
+		nsFrom: nsFrom, podFrom: podFrom, containerFrom: containerFrom,
+		addrTo: addrTo, port: strconv.Itoa(port), protocol: protocol,
+	}, path: "/clientip"}
+	http.cmd = http.ConnectCommand()
+	return http
+}
+
+// NewHTTPServer returns an instance of the HTTP server command
+func NewHTTPServer(port int, protocol v1.Protocol) Server {
+	http := &httpCommand{commandImpl: commandImpl{port: strconv.Itoa(port), protocol: protocol}}
+	http.cmd = http.ServeCommand()
+	return http
+}
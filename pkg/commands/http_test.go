@@ -0,0 +1,43 @@
+package commands
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("HTTP command test", func() {
+	var client Client
+	var server Server
+
+	Context("HTTP client test", func() {
+		It("render correct connect command", func() {
+			client = NewHTTPClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolTCP)
+			Expect(client.ConnectCommand()).To(Equal([]string{
+				"curl", "-g", "-q", "-s", "-S", "--max-time", "5", "-w", `\n%{http_code} %{time_total}`, "http://192.168.0.2:8080/hostname",
+			}))
+
+			client = NewHTTPClient("test-ns", "from-pod", "from-container", "fd00::2", 8080, v1.ProtocolTCP)
+			Expect(client.ConnectCommand()).To(ContainElement("http://[fd00::2]:8080/hostname"))
+
+			client = NewClientIPClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolTCP)
+			Expect(client.ConnectCommand()).To(ContainElement("http://192.168.0.2:8080/clientip"))
+
+			client = NewHTTPClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolUDP)
+			Expect(client.ConnectCommand()).To(BeNil())
+		})
+	})
+
+	Context("HTTP server test", func() {
+		It("render correct serve command", func() {
+			server = NewHTTPServer(8080, v1.ProtocolTCP)
+			Expect(server.ServeCommand()).To(Equal([]string{"/agnhost", "serve-hostname", "--http=true", "--port", "8080"}))
+
+			server = NewHTTPServer(8080, v1.ProtocolUDP)
+			Expect(server.ServeCommand()).To(BeNil())
+
+			server = NewNetexecServer(8080, v1.ProtocolTCP)
+			Expect(server.ServeCommand()).To(Equal([]string{"/agnhost", "netexec", "--http-port=8080", "--udp-port=-1"}))
+		})
+	})
+})
@@ -1,19 +1,18 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 
 	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
 )
 
 // Executor supports Execute function that performs a probe, client method only
 type Executor interface {
-	Execute(config *rest.Config, cs *kubernetes.Clientset) (stdout, stderr string, err error)
+	Execute(ctx context.Context, executor ek.PodExecutor) (stdout, stderr string, err error)
 }
 
 // Client defines the methods supported by client-side command
@@ -47,8 +46,9 @@ func (c *commandImpl) DebugString() string {
 		c.podFrom, c.containerFrom, c.nsFrom, strings.Join(c.cmd, " "))
 }
 
-func (c *commandImpl) Execute(config *rest.Config, cs *kubernetes.Clientset) (stdout, stderr string, err error) {
-	return ek.ExecWithOptions(config, cs, &ek.ExecOptions{
+// Execute runs the client command in the source pod with the executor, bounded by ctx
+func (c *commandImpl) Execute(ctx context.Context, executor ek.PodExecutor) (stdout, stderr string, err error) {
+	return executor.Exec(ctx, &ek.ExecOptions{
 		Command:            c.cmd,
 		Namespace:          c.nsFrom,
 		PodName:            c.podFrom,
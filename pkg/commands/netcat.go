@@ -3,32 +3,56 @@ package commands
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 )
 
+// DefaultNcWait is the time netcat waits for the connection and the answer of the target
+const DefaultNcWait = 10 * time.Second
+
 // ncCommand represents the client netcat command
-type ncCommand struct{ commandImpl }
+type ncCommand struct {
+	commandImpl
+	wait time.Duration
+}
 
 func (c *ncCommand) ConnectCommand() (cmd []string) {
+	wait := fmt.Sprintf("-w%d", c.waitSeconds())
 	switch c.protocol {
 	case v1.ProtocolTCP:
-		cmd = []string{"nc", "-w10", c.addrTo, c.port}
+		cmd = []string{"nc", wait, c.addrTo, c.port}
 	case v1.ProtocolUDP:
-		cmd = []string{"nc", "-u", "-w10", c.addrTo, c.port}
+		cmd = []string{"nc", "-u", wait, c.addrTo, c.port}
+	case v1.ProtocolSCTP:
+		cmd = []string{"nc", "--sctp", wait, c.addrTo, c.port}
 	default:
 		zap.L().Error(fmt.Sprintf("protocol %s not supported", c.protocol))
 	}
 	return cmd
 }
 
-// NewNcClient returns an instance of AgnHost client command
+// waitSeconds returns the wait in whole seconds, netcat waiting at least a second
+func (c *ncCommand) waitSeconds() int {
+	if seconds := int(c.wait / time.Second); seconds > 0 {
+		return seconds
+	}
+	return 1
+}
+
+// NewNcClient returns an instance of netcat client command, waiting DefaultNcWait for the target
 func NewNcClient(nsFrom, podFrom, containerFrom, addrTo string, port int, protocol v1.Protocol) Client {
-	nc := &ncCommand{commandImpl{
+	return NewNcClientWithWait(nsFrom, podFrom, containerFrom, addrTo, port, protocol, DefaultNcWait)
+}
+
+// NewNcClientWithWait returns an instance of netcat client command waiting for the target up to wait,
+// rounded down to whole seconds
+func NewNcClientWithWait(nsFrom, podFrom, containerFrom, addrTo string, port int, protocol v1.Protocol, wait time.Duration) Client {
+	nc := &ncCommand{commandImpl: commandImpl{
 		nsFrom: nsFrom, podFrom: podFrom, containerFrom: containerFrom,
 		addrTo: addrTo, port: strconv.Itoa(port), protocol: protocol,
-	}}
+	}, wait: wait}
 	nc.cmd = nc.ConnectCommand()
 	return nc
 }
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
@@ -18,7 +20,18 @@ var _ = Describe("Netcat command test", func() {
 			Expect(client.ConnectCommand()).To(Equal([]string{"nc", "-u", "-w10", "192.168.0.2", "8080"}))
 
 			client = NewNcClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolSCTP)
+			Expect(client.ConnectCommand()).To(Equal([]string{"nc", "--sctp", "-w10", "192.168.0.2", "8080"}))
+
+			client = NewNcClient("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.Protocol("QUIC"))
 			Expect(client.ConnectCommand()).To(BeNil())
 		})
+
+		It("render the wait in whole seconds, at least one", func() {
+			client = NewNcClientWithWait("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolTCP, 8500*time.Millisecond)
+			Expect(client.ConnectCommand()).To(Equal([]string{"nc", "-w8", "192.168.0.2", "8080"}))
+
+			client = NewNcClientWithWait("test-ns", "from-pod", "from-container", "192.168.0.2", 8080, v1.ProtocolUDP, 0)
+			Expect(client.ConnectCommand()).To(Equal([]string{"nc", "-u", "-w1", "192.168.0.2", "8080"}))
+		})
 	})
 })
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+)
+
+// netexecCommand represents the agnhost netexec server, answering the client address on /clientip
+type netexecCommand struct{ commandImpl }
+
+// ServeCommand returns the netexec command serving HTTP on the port, without its default UDP server
+func (c *netexecCommand) ServeCommand() (cmd []string) {
+	switch c.protocol {
+	case v1.ProtocolTCP:
+		cmd = []string{"/agnhost", "netexec", "--http-port=" + c.port, "--udp-port=-1"}
+	default:
+		zap.L().Error(fmt.Sprintf("protocol %s not supported", c.protocol))
+	}
+	return cmd
+}
+
+// NewNetexecServer returns an instance of the agnhost netexec server command
+func NewNetexecServer(port int, protocol v1.Protocol) Server {
+	netexec := &netexecCommand{commandImpl{port: strconv.Itoa(port), protocol: protocol}}
+	netexec.cmd = netexec.ServeCommand()
+	return netexec
+}
@@ -1,5 +1,17 @@
 package consts
 
+import "time"
+
 const PollTimesToDeterminePendingPod = 2
 
 const PerfTestBandWidthBenchMarkMegabytesPerSecond = 10
+
+// LatencyConnectsPerProbe is the number of connects timed by a latency probe
+const LatencyConnectsPerProbe = 10
+
+const (
+	// DefaultProbeTimeout bounds a single probe (one kubectl exec) in the matrix
+	DefaultProbeTimeout = 30 * time.Second
+	// DefaultTestCaseDeadline bounds the probing of the whole matrix of a test case
+	DefaultTestCaseDeadline = 10 * time.Minute
+)
@@ -23,6 +23,11 @@ const (
 
 	// AgnhostImage is the image reference for agnhost server
 	AgnhostImage ContainerImage = "k8s.gcr.io/e2e-test-images/agnhost:2.31"
+
+	// ProbeAgentImage is the default image reference for the probe agent sidecar
+	ProbeAgentImage ContainerImage = "yzaccc/k8s-service-validator-agent:dev"
+	// ProbeAgentContainerName is the name of the probe agent sidecar container
+	ProbeAgentContainerName = "probe-agent"
 )
 
 func init() {
@@ -36,6 +41,13 @@ type Container struct {
 	Command  []string
 	Protocol v1.Protocol
 	Port     int32
+	// HTTP serves the hostname over HTTP instead of raw TCP
+	HTTP bool
+}
+
+// NewProbeAgentContainer returns the probe agent sidecar, idle until a batch of probes is exec'ed in it
+func NewProbeAgentContainer(image ContainerImage) *Container {
+	return &Container{Name: ProbeAgentContainerName, Image: image, Command: []string{"/probe-agent", "sleep"}}
 }
 
 // GetName returns the parsed container name
@@ -75,8 +87,11 @@ func (c *Container) ToK8SSpec() v1.Container {
 	if len(cmd) == 0 {
 		switch image {
 		case AgnhostImage:
-			agnHost := commands.NewAgnHostServer(int(c.Port), c.Protocol)
-			cmd = agnHost.ServeCommand()
+			var server commands.Server = commands.NewAgnHostServer(int(c.Port), c.Protocol)
+			if c.HTTP {
+				server = commands.NewHTTPServer(int(c.Port), c.Protocol)
+			}
+			cmd = server.ServeCommand()
 		default:
 			zap.L().Error(fmt.Sprintf("self-provided image %s should have non-empty command", image))
 		}
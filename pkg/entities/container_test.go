@@ -64,5 +64,11 @@ var _ = Describe("container unit test", func() {
 			Expect(k8sContainer.Command).To(Equal([]string{"/agnhost", "serve-hostname", "--tcp", "--http=false", "--port", "8080"}))
 			Expect(k8sContainer.Ports[0].Name).To(Equal("serve-8080-tcp"))
 		})
+
+		It("should render the HTTP serve command in HTTP mode", func() {
+			container = &Container{Port: 8080, Protocol: v1.ProtocolTCP, HTTP: true}
+			k8sContainer := container.ToK8SSpec()
+			Expect(k8sContainer.Command).To(Equal([]string{"/agnhost", "serve-hostname", "--http=true", "--port", "8080"}))
+		})
 	})
 })
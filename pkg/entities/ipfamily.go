@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// IPFamilyOf returns the IP family of the address, empty if it is not an IP address
+func IPFamilyOf(ip string) v1.IPFamily {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.To4() != nil:
+		return v1.IPv4Protocol
+	default:
+		return v1.IPv6Protocol
+	}
+}
+
+// FilterIPsByFamily returns the addresses of the IP family, all of them if the family is empty
+func FilterIPsByFamily(ips []string, family v1.IPFamily) []string {
+	if family == "" {
+		return ips
+	}
+	var filtered []string
+	for _, ip := range ips {
+		if IPFamilyOf(ip) == family {
+			filtered = append(filtered, ip)
+		}
+	}
+	return filtered
+}
+
+// ipByFamily returns the first address of the IP family, looking up the primary address then the others,
+// the primary address if the family is empty
+func ipByFamily(primary string, ips []string, family v1.IPFamily) string {
+	if family == "" {
+		return primary
+	}
+	if filtered := FilterIPsByFamily(append([]string{primary}, ips...), family); len(filtered) > 0 {
+		return filtered[0]
+	}
+	return ""
+}
+
+// IPFamilyOnSlice returns true if the family is one of the families
+func IPFamilyOnSlice(family v1.IPFamily, families []v1.IPFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,39 @@
 package kubernetes
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var ErrLabelNotFound = errors.New("label not found")
 
+// ErrWaiterStopped is returned by the waits of a stopped waiter
+var ErrWaiterStopped = errors.New("waiter stopped")
+
 func IsLabelNotFound(err error) bool {
 	return err == ErrLabelNotFound
 }
+
+// TimeoutError is returned by the waits whose condition was not met in time
+type TimeoutError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Condition string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("timed out after %s waiting for %s %s: %s", e.Timeout, e.Kind, name, e.Condition)
+}
+
+// IsTimeout returns true if err is, or wraps, a TimeoutError
+func IsTimeout(err error) bool {
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr)
+}
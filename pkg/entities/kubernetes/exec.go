@@ -5,17 +5,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	scheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
 
 	"github.com/k8sbykeshed/k8s-service-validator/pkg/consts"
 )
@@ -28,17 +32,19 @@ const (
 var errPodCompleted = fmt.Errorf("pod ran to completion")
 
 // WaitForPodRunningInNamespace waits the given timeout duration for the
-// specified pod to be ready and running.
-func WaitForPodRunningInNamespace(c *kubernetes.Clientset, pod *v1.Pod, pendingPodsForTaints map[string]int) error {
+// specified pod to be ready and running, or until ctx is done.
+func WaitForPodRunningInNamespace(ctx context.Context, c kubernetes.Interface, pod *v1.Pod, pendingPodsForTaints map[string]int) error {
 	if pod.Status.Phase == v1.PodRunning {
 		return nil
 	}
-	return wait.PollImmediate(poll, timeout, podRunning(c, pod.Name, pod.Namespace, pendingPodsForTaints))
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return wait.PollImmediateUntil(poll, podRunning(ctx, c, pod.Name, pod.Namespace, pendingPodsForTaints), ctx.Done())
 }
 
-func podRunning(c *kubernetes.Clientset, podName, namespace string, pendingPodsForTaints map[string]int) wait.ConditionFunc {
+func podRunning(ctx context.Context, c kubernetes.Interface, podName, namespace string, pendingPodsForTaints map[string]int) wait.ConditionFunc {
 	return func() (bool, error) {
-		pod, err := c.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+		pod, err := c.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
@@ -73,10 +79,32 @@ type ExecOptions struct {
 	Quiet              bool
 }
 
+// PodExecutor executes commands in the containers of pods
+type PodExecutor interface {
+	Exec(ctx context.Context, options *ExecOptions) (stdout, stderr string, err error)
+}
+
+// SPDYExecutor is a PodExecutor streaming the commands through the exec subresource of the API server
+type SPDYExecutor struct {
+	config    *rest.Config
+	clientSet kubernetes.Interface
+}
+
+// NewSPDYExecutor returns a SPDYExecutor using the given config and clientset
+func NewSPDYExecutor(config *rest.Config, cs kubernetes.Interface) *SPDYExecutor {
+	return &SPDYExecutor{config: config, clientSet: cs}
+}
+
+// Exec executes a command in the container specified by options
+func (e *SPDYExecutor) Exec(ctx context.Context, options *ExecOptions) (stdout, stderr string, err error) {
+	return ExecWithOptions(ctx, e.config, e.clientSet, options)
+}
+
 // ExecWithOptions executes a command in the specified container,
 // returning stdout, stderr and error. `options` allowed for
-// additional parameters to be passed.
-func ExecWithOptions(config *rest.Config, cs *kubernetes.Clientset, options *ExecOptions) (string, string, error) { // nolint
+// additional parameters to be passed. The call returns ctx.Err()
+// as soon as ctx is done, closing the connection of the remote stream.
+func ExecWithOptions(ctx context.Context, config *rest.Config, cs kubernetes.Interface, options *ExecOptions) (string, string, error) { // nolint
 	tty := false
 	req := cs.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -93,23 +121,97 @@ func ExecWithOptions(config *rest.Config, cs *kubernetes.Clientset, options *Exe
 		TTY:       tty,
 	}, scheme.ParameterCodec)
 
-	var stdout, stderr bytes.Buffer
-	err := execute("POST", req.URL(), config, options.Stdin, &stdout, &stderr, tty)
+	var stdout, stderr safeBuffer
+	err := execute(ctx, "POST", req.URL(), config, options.Stdin, &stdout, &stderr, tty)
 	if options.PreserveWhitespace {
 		return stdout.String(), stderr.String(), err
 	}
 	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
 }
 
-func execute(method string, urlReq *url.URL, config *rest.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
-	exec, err := remotecommand.NewSPDYExecutor(config, method, urlReq)
+func execute(ctx context.Context, method string, urlReq *url.URL, config *rest.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool) error { // nolint
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return err
+	}
+	closer := &closingUpgrader{Upgrader: upgrader}
+	exec, err := remotecommand.NewSPDYExecutorForTransports(transport, closer, method, urlReq)
 	if err != nil {
 		return err
 	}
-	return exec.Stream(remotecommand.StreamOptions{
-		Stdin:  stdin,
-		Stdout: stdout,
-		Stderr: stderr,
-		Tty:    tty,
-	})
+
+	// remotecommand streams are not context aware, run the stream aside and close
+	// its connection when the context is done, for the stream to return.
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+			Tty:    tty,
+		})
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		closer.Close()
+		return ctx.Err()
+	}
+}
+
+// closingUpgrader is a spdy.Upgrader keeping the connection it upgrades, to close it once the
+// exec is abandoned, the connections upgraded after Close are closed at once.
+type closingUpgrader struct {
+	spdy.Upgrader
+	mu     sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+func (u *closingUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		_ = conn.Close()
+		return nil, fmt.Errorf("exec abandoned")
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+// Close closes the upgraded connection, if any
+func (u *closingUpgrader) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		_ = u.conn.Close()
+	}
+}
+
+// safeBuffer is a bytes.Buffer guarded by a mutex, since an abandoned stream
+// may still write into it while the caller reads the output.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
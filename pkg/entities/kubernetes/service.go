@@ -10,10 +10,6 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-const (
-	waitTime = 15 * time.Second
-)
-
 // ServiceBase contains the abstract implementation required for a service.
 type ServiceBase interface {
 	Create() (*v1.Service, error)
@@ -22,10 +18,11 @@ type ServiceBase interface {
 	GetLabel(string) (string, error)
 	SetLabel(string, string) error
 	RemoveLabel(string) error
-	WaitForClusterIP() (string, error)
-	WaitForNodePort() (int32, error)
-	WaitForEndpoint() (bool, error)
-	WaitForExternalIP() ([]string, error)
+	WaitForClusterIP(context.Context) (string, error)
+	WaitForClusterIPs(context.Context) ([]string, error)
+	WaitForNodePort(context.Context) (int32, error)
+	WaitForEndpoint(context.Context) (bool, error)
+	WaitForExternalIP(context.Context) ([]string, error)
 }
 
 // Services defines an array of Service
@@ -46,17 +43,31 @@ func (s Services) Delete() error {
 // Service defines the structure of a service
 type Service struct {
 	service   *v1.Service
-	clientSet *kubernetes.Clientset
+	clientSet kubernetes.Interface
+
+	waitTimeout time.Duration
 }
 
-// NewService constructs a Service
-func NewService(client *kubernetes.Clientset, service *v1.Service) *Service {
+// NewService constructs a Service, its waits are bounded by DefaultWaitTimeout
+func NewService(client kubernetes.Interface, service *v1.Service) *Service {
 	return &Service{
-		service:   service,
-		clientSet: client,
+		service:     service,
+		clientSet:   client,
+		waitTimeout: DefaultWaitTimeout,
 	}
 }
 
+// SetWaitTimeout sets the timeout of the waits of the service
+func (s *Service) SetWaitTimeout(timeout time.Duration) {
+	s.waitTimeout = timeout
+}
+
+// getWaiter returns the waiter shared by the services of the namespace, looked up on every wait since the
+// shared waiter is replaced once stopped
+func (s *Service) getWaiter() *Waiter {
+	return SharedWaiter(s.clientSet, s.service.Namespace)
+}
+
 // Create a new service
 func (s *Service) Create() (*v1.Service, error) {
 	opts := metav1.CreateOptions{}
@@ -136,98 +147,84 @@ func (s *Service) RemoveLabel(key string) error {
 	return nil
 }
 
-// WaitForEndpoint return when all addresses are ready.
-func (s *Service) WaitForEndpoint() (bool, error) {
-	opts := metav1.ListOptions{}
-	endpointWatch, err := s.clientSet.CoreV1().Endpoints(s.service.Namespace).Watch(context.TODO(), opts)
-	if err != nil {
-		return false, err
-	}
-
-	for {
-		select {
-		case event := <-endpointWatch.ResultChan():
-			endpoint := event.Object.(*v1.Endpoints) // nolint
-			for _, subset := range endpoint.Subsets {
-				if len(subset.Addresses) > 0 && len(subset.NotReadyAddresses) == 0 {
-					return true, nil
-				}
+// WaitForEndpoint returns true once all the addresses of a subset of the endpoints are ready, a *TimeoutError
+// if they are not in time
+func (s *Service) WaitForEndpoint(ctx context.Context) (bool, error) {
+	_, err := s.getWaiter().WaitForEndpoints(ctx, s.service.Name, "ready addresses", s.waitTimeout, func(endpoints *v1.Endpoints) bool {
+		for _, subset := range endpoints.Subsets {
+			if len(subset.Addresses) > 0 && len(subset.NotReadyAddresses) == 0 {
+				return true
 			}
-		case <-time.After(waitTime):
-			return false, nil
 		}
-	}
+		return false
+	})
+	return err == nil, err
 }
 
-// WaitForClusterIP returns the NodePort number, by pausing the process until timeout or ClusterIP is created
-func (s *Service) WaitForClusterIP() (string, error) {
-	opts := metav1.ListOptions{}
-	serviceWatch, err := s.clientSet.CoreV1().Services(s.service.Namespace).Watch(context.TODO(), opts)
-	defer serviceWatch.Stop()
-	if err != nil {
+// WaitForClusterIP returns the cluster IP of the service, by pausing the process until timeout or ClusterIP is created
+func (s *Service) WaitForClusterIP(ctx context.Context) (string, error) {
+	clusterIPs, err := s.WaitForClusterIPs(ctx)
+	if len(clusterIPs) == 0 {
 		return "", err
 	}
+	return clusterIPs[0], err
+}
 
-	for {
-		select {
-		case event := <-serviceWatch.ResultChan():
-			svc := event.Object.(*v1.Service) // nolint
-			if svc.Name == s.service.Name && svc.Spec.ClusterIP != "" {
-				return svc.Spec.ClusterIP, nil
-			}
-		case <-time.After(waitTime):
-			return "", nil
-		}
+// WaitForClusterIPs returns the cluster IPs of the service, one per IP family, by pausing the process until
+// timeout or ClusterIP is created
+func (s *Service) WaitForClusterIPs(ctx context.Context) ([]string, error) {
+	svc, err := s.getWaiter().WaitForService(ctx, s.service.Name, "cluster IP", s.waitTimeout, func(svc *v1.Service) bool {
+		return svc.Spec.ClusterIP != ""
+	})
+	if err != nil {
+		return nil, err
 	}
+	if len(svc.Spec.ClusterIPs) == 0 {
+		return []string{svc.Spec.ClusterIP}, nil
+	}
+	return svc.Spec.ClusterIPs, nil
 }
 
 // WaitForNodePort returns nodePort, by pausing the process until timeout nodePort is created
-func (s *Service) WaitForNodePort() (int32, error) {
-	var nodePort int32
-	opts := metav1.ListOptions{}
-	serviceWatch, err := s.clientSet.CoreV1().Services(s.service.Namespace).Watch(context.TODO(), opts)
-	defer serviceWatch.Stop()
+func (s *Service) WaitForNodePort(ctx context.Context) (int32, error) {
+	svc, err := s.getWaiter().WaitForService(ctx, s.service.Name, "node port", s.waitTimeout, func(svc *v1.Service) bool {
+		return nodePortOf(svc) != 0
+	})
 	if err != nil {
 		return 0, err
 	}
+	return nodePortOf(svc), nil
+}
 
-	for {
-		select {
-		case event := <-serviceWatch.ResultChan():
-			svc := event.Object.(*v1.Service) // nolint
-			if svc.Name == s.service.Name {
-				for _, port := range svc.Spec.Ports {
-					if port.NodePort != 0 {
-						nodePort = port.NodePort
-						return nodePort, nil
-					}
-				}
-			}
-		case <-time.After(waitTime):
-			return nodePort, nil
+// nodePortOf returns the first node port of the service, zero if none
+func nodePortOf(svc *v1.Service) int32 {
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort != 0 {
+			return port.NodePort
 		}
 	}
+	return 0
 }
 
-// WaitForExternalIP pause the process until timeout and returns the array of ExteranlIP
-func (s *Service) WaitForExternalIP() ([]string, error) {
-	var ips []string
-	opts := metav1.ListOptions{}
-	serviceWatch, err := s.clientSet.CoreV1().Services(s.service.Namespace).Watch(context.TODO(), opts)
+// WaitForExternalIP returns the load balancer ingress IPs of the service, by pausing the process until timeout
+// or an ingress IP is assigned
+func (s *Service) WaitForExternalIP(ctx context.Context) ([]string, error) {
+	svc, err := s.getWaiter().WaitForService(ctx, s.service.Name, "load balancer ingress IP", s.waitTimeout, func(svc *v1.Service) bool {
+		return len(ingressIPsOf(svc)) > 0
+	})
 	if err != nil {
-		return []string{}, nil
-	}
-	for {
-		select {
-		case event := <-serviceWatch.ResultChan():
-			svc := event.Object.(*v1.Service) // nolint
-			if svc.Name == s.service.Name {
-				for _, ip := range svc.Status.LoadBalancer.Ingress {
-					ips = append(ips, ip.IP)
-				}
-			}
-		case <-time.After(waitTime):
-			return ips, nil
+		return []string{}, err
+	}
+	return ingressIPsOf(svc), nil
+}
+
+// ingressIPsOf returns the load balancer ingress IPs of the service
+func ingressIPsOf(svc *v1.Service) []string {
+	var ips []string
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
 		}
 	}
+	return ips
 }
@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("service with fake clientset", func() {
+	var (
+		ctx     context.Context
+		cs      *fake.Clientset
+		svc     *v1.Service
+		service *Service
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cs = fake.NewSimpleClientset()
+		svc = &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc-1", Namespace: "ns-1"},
+			Spec: v1.ServiceSpec{
+				ClusterIP: "10.96.0.10",
+				Ports:     []v1.ServicePort{{Port: 80, NodePort: 30080}},
+			},
+		}
+		service = NewService(cs, svc)
+		_, err := service.Create()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should create and delete the service", func() {
+		created, err := cs.CoreV1().Services("ns-1").Get(ctx, "svc-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.Spec.ClusterIP).To(Equal("10.96.0.10"))
+		Expect(service.GetClusterIP()).To(Equal("10.96.0.10"))
+
+		Expect(service.Delete()).To(Succeed())
+		_, err = cs.CoreV1().Services("ns-1").Get(ctx, "svc-1", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail to create a service twice", func() {
+		_, err := service.Create()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should toggle labels", func() {
+		_, err := service.GetLabel("service.kubernetes.io/headless")
+		Expect(IsLabelNotFound(err)).To(BeTrue())
+
+		Expect(service.SetLabel("service.kubernetes.io/headless", "")).To(Succeed())
+		updated, err := cs.CoreV1().Services("ns-1").Get(ctx, "svc-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Labels).To(HaveKeyWithValue("service.kubernetes.io/headless", ""))
+		value, err := service.GetLabel("service.kubernetes.io/headless")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeEmpty())
+
+		Expect(service.RemoveLabel("service.kubernetes.io/headless")).To(Succeed())
+		updated, err = cs.CoreV1().Services("ns-1").Get(ctx, "svc-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Labels).NotTo(HaveKey("service.kubernetes.io/headless"))
+		Expect(IsLabelNotFound(service.RemoveLabel("service.kubernetes.io/headless"))).To(BeTrue())
+	})
+
+	Context("waiting with informers", func() {
+		AfterEach(func() {
+			StopSharedWaiters()
+		})
+
+		It("should stop the shared waiter of a namespace only", func() {
+			waiter, other := SharedWaiter(cs, "ns-1"), SharedWaiter(cs, "ns-2")
+			StopSharedWaiter(cs, "ns-1")
+			Expect(waiter.stop).To(BeClosed())
+			Expect(other.stop).NotTo(BeClosed())
+			Expect(SharedWaiter(cs, "ns-1")).NotTo(BeIdenticalTo(waiter))
+			Expect(SharedWaiter(cs, "ns-2")).To(BeIdenticalTo(other))
+		})
+
+		It("should wait on the current shared waiter once the previous one is stopped", func() {
+			_, err := service.WaitForClusterIP(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			StopSharedWaiter(cs, "ns-1")
+			clusterIP, err := service.WaitForClusterIP(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clusterIP).To(Equal("10.96.0.10"))
+		})
+
+		It("should fail the waits of a stopped waiter", func() {
+			waiter := NewWaiter(cs, "ns-1")
+			waiter.Stop()
+			_, err := waiter.WaitForService(ctx, "svc-1", "cluster IP", time.Minute, func(*v1.Service) bool { return true })
+			Expect(err).To(MatchError(ErrWaiterStopped))
+
+			waiter = NewWaiter(cs, "ns-1")
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				waiter.Stop()
+			}()
+			_, err = waiter.WaitForService(ctx, "svc-1", "external IP", time.Minute, func(*v1.Service) bool { return false })
+			Expect(err).To(MatchError(ErrWaiterStopped))
+		})
+
+		It("should return the cluster IP of the service", func() {
+			clusterIP, err := service.WaitForClusterIP(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clusterIP).To(Equal("10.96.0.10"))
+		})
+
+		It("should return the cluster IPs of a dual-stack service once allocated", func() {
+			pending := NewService(cs, &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc-2", Namespace: "ns-1"}})
+			created, err := pending.Create()
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(50 * time.Millisecond)
+				created.Spec.ClusterIP = "10.96.0.11"
+				created.Spec.ClusterIPs = []string{"10.96.0.11", "fd00:10:96::b"}
+				_, err := cs.CoreV1().Services("ns-1").Update(ctx, created, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}()
+			clusterIPs, err := pending.WaitForClusterIPs(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clusterIPs).To(Equal([]string{"10.96.0.11", "fd00:10:96::b"}))
+		})
+
+		It("should return the node port of the service", func() {
+			nodePort, err := service.WaitForNodePort(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodePort).To(Equal(int32(30080)))
+		})
+
+		It("should return when the endpoint addresses are ready", func() {
+			go func() {
+				defer GinkgoRecover()
+				_, err := cs.CoreV1().Endpoints("ns-1").Create(ctx, &v1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "svc-1", Namespace: "ns-1"},
+					Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "10.244.0.2"}}}},
+				}, metav1.CreateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}()
+			ready, err := service.WaitForEndpoint(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ready).To(BeTrue())
+		})
+
+		It("should return a timeout error when the condition is not met in time", func() {
+			service.SetWaitTimeout(100 * time.Millisecond)
+			ips, err := service.WaitForExternalIP(ctx)
+			Expect(IsTimeout(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("service ns-1/svc-1: load balancer ingress IP"))
+			Expect(ips).To(BeEmpty())
+
+			ready, err := service.WaitForEndpoint(ctx)
+			Expect(IsTimeout(err)).To(BeTrue())
+			Expect(ready).To(BeFalse())
+		})
+
+		It("should stop waiting when the context is done", func() {
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err := service.WaitForExternalIP(cancelledCtx)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+	})
+})
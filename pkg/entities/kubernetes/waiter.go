@@ -0,0 +1,190 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultWaitTimeout bounds the waits on the services and endpoints
+const DefaultWaitTimeout = 15 * time.Second
+
+// Waiter waits for conditions on the services and endpoints of a namespace, watched by shared informers
+// started on the first wait. The objects are looked up by name and checked again on every change.
+type Waiter struct {
+	clientSet kubernetes.Interface
+	namespace string
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	services  listersv1.ServiceLister
+	endpoints listersv1.EndpointsLister
+
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// NewWaiter returns a waiter on the services and endpoints of the namespace
+func NewWaiter(cs kubernetes.Interface, namespace string) *Waiter {
+	return &Waiter{
+		clientSet: cs,
+		namespace: namespace,
+		stop:      make(chan struct{}),
+		changed:   make(chan struct{}),
+	}
+}
+
+// waiterKey identifies the shared waiter of a namespace
+type waiterKey struct {
+	clientSet kubernetes.Interface
+	namespace string
+}
+
+var (
+	sharedWaitersMu sync.Mutex
+	sharedWaiters   = map[waiterKey]*Waiter{}
+)
+
+// SharedWaiter returns the waiter of the namespace shared by all the services of the client set
+func SharedWaiter(cs kubernetes.Interface, namespace string) *Waiter {
+	sharedWaitersMu.Lock()
+	defer sharedWaitersMu.Unlock()
+	key := waiterKey{clientSet: cs, namespace: namespace}
+	waiter, ok := sharedWaiters[key]
+	if !ok {
+		waiter = NewWaiter(cs, namespace)
+		sharedWaiters[key] = waiter
+	}
+	return waiter
+}
+
+// StopSharedWaiter stops the informers of the shared waiter of the namespace, e.g. once the namespace is deleted
+func StopSharedWaiter(cs kubernetes.Interface, namespace string) {
+	sharedWaitersMu.Lock()
+	defer sharedWaitersMu.Unlock()
+	key := waiterKey{clientSet: cs, namespace: namespace}
+	if waiter, ok := sharedWaiters[key]; ok {
+		waiter.Stop()
+		delete(sharedWaiters, key)
+	}
+}
+
+// StopSharedWaiters stops the informers of all the shared waiters
+func StopSharedWaiters() {
+	sharedWaitersMu.Lock()
+	defer sharedWaitersMu.Unlock()
+	for key, waiter := range sharedWaiters {
+		waiter.Stop()
+		delete(sharedWaiters, key)
+	}
+}
+
+// start starts the informers on the first call
+func (w *Waiter) start() {
+	w.startOnce.Do(func() {
+		factory := informers.NewSharedInformerFactoryWithOptions(w.clientSet, 0, informers.WithNamespace(w.namespace))
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { w.notify() },
+			UpdateFunc: func(interface{}, interface{}) { w.notify() },
+			DeleteFunc: func(interface{}) { w.notify() },
+		}
+		services, endpoints := factory.Core().V1().Services(), factory.Core().V1().Endpoints()
+		services.Informer().AddEventHandler(handler)
+		endpoints.Informer().AddEventHandler(handler)
+		w.services, w.endpoints = services.Lister(), endpoints.Lister()
+		factory.Start(w.stop)
+	})
+}
+
+// Stop stops the informers of the waiter
+func (w *Waiter) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// notify wakes up the waits to check their condition again
+func (w *Waiter) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// changes returns a channel closed on the next change of the watched objects
+func (w *Waiter) changes() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+// stopped returns true once the waiter is stopped
+func (w *Waiter) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait returns once check is true, checking it on every change, timeoutErr once its timeout passed, the
+// error of ctx once done, or ErrWaiterStopped once the waiter is stopped, even before its start
+func (w *Waiter) wait(ctx context.Context, timeoutErr *TimeoutError, check func() bool) error {
+	if w.stopped() {
+		return ErrWaiterStopped
+	}
+	w.start()
+	timer := time.NewTimer(timeoutErr.Timeout)
+	defer timer.Stop()
+	for {
+		changed := w.changes()
+		if check() {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return timeoutErr
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.stop:
+			return ErrWaiterStopped
+		}
+	}
+}
+
+// WaitForService waits up to timeout for the named service to meet the condition described by condition,
+// and returns the service. A *TimeoutError is returned if it did not in time.
+func (w *Waiter) WaitForService(ctx context.Context, name, condition string, timeout time.Duration, ready func(*v1.Service) bool) (*v1.Service, error) {
+	var service *v1.Service
+	err := w.wait(ctx, &TimeoutError{Kind: "service", Namespace: w.namespace, Name: name, Condition: condition, Timeout: timeout}, func() bool {
+		svc, err := w.services.Services(w.namespace).Get(name)
+		if err != nil || !ready(svc) {
+			return false
+		}
+		service = svc
+		return true
+	})
+	return service, err
+}
+
+// WaitForEndpoints waits up to timeout for the named endpoints to meet the condition described by condition,
+// and returns the endpoints. A *TimeoutError is returned if they did not in time.
+func (w *Waiter) WaitForEndpoints(ctx context.Context, name, condition string, timeout time.Duration, ready func(*v1.Endpoints) bool) (*v1.Endpoints, error) {
+	var endpoints *v1.Endpoints
+	err := w.wait(ctx, &TimeoutError{Kind: "endpoints", Namespace: w.namespace, Name: name, Condition: condition, Timeout: timeout}, func() bool {
+		eps, err := w.endpoints.Endpoints(w.namespace).Get(name)
+		if err != nil || !ready(eps) {
+			return false
+		}
+		endpoints = eps
+		return true
+	})
+	return endpoints, err
+}
@@ -30,6 +30,24 @@ func (ns *Namespace) LabelSelector() map[string]string {
 	return map[string]string{"ns": ns.Name}
 }
 
+// NewNamespaceWithHTTPPods creates a new namespace given a combinations of pod names and ports,
+// the pods serve their hostname over HTTP on TCP
+func NewNamespaceWithHTTPPods(namespaceName string, podNames []string, ports []int32) *Namespace {
+	pods := make([]*Pod, 0)
+	for _, podName := range podNames {
+		var containers []*Container
+		for _, port := range ports {
+			containers = append(containers, &Container{
+				Port:     port,
+				Protocol: v1.ProtocolTCP,
+				HTTP:     true,
+			})
+		}
+		pods = append(pods, &Pod{Namespace: namespaceName, Name: podName, Containers: containers})
+	}
+	return &Namespace{Name: namespaceName, Pods: pods}
+}
+
 // NewNamespaceWithPodsGivenImageAndCommand creates a new namespace given a combinations of pod names, ports and protocol
 // also the container image and command are specified
 func NewNamespaceWithPodsGivenImageAndCommand(namespaceName string, podNames []string, ports []int32, protocols []v1.Protocol,
@@ -75,6 +93,26 @@ func NewNamespaceWithIPerfPods(namespaceName string, podNames []string, ports []
 	return &Namespace{Name: namespaceName, Pods: pods}
 }
 
+// NewNamespaceWithNetexecPods creates a new namespace given a combinations of pod names and ports,
+// the pods serve agnhost netexec over HTTP on TCP, answering the client address on /clientip
+func NewNamespaceWithNetexecPods(namespaceName string, podNames []string, ports []int32) *Namespace {
+	pods := make([]*Pod, 0)
+	for _, podName := range podNames {
+		var containers []*Container
+		for _, port := range ports {
+			netexec := commands.NewNetexecServer(int(port), v1.ProtocolTCP)
+			containers = append(containers, &Container{
+				Port:     port,
+				Protocol: v1.ProtocolTCP,
+				Image:    AgnhostImage,
+				Command:  netexec.ServeCommand(),
+			})
+		}
+		pods = append(pods, &Pod{Namespace: namespaceName, Name: podName, Containers: containers})
+	}
+	return &Namespace{Name: namespaceName, Pods: pods}
+}
+
 // NewNamespaceWithPods creates a new namespace given a combinations of pod names, ports and protocol
 // without explicitly specifies the container image
 // we use agnhost serve hostname in this case
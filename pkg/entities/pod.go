@@ -20,8 +20,11 @@ type Pod struct { // nolint
 	SkipProbe      bool
 	serviceName    string
 	clusterIP      string
+	clusterIPs     []string
 	PodIP          string
 	HostIP         string
+	PodIPs         []string
+	HostIPs        []string
 	ToPort         int32
 	HostNetwork    bool
 	Labels         map[string]string
@@ -67,6 +70,19 @@ func (p *Pod) SetHostIP(hostIP string) {
 	p.HostIP = hostIP
 }
 
+// GetHostIPByFamily returns the HostIP of the pod in the IP family, the primary one if the family is empty
+func (p *Pod) GetHostIPByFamily(family v1.IPFamily) string {
+	return ipByFamily(p.HostIP, p.HostIPs, family)
+}
+
+// SetHostIPs sets all the host IPs of the pod, the first one being the primary HostIP
+func (p *Pod) SetHostIPs(hostIPs []string) {
+	p.HostIPs = hostIPs
+	if len(hostIPs) > 0 {
+		p.HostIP = hostIPs[0]
+	}
+}
+
 // GetNodeName returns node name for the pod
 func (p *Pod) GetNodeName() string {
 	return p.NodeName
@@ -87,6 +103,27 @@ func (p *Pod) SetClusterIP(clusterIP string) {
 	p.clusterIP = clusterIP
 }
 
+// GetClusterIPByFamily returns the cluster IP of the pod service in the IP family, the primary one if the family is empty
+func (p *Pod) GetClusterIPByFamily(family v1.IPFamily) string {
+	return ipByFamily(p.clusterIP, p.clusterIPs, family)
+}
+
+// SetClusterIPs sets all the cluster IPs of the pod service, the first one being the primary cluster IP
+func (p *Pod) SetClusterIPs(clusterIPs []string) {
+	p.clusterIPs = clusterIPs
+	if len(clusterIPs) > 0 {
+		p.clusterIP = clusterIPs[0]
+	}
+}
+
+// GetClusterIPs returns all the cluster IPs of the pod service, the primary one first
+func (p *Pod) GetClusterIPs() []string {
+	if len(p.clusterIPs) == 0 && p.clusterIP != "" {
+		return []string{p.clusterIP}
+	}
+	return p.clusterIPs
+}
+
 // GetServiceName returns PodIP for the pod
 func (p *Pod) GetServiceName() string {
 	return p.serviceName
@@ -107,6 +144,32 @@ func (p *Pod) SetPodIP(podIP string) {
 	p.PodIP = podIP
 }
 
+// GetPodIPByFamily returns the IP of the pod in the IP family, the primary one if the family is empty
+func (p *Pod) GetPodIPByFamily(family v1.IPFamily) string {
+	return ipByFamily(p.PodIP, p.PodIPs, family)
+}
+
+// SetPodIPs sets all the IPs of the pod, the first one being the primary PodIP
+func (p *Pod) SetPodIPs(podIPs []string) {
+	p.PodIPs = podIPs
+	if len(podIPs) > 0 {
+		p.PodIP = podIPs[0]
+	}
+}
+
+// IPFamilies returns the IP families of the pod addresses, the primary one first
+func (p *Pod) IPFamilies() []v1.IPFamily {
+	var families []v1.IPFamily
+	for _, ip := range append([]string{p.PodIP}, p.PodIPs...) {
+		family := IPFamilyOf(ip)
+		if family == "" || IPFamilyOnSlice(family, families) {
+			continue
+		}
+		families = append(families, family)
+	}
+	return families
+}
+
 // GetExternalIPs returns the array of ExternalIP for the pod
 func (p *Pod) GetExternalIPs() []ExternalIP {
 	return p.ExternalIPs
@@ -128,6 +191,23 @@ func (p *Pod) SetExternalIPs(externalIPs []ExternalIP) {
 	p.ExternalIPs = externalIPs
 }
 
+// AddProbeAgent adds the probe agent sidecar to the pod, once
+func (p *Pod) AddProbeAgent(image ContainerImage) {
+	if !p.HasProbeAgent() {
+		p.Containers = append(p.Containers, NewProbeAgentContainer(image))
+	}
+}
+
+// HasProbeAgent returns true if the pod runs the probe agent sidecar
+func (p *Pod) HasProbeAgent() bool {
+	for _, container := range p.Containers {
+		if container.Name == ProbeAgentContainerName {
+			return true
+		}
+	}
+	return false
+}
+
 // IsPerf returns true if the pod is an iperf server for performance testing
 func (p *Pod) IsPerf() bool {
 	for _, container := range p.Containers {
@@ -150,9 +230,14 @@ func (p *Pod) ServiceName() string {
 	return fmt.Sprintf("s-%s-%s", p.Namespace, p.Name)
 }
 
-// QualifiedServiceAddress returns the address that can be used to hit a service from any namespace in the cluster
+// QualifiedServiceAddress returns the address that can be used to hit a service from any namespace in the cluster,
+// using the name of the service created for the pod if set
 func (p *Pod) QualifiedServiceAddress(dnsDomain string) string {
-	return fmt.Sprintf("%s.%s.svc.%s", p.ServiceName(), p.Namespace, dnsDomain)
+	serviceName := p.serviceName
+	if serviceName == "" {
+		serviceName = p.ServiceName()
+	}
+	return fmt.Sprintf("%s.%s.svc.%s", serviceName, p.Namespace, dnsDomain)
 }
 
 // ContainersToK8SSpec builds kubernetes Containers specs for the pod
@@ -251,6 +336,7 @@ func (p *Pod) Reset() {
 	p.SkipProbe = false
 	p.serviceName = ""
 	p.clusterIP = ""
+	p.clusterIPs = nil
 	p.ToPort = 0
 	p.HostNetwork = false
 }
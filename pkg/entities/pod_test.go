@@ -137,6 +137,11 @@ var _ = Describe("pod test", func() {
 		It("should return dns domain is provided", func() {
 			Expect(pod.QualifiedServiceAddress("example.com")).To(Equal("s-test-ns-my-pod.test-ns.svc.example.com"))
 		})
+
+		It("should use the name of the created service in the address", func() {
+			pod.SetServiceName("my-svc")
+			Expect(pod.QualifiedServiceAddress("cluster.local")).To(Equal("my-svc.test-ns.svc.cluster.local"))
+		})
 	})
 
 	Context("pod selector", func() {
@@ -163,12 +168,31 @@ var _ = Describe("pod test", func() {
 		})
 	})
 
+	Context("dual-stack addresses", func() {
+		BeforeEach(func() {
+			pod.SetPodIPs([]string{"10.244.1.2", "fd00:10:244:1::2"})
+			pod.SetHostIPs([]string{"172.18.0.2"})
+			pod.SetClusterIPs([]string{"fd00:10:96::a", "10.96.0.10"})
+		})
+
+		It("should return the address of each IP family", func() {
+			Expect(pod.GetPodIP()).To(Equal("10.244.1.2"))
+			Expect(pod.GetPodIPByFamily(v1.IPv6Protocol)).To(Equal("fd00:10:244:1::2"))
+			Expect(pod.GetClusterIP()).To(Equal("fd00:10:96::a"))
+			Expect(pod.GetClusterIPByFamily(v1.IPv4Protocol)).To(Equal("10.96.0.10"))
+			Expect(pod.GetClusterIPByFamily("")).To(Equal("fd00:10:96::a"))
+			Expect(pod.GetHostIPByFamily(v1.IPv6Protocol)).To(BeEmpty())
+			Expect(pod.IPFamilies()).To(Equal([]v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}))
+		})
+	})
+
 	Context("reset pod", func() {
 		BeforeEach(func() {
 			pod.ExternalIPs = NewExternalIPs([]string{sampleIP1, sampleIP2, sampleIP3}, v1.ProtocolTCP)
 			pod.SkipProbe = true
 			pod.serviceName = "svc"
 			pod.clusterIP = sampleIP1
+			pod.clusterIPs = []string{sampleIP1}
 			pod.ToPort = 8080
 			pod.HostNetwork = true
 		})
@@ -179,6 +203,7 @@ var _ = Describe("pod test", func() {
 			Expect(pod.SkipProbe).To(BeFalse())
 			Expect(pod.serviceName).To(BeEmpty())
 			Expect(pod.clusterIP).To(BeEmpty())
+			Expect(pod.clusterIPs).To(BeNil())
 			Expect(pod.ToPort).To(BeZero())
 			Expect(pod.HostNetwork).To(BeFalse())
 		})
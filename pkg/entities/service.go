@@ -15,6 +15,7 @@ const (
 	ClusterIP    = "clusteip"
 	NodePort     = "nodeport"
 	ExternalName = "externalname"
+	Headless     = "headless"
 	LoadBalancer = "loadbalancer"
 
 	Allprotocols = "allprotocols"
@@ -26,6 +27,11 @@ type ServiceTemplate struct {
 	Selector        map[string]string
 	ProtocolPorts   []ProtocolPortPair
 	SessionAffinity bool
+	// Type is the type of the service, ClusterIP if empty
+	Type v1.ServiceType
+	// IPFamilyPolicy and IPFamilies select the IP families of the service cluster IPs, the cluster defaults if unset
+	IPFamilyPolicy *v1.IPFamilyPolicyType
+	IPFamilies     []v1.IPFamily
 }
 
 type ProtocolPortPair struct {
@@ -55,10 +61,22 @@ func NewService(p *Pod) *v1.Service {
 	}
 }
 
+// WithIPFamilies sets the IP family policy and families of the service, the families may be empty
+// to let the cluster choose them following the policy
+func WithIPFamilies(service *v1.Service, policy v1.IPFamilyPolicyType, families ...v1.IPFamily) *v1.Service {
+	service.Spec.IPFamilyPolicy = &policy
+	service.Spec.IPFamilies = families
+	return service
+}
+
 // portFromContainer is a helper to return port spec from the service
 func portFromContainer(containers []*Container, protocol v1.Protocol) []v1.ServicePort {
 	portsSet := map[v1.ServicePort]bool{}
 	for _, container := range containers {
+		// sidecars without port, e.g. the probe agent, are not backends of the service
+		if container.Port == 0 {
+			continue
+		}
 		if protocol != Allprotocols && protocol != container.Protocol {
 			continue
 		}
@@ -85,6 +103,13 @@ func (p *Pod) ClusterIPService() *v1.Service {
 	return service
 }
 
+// HeadlessService returns a kube service spec without cluster IP, its name resolves to the pod IP
+func (p *Pod) HeadlessService() *v1.Service {
+	service := p.ClusterIPService()
+	service.Spec.ClusterIP = v1.ClusterIPNone
+	return service
+}
+
 // NodePortService returns a new node port service
 func (p *Pod) NodePortService() *v1.Service {
 	service := NewService(p)
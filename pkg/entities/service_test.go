@@ -68,6 +68,11 @@ var _ = Describe("service unit test", func() {
 			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeClusterIP))
 			Expect(service.Spec.Ports).To(HaveLen(3))
 		})
+		It("can create headless service", func() {
+			service := pod.HeadlessService()
+			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeClusterIP))
+			Expect(service.Spec.ClusterIP).To(Equal(v1.ClusterIPNone))
+		})
 		It("can create nodeport service", func() {
 			service := pod.NodePortService()
 			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeNodePort))
@@ -78,6 +83,11 @@ var _ = Describe("service unit test", func() {
 			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeLoadBalancer))
 			Expect(service.Spec.Ports).To(HaveLen(3))
 		})
+		It("can create dual-stack service", func() {
+			service := WithIPFamilies(pod.ClusterIPService(), v1.IPFamilyPolicyRequireDualStack, v1.IPv6Protocol, v1.IPv4Protocol)
+			Expect(*service.Spec.IPFamilyPolicy).To(Equal(v1.IPFamilyPolicyRequireDualStack))
+			Expect(service.Spec.IPFamilies).To(Equal([]v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}))
+		})
 		It("can create external name service", func() {
 			service := pod.ExternalNameService("example.com")
 			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeExternalName))
@@ -0,0 +1,206 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/agent"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/consts"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+// agentBatchCommand runs a batch of probes in the probe agent sidecar, requests on stdin and responses on stdout
+var agentBatchCommand = []string{"/probe-agent", "batch"}
+
+// agentExecMargin is added to the probes duration of a batch to bound its exec, covering the round trip of the exec
+var agentExecMargin = 10 * time.Second
+
+// AgentProber probes through the probe agent sidecar of the source pods, with a single exec per batch of jobs
+// of a source pod instead of one per job. The jobs the agent does not support, the source pods without agent
+// and the batches the agent failed to run are probed by the fallback prober.
+type AgentProber struct {
+	executor ek.PodExecutor
+	fallback Prober
+
+	// Workers is the number of fallback probes of a batch running concurrently, DefaultProbeWorkers if zero
+	Workers int
+}
+
+// NewAgentProber returns an AgentProber executing the batches with the executor of the manager, falling back on
+// the exec probes of the manager
+func NewAgentProber(k *KubeManager) *AgentProber {
+	return &AgentProber{executor: k.executor, fallback: k}
+}
+
+// Batchable returns true if the agent of the source pod can probe the job, connections and their latency on
+// TCP and UDP
+func (a *AgentProber) Batchable(job *ProbeJob) bool {
+	if !job.PodFrom.HasProbeAgent() {
+		return false
+	}
+	if job.Mode != ProbeModeConnect && job.Mode != ProbeModeReachTargetPod && job.Mode != ProbeModeLatency {
+		return false
+	}
+	return job.Protocol == v1.ProtocolTCP || job.Protocol == v1.ProtocolUDP
+}
+
+// Probe probes a single job, through the agent if it supports the job
+func (a *AgentProber) Probe(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	if !a.Batchable(job) {
+		return a.fallback.Probe(ctx, job)
+	}
+	return a.ProbeBatch(ctx, []*ProbeJob{job})[0]
+}
+
+// ProbeBatch sends the jobs of a source pod to its agent in a single exec, and returns their results in the
+// order of the jobs. The jobs are probed by the fallback prober if the agent fails or its exec outlasts the probes.
+func (a *AgentProber) ProbeBatch(ctx context.Context, jobs []*ProbeJob) []*ProbeJobResults {
+	podFrom := jobs[0].PodFrom
+	requests := make([]*agent.Request, len(jobs))
+	var timeout time.Duration
+	for i, job := range jobs {
+		requests[i] = &agent.Request{
+			ID:       i,
+			Address:  job.Address(),
+			Port:     job.ToPort,
+			Protocol: string(job.Protocol),
+			Hostname: job.Mode == ProbeModeReachTargetPod,
+			Timeout:  job.Timeout,
+		}
+		if job.Mode == ProbeModeLatency {
+			requests[i].Connects = consts.LatencyConnectsPerProbe
+		}
+		if probeTimeout := requests[i].Timeout; probeTimeout > timeout {
+			timeout = probeTimeout
+		} else if probeTimeout <= 0 && agent.DefaultTimeout > timeout {
+			timeout = agent.DefaultTimeout
+		}
+	}
+	// the agent runs agent.DefaultWorkers probes at once, the longest probes may run in several rounds
+	rounds := (len(jobs) + agent.DefaultWorkers - 1) / agent.DefaultWorkers
+	execCtx, cancel := context.WithTimeout(ctx, time.Duration(rounds)*timeout+agentExecMargin)
+	defer cancel()
+
+	responses, err := a.execBatch(execCtx, podFrom, requests)
+	results := make([]*ProbeJobResults, len(jobs))
+	if err != nil {
+		if ctx.Err() != nil {
+			for i, job := range jobs {
+				results[i] = &ProbeJobResults{Job: job, Err: ctx.Err(), Command: "cancelled", Outcome: OutcomeCancelled}
+			}
+			return results
+		}
+		zap.L().Warn("Probe agent failed, falling back to exec probes.",
+			zap.String("pod", string(podFrom.PodString())), zap.String("err", err.Error()),
+		)
+		return a.probeFallbacks(ctx, jobs)
+	}
+
+	for i, job := range jobs {
+		resp := responses[i]
+		results[i] = &ProbeJobResults{
+			Job:         job,
+			IsConnected: resp.Connected,
+			Endpoint:    resp.Endpoint,
+			Stderr:      resp.Error,
+			Outcome:     Outcome(resp.Outcome),
+			Command: fmt.Sprintf("kubectl exec %s -c %s -n %s -- %s # %s/%s", podFrom.Name, entities.ProbeAgentContainerName,
+				podFrom.Namespace, strings.Join(agentBatchCommand, " "), net.JoinHostPort(requests[i].Address, strconv.Itoa(requests[i].Port)), job.Protocol),
+		}
+		if job.Mode == ProbeModeLatency && resp.Connected {
+			results[i].Latency = &ProbeJobLatencyResults{Durations: resp.Durations}
+		}
+	}
+	return results
+}
+
+// execBatch runs the batch of requests in the agent of the pod, and returns a response per request, in order
+func (a *AgentProber) execBatch(ctx context.Context, pod *entities.Pod, requests []*agent.Request) ([]*agent.Response, error) {
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode the probe requests")
+	}
+	stdout, stderr, err := a.executor.Exec(ctx, &ek.ExecOptions{
+		Command:            agentBatchCommand,
+		Namespace:          pod.Namespace,
+		PodName:            pod.Name,
+		ContainerName:      entities.ProbeAgentContainerName,
+		Stdin:              bytes.NewReader(body),
+		CaptureStdout:      true,
+		CaptureStderr:      true,
+		PreserveWhitespace: false,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to run the probe agent: %s", stderr)
+	}
+
+	var responses []*agent.Response
+	if err := json.Unmarshal([]byte(stdout), &responses); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the probe responses")
+	}
+	if len(responses) != len(requests) {
+		return nil, errors.Errorf("expected %d probe responses, got %d", len(requests), len(responses))
+	}
+	for i, resp := range responses {
+		if resp == nil || resp.ID != i {
+			return nil, errors.Errorf("unexpected probe response at %d", i)
+		}
+	}
+	return responses, nil
+}
+
+// probeFallbacks probes the jobs with the fallback prober, a.Workers at once, and returns their results in the
+// order of the jobs
+func (a *AgentProber) probeFallbacks(ctx context.Context, jobs []*ProbeJob) []*ProbeJobResults {
+	workers := a.Workers
+	if workers <= 0 {
+		workers = DefaultProbeWorkers
+	}
+	results := make([]*ProbeJobResults, len(jobs))
+	indexes := make(chan int, len(jobs))
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = a.probeFallback(ctx, jobs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// probeFallback probes the job with the fallback prober, bounded by the job timeout
+func (a *AgentProber) probeFallback(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	result := a.fallback.Probe(ctx, job)
+	if ctx.Err() != nil {
+		result.IsConnected = false
+		result.Err = ctx.Err()
+		result.Outcome = OutcomeCancelled
+	}
+	return result
+}
@@ -0,0 +1,222 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/agent"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/consts"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+// agentExecutor is a PodExecutor running the batches of the probe agent in process
+type agentExecutor struct {
+	err error
+	// hang blocks the execs until their context is done
+	hang bool
+
+	mu       sync.Mutex
+	execs    int
+	requests []*agent.Request
+}
+
+func (e *agentExecutor) Exec(ctx context.Context, options *ek.ExecOptions) (stdout, stderr string, err error) {
+	e.mu.Lock()
+	e.execs++
+	e.mu.Unlock()
+	if e.err != nil {
+		return "", "", e.err
+	}
+	if e.hang {
+		<-ctx.Done()
+		return "", "", ctx.Err()
+	}
+	if options.ContainerName != entities.ProbeAgentContainerName {
+		return "", "", errors.New("unexpected container " + options.ContainerName)
+	}
+	body, err := io.ReadAll(options.Stdin)
+	if err != nil {
+		return "", "", err
+	}
+	var requests []*agent.Request
+	if err := json.Unmarshal(body, &requests); err != nil {
+		return "", "", err
+	}
+	e.mu.Lock()
+	e.requests = append(e.requests, requests...)
+	e.mu.Unlock()
+	var out bytes.Buffer
+	err = agent.ServeBatch(ctx, bytes.NewReader(body), &out, 0)
+	return out.String(), "", err
+}
+
+// concurrentProber is a Prober connecting every job after a delay, recording the most probes running at once
+type concurrentProber struct {
+	delay time.Duration
+
+	mu            sync.Mutex
+	running, most int
+}
+
+func (c *concurrentProber) Probe(_ context.Context, job *ProbeJob) *ProbeJobResults {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.most {
+		c.most = c.running
+	}
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+	c.mu.Lock()
+	c.running--
+	c.mu.Unlock()
+	return &ProbeJobResults{Job: job, IsConnected: true, Outcome: OutcomeConnected}
+}
+
+// serveHostnameTCP answers the hostname on every TCP connection, like agnhost serve-hostname
+func serveHostnameTCP(hostname string) (port int32, stop func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(hostname))
+			conn.Close()
+		}
+	}()
+	return int32(listener.Addr().(*net.TCPAddr).Port), func() { listener.Close() }
+}
+
+var _ = Describe("probe agent prober", func() {
+	var (
+		ctx      context.Context
+		model    *Model
+		pods     []*entities.Pod
+		executor *agentExecutor
+		prober   *AgentProber
+		stops    []func()
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = newFakeModel()
+		model.AddProbeAgents(entities.ProbeAgentImage)
+		pods = model.AllPods()
+		// pod-3 serves nothing, its port is the closed one of a stopped server
+		for _, pod := range pods {
+			port, stop := serveHostnameTCP(pod.Name)
+			pod.SetPodIP("127.0.0.1")
+			pod.SetToPort(port)
+			stops = append(stops, stop)
+		}
+		stops[2]()
+		executor = &agentExecutor{}
+		prober = &AgentProber{executor: executor, fallback: NewFakeProber(&FakeRule{Connected: true})}
+	})
+
+	AfterEach(func() {
+		for _, stop := range stops {
+			stop()
+		}
+		stops = nil
+	})
+
+	newTestCase := func() *TestCase {
+		reachability := NewReachability(pods, true)
+		reachability.ExpectPeer(&Peer{}, &Peer{Pod: "pod-3"}, false)
+		return &TestCase{Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP, Reachability: reachability}
+	}
+
+	It("should probe a row of the matrix per exec", func() {
+		opts := DefaultProbeOptions()
+		opts.Mode = ProbeModeReachTargetPod
+		testCase := newTestCase()
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+		Expect(executor.execs).To(Equal(3))
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[0].PodString().String(), pods[2].PodString().String())).To(Equal(OutcomeRefused))
+	})
+
+	It("should send the probe timeout of the test case to the agent", func() {
+		testCase := newTestCase()
+		testCase.ProbeTimeout = 2 * time.Second
+		Expect(ValidateOrFail(ctx, prober, model, testCase, DefaultProbeOptions())).To(BeZero())
+		Expect(executor.requests).NotTo(BeEmpty())
+		for _, request := range executor.requests {
+			Expect(request.Timeout).To(Equal(2 * time.Second))
+		}
+	})
+
+	It("should fall back on the exec probes when the agent exec outlasts the probes", func() {
+		margin := agentExecMargin
+		agentExecMargin = 0
+		defer func() { agentExecMargin = margin }()
+		executor.hang = true
+		results := prober.ProbeBatch(ctx, []*ProbeJob{{PodFrom: pods[0], PodTo: pods[1], Protocol: v1.ProtocolTCP, Mode: ProbeModeConnect, Timeout: 50 * time.Millisecond}})
+		Expect(results[0].IsConnected).To(BeTrue())
+		Expect(results[0].Outcome).NotTo(Equal(OutcomeCancelled))
+	})
+
+	It("should run the fallback probes of a failed batch concurrently, up to the workers", func() {
+		executor.err = errors.New("container probe-agent not found")
+		fallback := &concurrentProber{delay: 20 * time.Millisecond}
+		prober = &AgentProber{executor: executor, fallback: fallback, Workers: 3}
+		jobs := make([]*ProbeJob, 6)
+		for i := range jobs {
+			jobs[i] = &ProbeJob{PodFrom: pods[0], PodTo: pods[i%len(pods)], Protocol: v1.ProtocolTCP, Mode: ProbeModeConnect}
+		}
+		results := prober.ProbeBatch(ctx, jobs)
+		Expect(results).To(HaveLen(len(jobs)))
+		for i, result := range results {
+			Expect(result.Job).To(BeIdenticalTo(jobs[i]))
+			Expect(result.IsConnected).To(BeTrue())
+		}
+		Expect(fallback.most).To(BeNumerically(">", 1))
+		Expect(fallback.most).To(BeNumerically("<=", 3))
+	})
+
+	It("should time the connects of the latency probes in the agent", func() {
+		results := prober.ProbeBatch(ctx, []*ProbeJob{
+			{PodFrom: pods[0], PodTo: pods[1], Protocol: v1.ProtocolTCP, Mode: ProbeModeLatency},
+			{PodFrom: pods[0], PodTo: pods[2], Protocol: v1.ProtocolTCP, Mode: ProbeModeLatency},
+		})
+		Expect(results[0].IsConnected).To(BeTrue())
+		Expect(results[0].Latency.Durations).To(HaveLen(consts.LatencyConnectsPerProbe))
+		Expect(results[1].IsConnected).To(BeFalse())
+		Expect(results[1].Latency).To(BeNil())
+		Expect(executor.requests[0].Connects).To(Equal(consts.LatencyConnectsPerProbe))
+	})
+
+	It("should send the samples of a pair in distinct batches", func() {
+		opts := DefaultProbeOptions()
+		opts.Samples = 2
+		opts.SuccessThreshold = 1
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(), opts)).To(BeZero())
+		Expect(executor.execs).To(Equal(6))
+	})
+
+	It("should fall back on the exec probes", func() {
+		executor.err = errors.New("container probe-agent not found")
+		opts := DefaultProbeOptions()
+		opts.Retries = -1
+		// the fallback connects every pair, pod-3 included
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(), opts)).To(Equal(3))
+
+		pods[0].Containers = pods[0].Containers[:1]
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[0], Protocol: v1.ProtocolTCP, Mode: ProbeModeConnect})).To(BeFalse())
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[1], Protocol: v1.ProtocolSCTP, Mode: ProbeModeConnect})).To(BeFalse())
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[1], Protocol: v1.ProtocolTCP, Mode: ProbeModeHTTP})).To(BeFalse())
+	})
+})
@@ -1,28 +1,357 @@
 package matrix
 
-// nolint
-var MatrixResults *Results
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 
-// nolint
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// MatrixResults collects the results of the test cases validated by the run, for its summary
+var MatrixResults = &Results{}
+
+// Results are the results of the validated test cases, in the order of their validation
 type Results struct {
+	mu      sync.Mutex
 	results []*Result
 }
 
-// nolint
+// Result is the result of the validation of a test case by a feature
 type Result struct {
-	Name     string
-	label    Label
-	Result   bool
-	WrongNum int
+	// Name is the name of the feature validating the test case
+	Name   string  `json:"name"`
+	Labels []Label `json:"labels,omitempty"`
+	// TestCase is the name of the test case, e.g. "nodeport-tcp-80"
+	TestCase    string      `json:"testCase"`
+	ServiceType string      `json:"serviceType"`
+	Protocol    v1.Protocol `json:"protocol"`
+	// Result is true if the validation succeeded
+	Result   bool `json:"result"`
+	WrongNum int  `json:"wrong"`
+	// Matrix is the reachability of the test case, encoded as in the results of the output directory, or the
+	// backend distribution of a load balancing validation
+	Matrix json.RawMessage `json:"matrix,omitempty"`
 }
 
-// nolint
+// Label is a label of the feature of a result
 type Label struct {
-	key   string
-	value string
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
-// nolint
+// NewLabels returns the labels of a feature, sorted by key
+func NewLabels(labels map[string]string) []Label {
+	result := make([]Label, 0, len(labels))
+	for key, value := range labels {
+		result = append(result, Label{Key: key, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// Collect adds the result of a validated test case
 func (r *Results) Collect(result *Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.results = append(r.results, result)
 }
+
+// RunSummary is the consolidated report of the test cases validated by a run
+type RunSummary struct {
+	Version string    `json:"version"`
+	Passed  int       `json:"passed"`
+	Failed  int       `json:"failed"`
+	Results []*Result `json:"results"`
+}
+
+// Summary returns the report of the results collected so far
+func (r *Results) Summary() *RunSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary := &RunSummary{Version: ResultsVersion, Results: append([]*Result{}, r.results...)}
+	for _, result := range summary.Results {
+		if result.Result {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// Encode encodes the summary in the format
+func (s *RunSummary) Encode(format ResultsFormat) ([]byte, error) {
+	switch format {
+	case ResultsFormatJSON:
+		return json.MarshalIndent(s, "", "  ")
+	case ResultsFormatYAML:
+		return yaml.Marshal(s)
+	}
+	return nil, errors.Errorf("unknown results format %q", format)
+}
+
+// WriteSummary writes the report of the results collected so far to the file at path, in the format
+func (r *Results) WriteSummary(path string, format ResultsFormat) error {
+	data, err := r.Summary().Encode(format)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write the summary")
+	}
+	return nil
+}
+
+// PrettyPrint produces a line per test case with its result, grouped by feature, followed by the totals
+func (s *RunSummary) PrettyPrint(indent string) string {
+	var lines []string
+	for i, result := range s.Results {
+		if i == 0 || result.Name != s.Results[i-1].Name {
+			labels := make([]string, len(result.Labels))
+			for j, label := range result.Labels {
+				labels[j] = label.Key + "=" + label.Value
+			}
+			lines = append(lines, strings.TrimRight(fmt.Sprintf("%sfeature %s %s", indent, result.Name, strings.Join(labels, ",")), " "))
+		}
+		status := "passed"
+		if !result.Result {
+			status = fmt.Sprintf("failed, wrong %d", result.WrongNum)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s: %s", indent, result.TestCase, status))
+	}
+	lines = append(lines, fmt.Sprintf("%stest cases: %d, passed: %d, failed: %d", indent, len(s.Results), s.Passed, s.Failed))
+	return strings.Join(lines, "\n")
+}
+
+// collectResult adds the result of the validated test case to MatrixResults, for the feature of opts
+func collectResult(opts *ProbeOptions, testCase *TestCase, wrong int) {
+	collect(opts, testCase.Name(), testCase.ServiceType, testCase.Protocol, wrong, testCase.Reachability)
+}
+
+// collect adds a result to MatrixResults, for the feature of opts, with the matrix encoded in JSON
+func collect(opts *ProbeOptions, name, serviceType string, protocol v1.Protocol, wrong int, matrix interface{}) {
+	encoded, err := json.Marshal(matrix)
+	if err != nil {
+		zap.L().Error("Unable to encode the matrix of the result.", zap.String("test", name), zap.Error(err))
+	}
+	MatrixResults.Collect(&Result{
+		Name:        opts.Feature,
+		Labels:      opts.Labels,
+		TestCase:    name,
+		ServiceType: serviceType,
+		Protocol:    protocol,
+		Result:      wrong == 0,
+		WrongNum:    wrong,
+		Matrix:      encoded,
+	})
+}
+
+// FailurePattern is a shape of the wrong pairs of a comparison, hinting at the broken component
+type FailurePattern string
+
+const (
+	// PatternWholeMatrix is every pair wrong, the service itself is broken
+	PatternWholeMatrix FailurePattern = "whole-matrix"
+	// PatternRow is every pair from a source wrong, the proxy of the source node
+	PatternRow FailurePattern = "row"
+	// PatternColumn is every pair to a target wrong, the target endpoint or node
+	PatternColumn FailurePattern = "column"
+	// PatternCrossNode is wrong pairs only between pods of different nodes, the traffic between the nodes
+	PatternCrossNode FailurePattern = "cross-node"
+	// PatternSameNode is wrong pairs only between pods of the same node, the hairpin or local traffic
+	PatternSameNode FailurePattern = "same-node"
+	// PatternScattered is wrong pairs without any of the other patterns
+	PatternScattered FailurePattern = "scattered"
+)
+
+// Finding is a failure pattern found in a comparison, with the hypothesis it supports
+type Finding struct {
+	Pattern FailurePattern
+	// Node is the node of the rows or columns of the finding, empty if they are not all on the node
+	Node string
+	// Pods are the sources of the rows or the targets of the columns of the finding
+	Pods []string
+	// Pairs is the number of wrong pairs of the finding
+	Pairs      int
+	Hypothesis string
+}
+
+// Analysis are the findings explaining the wrong pairs of a comparison
+type Analysis struct {
+	Wrong    int
+	Total    int
+	Findings []*Finding
+}
+
+// nodeOfPod returns the node of a pod string
+func nodeOfPod(podString string) string {
+	return strings.SplitN(podString, "/", 2)[0]
+}
+
+// AnalyzeComparison classifies the wrong pairs of a comparison of the expected and observed tables as whole
+// rows and columns, grouped by node, then the pairs left as cross-node only, same-node only or scattered.
+func AnalyzeComparison(comparison *TruthTable, ignoreLoopback bool) *Analysis {
+	analysis := &Analysis{}
+	considered := func(from, to string) bool {
+		_, ok := comparison.Values[from][to]
+		return ok && !(ignoreLoopback && from == to)
+	}
+	wrong := map[Pair]bool{}
+	rowTotals, rowWrongs, colTotals, colWrongs := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	for _, from := range comparison.Froms {
+		for _, to := range comparison.Tos {
+			if !considered(from, to) {
+				continue
+			}
+			analysis.Total++
+			rowTotals[from]++
+			colTotals[to]++
+			if !comparison.Values[from][to] {
+				wrong[Pair{From: from, To: to}] = true
+				rowWrongs[from]++
+				colWrongs[to]++
+			}
+		}
+	}
+	analysis.Wrong = len(wrong)
+	if analysis.Wrong == 0 {
+		return analysis
+	}
+	if analysis.Wrong == analysis.Total && analysis.Total > 1 {
+		analysis.Findings = append(analysis.Findings, &Finding{
+			Pattern: PatternWholeMatrix, Pairs: analysis.Wrong,
+			Hypothesis: "every probe fails: the service itself is broken, e.g. no endpoints or no proxy programming it on any node",
+		})
+		return analysis
+	}
+
+	// a whole row or column needs more than a cell, a single wrong cell tells nothing about its source or target
+	fullRows := map[string]bool{}
+	for _, from := range comparison.Froms {
+		if rowTotals[from] > 1 && rowWrongs[from] == rowTotals[from] {
+			fullRows[from] = true
+		}
+	}
+	fullCols := map[string]bool{}
+	for _, to := range comparison.Tos {
+		if colTotals[to] > 1 && colWrongs[to] == colTotals[to] {
+			fullCols[to] = true
+		}
+	}
+	analysis.Findings = append(analysis.Findings, lineFindings(PatternRow, comparison.Froms, fullRows, rowWrongs)...)
+	analysis.Findings = append(analysis.Findings, lineFindings(PatternColumn, comparison.Tos, fullCols, colWrongs)...)
+
+	var crossNode, sameNode int
+	for pair := range wrong {
+		if fullRows[pair.From] || fullCols[pair.To] {
+			continue
+		}
+		if nodeOfPod(pair.From) == nodeOfPod(pair.To) {
+			sameNode++
+		} else {
+			crossNode++
+		}
+	}
+	residual := crossNode + sameNode
+	switch {
+	case residual == 0:
+	case residual > 1 && sameNode == 0:
+		analysis.Findings = append(analysis.Findings, &Finding{
+			Pattern: PatternCrossNode, Pairs: residual,
+			Hypothesis: fmt.Sprintf("%d probes between pods of different nodes fail, none on the same node: "+
+				"the traffic between the nodes, e.g. the overlay, the routes or the SNAT of the proxies", residual),
+		})
+	case residual > 1 && crossNode == 0:
+		analysis.Findings = append(analysis.Findings, &Finding{
+			Pattern: PatternSameNode, Pairs: residual,
+			Hypothesis: fmt.Sprintf("%d probes between pods of the same node fail, none across nodes: "+
+				"the local or hairpin traffic, e.g. the hairpin mode of the bridge", residual),
+		})
+	default:
+		analysis.Findings = append(analysis.Findings, &Finding{
+			Pattern: PatternScattered, Pairs: residual,
+			Hypothesis: fmt.Sprintf("%d probes fail without a pattern: flaky probes or dataplane, "+
+				"e.g. conntrack races, probe them again with -probe-samples", residual),
+		})
+	}
+	return analysis
+}
+
+// lineFindings returns a finding per node of the full rows or columns, naming the node when all its pods of
+// the lines are full
+func lineFindings(pattern FailurePattern, lines []string, full map[string]bool, wrongs map[string]int) []*Finding {
+	var nodes []string
+	byNode := map[string][]string{}
+	for _, line := range lines {
+		node := nodeOfPod(line)
+		if _, ok := byNode[node]; !ok {
+			nodes = append(nodes, node)
+		}
+		byNode[node] = append(byNode[node], line)
+	}
+
+	var findings []*Finding
+	for _, node := range nodes {
+		finding := &Finding{Pattern: pattern, Node: node}
+		for _, line := range byNode[node] {
+			if full[line] {
+				finding.Pods = append(finding.Pods, line)
+				finding.Pairs += wrongs[line]
+			}
+		}
+		if len(finding.Pods) == 0 {
+			continue
+		}
+		if len(finding.Pods) < len(byNode[node]) {
+			finding.Node = ""
+		}
+		finding.Hypothesis = lineHypothesis(pattern, finding)
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func lineHypothesis(pattern FailurePattern, finding *Finding) string {
+	pods := strings.Join(finding.Pods, ", ")
+	switch {
+	case pattern == PatternRow && finding.Node != "":
+		return fmt.Sprintf("every probe from node %s fails (%s): the proxy of the source node, "+
+			"e.g. its rules not programmed or the proxy down on %s", finding.Node, pods, finding.Node)
+	case pattern == PatternRow:
+		return fmt.Sprintf("every probe from %s fails, not from the other pods of its node: the source pod, "+
+			"e.g. its network namespace or DNS configuration", pods)
+	case finding.Node != "":
+		return fmt.Sprintf("every probe to node %s fails (%s): the target node or its endpoints, "+
+			"e.g. the node unreachable or its pods not ready", finding.Node, pods)
+	}
+	return fmt.Sprintf("every probe to %s fails, not to the other pods of its node: the target endpoint, "+
+		"e.g. the pod not serving or missing from the endpoints", pods)
+}
+
+// PrettyPrint produces a line per finding, most wrong pairs first
+func (a *Analysis) PrettyPrint(indent string) string {
+	findings := append([]*Finding{}, a.Findings...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Pairs > findings[j].Pairs })
+	lines := []string{fmt.Sprintf("%s%d wrong pairs out of %d", indent, a.Wrong, a.Total)}
+	for _, finding := range findings {
+		lines = append(lines, fmt.Sprintf("%s- [%s] %s", indent, finding.Pattern, finding.Hypothesis))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printAnalysis logs the hypotheses explaining the wrong pairs of the reachability of the test case
+func printAnalysis(testCase *TestCase, ignoreLoopback bool) {
+	r := testCase.Reachability
+	analysis := AnalyzeComparison(r.Expected.Compare(r.Observed), ignoreLoopback)
+	if analysis.Wrong == 0 {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("failure analysis of %s:\n\n%s\n\n\n", testCase.Name(), analysis.PrettyPrint("")))
+}
@@ -0,0 +1,128 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+// newComparison returns a comparison of pods a and b on node-1 and c and d on node-2, right but for the wrong pairs
+func newComparison(wrong ...Pair) *TruthTable {
+	right := true
+	comparison := NewTruthTableFromItems([]string{"node-1/ns/a", "node-1/ns/b", "node-2/ns/c", "node-2/ns/d"}, &right)
+	for _, pair := range wrong {
+		comparison.Set(pair.From, pair.To, false)
+	}
+	return comparison
+}
+
+var _ = Describe("failure analyzer", func() {
+	It("should find no pattern without wrong pairs", func() {
+		analysis := AnalyzeComparison(newComparison(), false)
+		Expect(analysis.Wrong).To(BeZero())
+		Expect(analysis.Total).To(Equal(16))
+		Expect(analysis.Findings).To(BeEmpty())
+	})
+
+	It("should localize the whole rows of a node to the proxy of the source node", func() {
+		model := newFakeModel()
+		testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.ClusterIP, Reachability: NewReachability(model.AllPods(), true)}
+		prober := NewFakeProber(&FakeRule{From: &Peer{Pod: "pod-1"}, Connected: false, Outcome: OutcomeTimeout}, &FakeRule{Connected: true})
+		ProbePodToPodConnectivity(context.Background(), prober, model, testCase, DefaultProbeOptions())
+
+		r := testCase.Reachability
+		analysis := AnalyzeComparison(r.Expected.Compare(r.Observed), false)
+		Expect(analysis.Wrong).To(Equal(3))
+		Expect(analysis.Findings).To(HaveLen(1))
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternRow))
+		Expect(analysis.Findings[0].Node).To(Equal("node-1"))
+		Expect(analysis.Findings[0].Hypothesis).To(ContainSubstring("the proxy of the source node"))
+	})
+
+	It("should localize a whole column to its target pod when the other pods of its node are reachable", func() {
+		analysis := AnalyzeComparison(newComparison(
+			Pair{"node-1/ns/a", "node-2/ns/d"}, Pair{"node-1/ns/b", "node-2/ns/d"},
+			Pair{"node-2/ns/c", "node-2/ns/d"}, Pair{"node-2/ns/d", "node-2/ns/d"},
+		), false)
+		Expect(analysis.Findings).To(HaveLen(1))
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternColumn))
+		Expect(analysis.Findings[0].Node).To(BeEmpty())
+		Expect(analysis.Findings[0].Pods).To(Equal([]string{"node-2/ns/d"}))
+		Expect(analysis.Findings[0].Pairs).To(Equal(4))
+	})
+
+	It("should tell the cross-node failures from the same-node and the scattered ones", func() {
+		analysis := AnalyzeComparison(newComparison(Pair{"node-1/ns/a", "node-2/ns/c"}, Pair{"node-2/ns/d", "node-1/ns/b"}), false)
+		Expect(analysis.Findings).To(HaveLen(1))
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternCrossNode))
+
+		analysis = AnalyzeComparison(newComparison(Pair{"node-1/ns/a", "node-1/ns/b"}, Pair{"node-2/ns/d", "node-2/ns/c"}), false)
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternSameNode))
+
+		analysis = AnalyzeComparison(newComparison(Pair{"node-1/ns/a", "node-1/ns/b"}, Pair{"node-2/ns/d", "node-1/ns/a"}), false)
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternScattered))
+		Expect(analysis.PrettyPrint("")).To(HavePrefix("2 wrong pairs out of 16\n- [scattered] 2 probes fail"))
+	})
+
+	It("should not count the loopback pairs when ignored", func() {
+		loopbacks := []Pair{{"node-1/ns/a", "node-1/ns/a"}, {"node-1/ns/b", "node-1/ns/b"}, {"node-2/ns/c", "node-2/ns/c"}}
+		analysis := AnalyzeComparison(newComparison(loopbacks...), false)
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternSameNode))
+
+		analysis = AnalyzeComparison(newComparison(loopbacks...), true)
+		Expect(analysis.Wrong).To(BeZero())
+		Expect(analysis.Total).To(Equal(12))
+	})
+
+	It("should blame the service when every pair is wrong", func() {
+		var all []Pair
+		for _, from := range []string{"node-1/ns/a", "node-1/ns/b", "node-2/ns/c", "node-2/ns/d"} {
+			for _, to := range []string{"node-1/ns/a", "node-1/ns/b", "node-2/ns/c", "node-2/ns/d"} {
+				all = append(all, Pair{From: from, To: to})
+			}
+		}
+		analysis := AnalyzeComparison(newComparison(all...), false)
+		Expect(analysis.Findings).To(HaveLen(1))
+		Expect(analysis.Findings[0].Pattern).To(Equal(PatternWholeMatrix))
+	})
+})
+
+var _ = Describe("run summary", func() {
+	BeforeEach(func() {
+		MatrixResults = &Results{}
+	})
+
+	It("should collect a result per validated test case with its feature and matrix", func() {
+		model := newFakeModel()
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-3"}, ServiceType: entities.ClusterIP, Connected: false, Outcome: OutcomeRefused}, &FakeRule{Connected: true})
+		opts := DefaultProbeOptions()
+		opts.Retries = -1
+		opts.Feature, opts.Labels = "ClusterIP", NewLabels(map[string]string{"type": "cluster_ip"})
+		for _, serviceType := range []string{entities.ClusterIP, entities.NodePort} {
+			testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: serviceType, Reachability: NewReachability(model.AllPods(), true)}
+			ValidateOrFail(context.Background(), prober, model, testCase, opts)
+			opts.Feature, opts.Labels = "NodePort", nil
+		}
+
+		summary := MatrixResults.Summary()
+		Expect(summary.Passed).To(Equal(1))
+		Expect(summary.Failed).To(Equal(1))
+		Expect(summary.PrettyPrint("")).To(Equal("feature ClusterIP type=cluster_ip\n  clusteip-tcp-80: failed, wrong 3\n" +
+			"feature NodePort\n  nodeport-tcp-80: passed\ntest cases: 2, passed: 1, failed: 1"))
+
+		data, err := summary.Encode(ResultsFormatJSON)
+		Expect(err).NotTo(HaveOccurred())
+		var decoded RunSummary
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(decoded.Results).To(HaveLen(2))
+		Expect(decoded.Results[0].Labels).To(Equal([]Label{{Key: "type", Value: "cluster_ip"}}))
+		var reachability Reachability
+		Expect(json.Unmarshal(decoded.Results[0].Matrix, &reachability)).To(Succeed())
+		Expect(reachability.Observed.Values[model.AllPods()[0].PodString().String()][model.AllPods()[2].PodString().String()]).To(BeFalse())
+	})
+})
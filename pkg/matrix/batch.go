@@ -0,0 +1,106 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/commands"
+)
+
+// batchExecMargin is added to the longest timeout of the jobs of a batch to bound its exec, covering the round
+// trip of the exec
+var batchExecMargin = 10 * time.Second
+
+// ExecBatchProber probes the jobs of a source pod with a single exec, running the client commands of all the
+// jobs in a shell of the source pod, so a matrix costs an exec per source pod instead of one per pair.
+// The jobs other than connections, e.g. bandwidth or HTTP, are probed by the manager one exec at a time.
+type ExecBatchProber struct {
+	*KubeManager
+}
+
+// NewExecBatchProber returns an ExecBatchProber executing the batches with the executor of the manager
+func NewExecBatchProber(k *KubeManager) *ExecBatchProber {
+	return &ExecBatchProber{KubeManager: k}
+}
+
+// Batchable returns true if the job is a connection its client command supports
+func (b *ExecBatchProber) Batchable(job *ProbeJob) bool {
+	if job.Mode != ProbeModeConnect && job.Mode != ProbeModeReachTargetPod {
+		return false
+	}
+	return batchProbe(job).Client.ConnectCommand() != nil
+}
+
+// ProbeBatch runs the client commands of the jobs in the source pod and returns their results in the order of
+// the jobs. The exec is bounded by the longest timeout of the jobs plus batchExecMargin, the netcat tries of
+// each job fitting in its timeout, and the probes which answered before the exec ended keep their result.
+func (b *ExecBatchProber) ProbeBatch(ctx context.Context, jobs []*ProbeJob) []*ProbeJobResults {
+	podFrom := jobs[0].PodFrom
+	probes := make([]commands.BatchProbe, len(jobs))
+	var timeout time.Duration
+	for i, job := range jobs {
+		probes[i] = batchProbe(job)
+		if job.Timeout > timeout {
+			timeout = job.Timeout
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout+batchExecMargin)
+		defer cancel()
+	}
+
+	batch := commands.NewBatchClient(podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), probes)
+	zap.L().Debug("commandDebugString " + batch.DebugString())
+	stdout, stderr, err := batch.Execute(ctx, b.executor)
+	batchResults, parseErr := commands.ParseBatchOutput(stdout, len(jobs))
+
+	results := make([]*ProbeJobResults, len(jobs))
+	for i, job := range jobs {
+		result := &ProbeJobResults{Job: job, Command: probes[i].Client.DebugString()}
+		results[i] = result
+		switch {
+		case parseErr == nil && batchResults[i] != nil && batchResults[i].ExitCode != 0:
+			result.Stderr = batchResults[i].Output
+			result.Outcome = ParseOutcome(result.Stderr, utilexec.CodeExitError{
+				Err: errors.Errorf("command terminated with exit code %d", batchResults[i].ExitCode), Code: batchResults[i].ExitCode,
+			})
+		case parseErr == nil && batchResults[i] != nil:
+			result.IsConnected, result.Outcome = true, OutcomeConnected
+			if job.Mode == ProbeModeReachTargetPod {
+				result.Endpoint = batchResults[i].Output
+			}
+		case ctx.Err() != nil:
+			result.Err, result.Outcome = ctx.Err(), OutcomeCancelled
+		case err != nil:
+			result.Err, result.Stderr, result.Outcome = err, stderr, OutcomeExecError
+		case parseErr != nil:
+			result.Err, result.Outcome = parseErr, OutcomeExecError
+		default:
+			result.Err, result.Outcome = errors.Errorf("no result in the batch of %s", podFrom.PodString()), OutcomeExecError
+		}
+	}
+	return results
+}
+
+// batchProbe returns the client command of the job, netcat answering the hostname of the target or agnhost connect
+func batchProbe(job *ProbeJob) commands.BatchProbe {
+	podFrom, addrTo := job.PodFrom, job.Address()
+	containerFrom := podFrom.Containers[0].GetName()
+	if job.Mode == ProbeModeReachTargetPod {
+		return commands.BatchProbe{
+			Client: commands.NewNcClientWithWait(
+				podFrom.Namespace, podFrom.Name, containerFrom, addrTo, job.ToPort, job.Protocol, ncWait(job.Timeout, ncTries),
+			),
+			Tries: ncTries,
+		}
+	}
+	return commands.BatchProbe{
+		Client: commands.NewAgnHostClient(podFrom.Namespace, podFrom.Name, containerFrom, addrTo, job.ToPort, job.Protocol),
+		Tries:  1,
+	}
+}
@@ -0,0 +1,133 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+// batchScriptLine matches the client command and the index of each probe of a batch script
+var batchScriptLine = regexp.MustCompile(`out=\$\((.*) 2>&1\).*printf 'probe (\d+) `)
+
+// batchExecutor is a PodExecutor answering the batch scripts like the pods of the fake model, the connections
+// to pod-3 are refused, or hang until the exec is done
+type batchExecutor struct {
+	hang bool
+
+	mu       sync.Mutex
+	execs    int
+	commands [][]string
+}
+
+func (e *batchExecutor) Exec(ctx context.Context, options *ek.ExecOptions) (stdout, stderr string, err error) {
+	var (
+		out  strings.Builder
+		hung bool
+	)
+	for _, match := range batchScriptLine.FindAllStringSubmatch(options.Command[len(options.Command)-1], -1) {
+		command, index := strings.Fields(match[1]), match[2]
+		e.mu.Lock()
+		e.commands = append(e.commands, command)
+		e.mu.Unlock()
+		addrTo := command[len(command)-2]
+		switch {
+		case addrTo == "10.0.0.3" && e.hang:
+			hung = true
+		case addrTo == "10.0.0.3":
+			fmt.Fprintf(&out, "probe %s 1 nc: connect to 10.0.0.3 port 80 (tcp) failed: Connection refused\n", index)
+		case command[0] == "nc":
+			fmt.Fprintf(&out, "probe %s 0 pod-%s\n", index, addrTo[len(addrTo)-1:])
+		default:
+			fmt.Fprintf(&out, "probe %s 0 \n", index)
+		}
+	}
+	e.mu.Lock()
+	e.execs++
+	e.mu.Unlock()
+	if hung {
+		<-ctx.Done()
+		return out.String(), "", ctx.Err()
+	}
+	return out.String(), "", nil
+}
+
+var _ = Describe("exec batch prober", func() {
+	var (
+		ctx   context.Context
+		model *Model
+		pods  []*entities.Pod
+		opts  *ProbeOptions
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = newFakeModel()
+		pods = model.AllPods()
+		opts = DefaultProbeOptions()
+		opts.Mode = ProbeModeReachTargetPod
+	})
+
+	newTestCase := func() *TestCase {
+		reachability := NewReachability(pods, true)
+		reachability.ExpectPeer(&Peer{}, &Peer{Pod: "pod-3"}, false)
+		return &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP, Reachability: reachability}
+	}
+
+	It("should probe a row of the matrix per exec", func() {
+		executor := &batchExecutor{}
+		prober := NewExecBatchProber(NewKubeManagerWithExecutor(fake.NewSimpleClientset(), executor))
+		testCase := newTestCase()
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+		Expect(executor.execs).To(Equal(3))
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[0].PodString().String(), pods[2].PodString().String())).To(Equal(OutcomeRefused))
+	})
+
+	It("should report the exec failures of a batch on all its probes", func() {
+		executor := &stubExecutor{err: errors.New("container not found")}
+		prober := NewExecBatchProber(NewKubeManagerWithExecutor(fake.NewSimpleClientset(), executor))
+		opts.Retries = -1
+		testCase := newTestCase()
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(Equal(6))
+		Expect(executor.commands).To(HaveLen(3))
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[0].PodString().String(), pods[1].PodString().String())).To(Equal(OutcomeExecError))
+
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[0], PodTo: pods[1], Protocol: v1.ProtocolSCTP, Mode: ProbeModeReachTargetPod})).To(BeTrue())
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[0], PodTo: pods[1], Protocol: v1.Protocol("QUIC"), Mode: ProbeModeReachTargetPod})).To(BeFalse())
+		Expect(prober.Batchable(&ProbeJob{PodFrom: pods[0], PodTo: pods[1], Protocol: v1.ProtocolTCP, Mode: ProbeModeHTTP})).To(BeFalse())
+	})
+
+	It("should keep the results of the probes answering before a hanging probe", func() {
+		margin := batchExecMargin
+		batchExecMargin = 0
+		defer func() { batchExecMargin = margin }()
+		executor := &batchExecutor{hang: true}
+		prober := NewExecBatchProber(NewKubeManagerWithExecutor(fake.NewSimpleClientset(), executor))
+		jobs := make([]*ProbeJob, len(pods))
+		for i, pod := range pods {
+			jobs[i] = &ProbeJob{
+				PodFrom: pods[0], PodTo: pod, ToPort: 80, Protocol: v1.ProtocolTCP,
+				ServiceType: entities.PodIP, Mode: ProbeModeReachTargetPod, Timeout: 50 * time.Millisecond,
+			}
+		}
+		results := prober.ProbeBatch(ctx, jobs)
+		Expect(results[0].IsConnected).To(BeTrue())
+		Expect(results[0].Endpoint).To(Equal("pod-1"))
+		Expect(results[1].IsConnected).To(BeTrue())
+		Expect(results[2].IsConnected).To(BeFalse())
+		Expect(results[2].Outcome).To(Equal(OutcomeCancelled))
+		// the netcat tries of each probe fit in its timeout
+		Expect(executor.commands[0]).To(ContainElement("-w1"))
+	})
+})
@@ -0,0 +1,222 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+)
+
+// PortProtocol is a slice of the port/protocol cube, the matrix of the pods on a port and protocol
+type PortProtocol struct {
+	Port     int
+	Protocol v1.Protocol
+}
+
+// String returns the port/protocol of the slice, e.g. 80/TCP
+func (pp PortProtocol) String() string {
+	return fmt.Sprintf("%d/%s", pp.Port, pp.Protocol)
+}
+
+// CubeTestCase probes the pods on several ports and protocols in a single pass, every slice of the cube is
+// a test case of its own. The slices are probed on their port, so the cube fits the service types reached
+// on the container ports: pod IP, ClusterIP, headless and ExternalName.
+type CubeTestCase struct {
+	Slices    []PortProtocol
+	TestCases map[PortProtocol]*TestCase
+}
+
+// NewCubeTestCase returns a cube over all the ports and protocols of the model, with every pair of every
+// slice expected to defaultExpectation
+func NewCubeTestCase(model *Model, serviceType string, defaultExpectation bool) *CubeTestCase {
+	ports, protocols := model.AllPortsProtocol()
+	cube := &CubeTestCase{TestCases: map[PortProtocol]*TestCase{}}
+	for _, port := range ports {
+		for _, protocol := range protocols {
+			slice := PortProtocol{Port: int(port), Protocol: protocol}
+			cube.Slices = append(cube.Slices, slice)
+			cube.TestCases[slice] = &TestCase{
+				ToPort:       slice.Port,
+				Protocol:     protocol,
+				ServiceType:  serviceType,
+				Reachability: NewReachability(model.AllPods(), defaultExpectation),
+			}
+		}
+	}
+	return cube
+}
+
+// SetProbeTimeout sets the timeout of each probe of every slice
+func (c *CubeTestCase) SetProbeTimeout(timeout time.Duration) {
+	for _, testCase := range c.TestCases {
+		testCase.ProbeTimeout = timeout
+	}
+}
+
+// SetDeadline sets the deadline of the probing of the whole cube
+func (c *CubeTestCase) SetDeadline(deadline time.Duration) {
+	for _, testCase := range c.TestCases {
+		testCase.Deadline = deadline
+	}
+}
+
+// ExpectPeer sets the expected connectivity of the pairs matching from and to on every slice
+func (c *CubeTestCase) ExpectPeer(from, to *Peer, connected bool) {
+	for _, testCase := range c.TestCases {
+		testCase.Reachability.ExpectPeer(from, to, connected)
+	}
+}
+
+// testCases returns the test cases of the slices, in order
+func (c *CubeTestCase) testCases(slices []PortProtocol) []*TestCase {
+	testCases := make([]*TestCase, len(slices))
+	for i, slice := range slices {
+		testCases[i] = c.TestCases[slice]
+	}
+	return testCases
+}
+
+// WrongSlices returns the slices with wrong results
+func (c *CubeTestCase) WrongSlices(ignoreLoopback, measureBandWidth bool) []PortProtocol {
+	var wrongSlices []PortProtocol
+	for _, slice := range c.Slices {
+		if _, wrong, _, _ := c.TestCases[slice].Reachability.Summary(ignoreLoopback, measureBandWidth); wrong > 0 {
+			wrongSlices = append(wrongSlices, slice)
+		}
+	}
+	return wrongSlices
+}
+
+// Summary returns the number of right and wrong results over all the slices
+func (c *CubeTestCase) Summary(ignoreLoopback, measureBandWidth bool) (right, wrong int) {
+	for _, slice := range c.Slices {
+		sliceRight, sliceWrong, _, _ := c.TestCases[slice].Reachability.Summary(ignoreLoopback, measureBandWidth)
+		right += sliceRight
+		wrong += sliceWrong
+	}
+	return right, wrong
+}
+
+// DifferingSlices returns the slices whose observed matrix differs from the one observed on most slices,
+// e.g. a protocol broken on every port, or a single port not served
+func (c *CubeTestCase) DifferingSlices() []PortProtocol {
+	signatures := make(map[PortProtocol]string, len(c.Slices))
+	counts := map[string]int{}
+	var majority string
+	for _, slice := range c.Slices {
+		signature := c.TestCases[slice].Reachability.Observed.signature()
+		signatures[slice] = signature
+		counts[signature]++
+		// ties are broken by the first slice
+		if counts[signature] > counts[majority] {
+			majority = signature
+		}
+	}
+
+	var differing []PortProtocol
+	for _, slice := range c.Slices {
+		if signatures[slice] != majority {
+			differing = append(differing, slice)
+		}
+	}
+	return differing
+}
+
+// PrettyPrint produces a summary line per slice, flagging the slices differing from the others, and a combined
+// matrix with a mark per slice in each cell, in the order of the slices.
+func (c *CubeTestCase) PrettyPrint(indent string, ignoreLoopback bool) string {
+	differing := map[PortProtocol]bool{}
+	for _, slice := range c.DifferingSlices() {
+		differing[slice] = true
+	}
+
+	lines := []string{indent + strings.Join([]string{"slice\t", "correct", "wrong", "differs", "failed probes"}, "\t")}
+	for _, slice := range c.Slices {
+		reachability := c.TestCases[slice].Reachability
+		right, wrong, _, _ := reachability.Summary(ignoreLoopback, false)
+		mark := ""
+		if differing[slice] {
+			mark = "*"
+		}
+		lines = append(lines, indent+strings.Join([]string{
+			slice.String() + "\t", fmt.Sprintf("%d", right), fmt.Sprintf("%d", wrong), mark, formatFailedOutcomes(reachability.Observed.CountOutcomes()),
+		}, "\t"))
+	}
+
+	if len(c.Slices) == 0 {
+		return strings.Join(lines, "\n")
+	}
+	names := make([]string, len(c.Slices))
+	for i, slice := range c.Slices {
+		names[i] = slice.String()
+	}
+	observed := c.TestCases[c.Slices[0]].Reachability.Observed
+	lines = append(lines, "", indent+"slices: "+strings.Join(names, ", "), indent+strings.Join(append([]string{"-\t"}, observed.Tos...), "\t"))
+	for _, from := range observed.Froms {
+		line := []string{from}
+		for _, to := range observed.Tos {
+			marks := ""
+			for _, slice := range c.Slices {
+				marks += c.TestCases[slice].Reachability.Observed.Glyph(from, to)
+			}
+			line = append(line, marks+"\t")
+		}
+		lines = append(lines, indent+strings.Join(line, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ProbeCube probes the pods on every slice of the cube in a single run of the worker pool
+func ProbeCube(ctx context.Context, prober Prober, model *Model, cube *CubeTestCase, opts *ProbeOptions) {
+	probeTestCases(ctx, prober, model, cube.testCases(cube.Slices), nil, opts)
+}
+
+// ValidateCubeOrFail validates the connectivity of every slice of the cube, probing the wrong pairs of the slices
+// again on retries, prints the combined report and returns the number of wrong results over all the slices.
+func ValidateCubeOrFail(ctx context.Context, prober Prober, model *Model, cube *CubeTestCase, opts *ProbeOptions) int {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	measureBandWidth := opts.GetMode() == ProbeModeBandwidth
+
+	// 1st try
+	zap.L().Info("Validating port/protocol cube, first try.", zap.Int("slices", len(cube.Slices)))
+	start := time.Now()
+	ProbeCube(ctx, prober, model, cube, opts)
+
+	// next tries, only on the wrong pairs of the slices, as configured by the retry policy
+	testCases := cube.testCases(cube.Slices)
+	retryWrongPairs(ctx, prober, model, testCases, opts, start)
+
+	var wrongTestCases []*TestCase
+	for _, slice := range cube.WrongSlices(opts.IgnoreLoopback, measureBandWidth) {
+		zap.L().Info("Had wrong results in slice", zap.String("slice", slice.String()))
+		cube.TestCases[slice].Reachability.PrintSummary(logRenderer(opts.Renderer), true, true, true, measureBandWidth)
+		printAnalysis(cube.TestCases[slice], opts.IgnoreLoopback)
+		wrongTestCases = append(wrongTestCases, cube.TestCases[slice])
+	}
+	right, wrong := cube.Summary(opts.IgnoreLoopback, measureBandWidth)
+	zap.L().Info(fmt.Sprintf("Cube results (%t): correct: %v, incorrect: %v", wrong == 0, right, wrong))
+	reachabilities := make([]*Reachability, len(testCases))
+	for i, testCase := range testCases {
+		reachabilities[i] = testCase.Reachability
+	}
+	if retries := formatRetries(reachabilities, opts.IgnoreLoopback, measureBandWidth); retries != "" {
+		zap.L().Warn(retries)
+	}
+	zap.L().Info(fmt.Sprintf("port/protocol cube (%s):\n\n%s\n\n\n", OutcomesLegend(), cube.PrettyPrint("", opts.IgnoreLoopback)))
+	writeResults(opts, testCases...)
+	writeRenders(opts, measureBandWidth, wrongTestCases...)
+	for _, testCase := range testCases {
+		_, sliceWrong, _, _ := testCase.Reachability.Summary(opts.IgnoreLoopback, measureBandWidth)
+		collectResult(opts, testCase, sliceWrong)
+	}
+
+	if wrong == 0 {
+		zap.L().Info("Tests passed, validation succeeded!")
+	}
+	return wrong
+}
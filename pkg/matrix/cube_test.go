@@ -0,0 +1,63 @@
+package matrix
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("port/protocol cube", func() {
+	var (
+		ctx   context.Context
+		model *Model
+		pods  []*entities.Pod
+		opts  *ProbeOptions
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = NewModel([]string{"ns-1"}, []string{"pod-1", "pod-2"}, []int32{80, 81}, []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}, "cluster.local")
+		pods = model.AllPods()
+		for i, pod := range pods {
+			pod.SetNodeName([]string{"node-1", "node-2"}[i])
+		}
+		opts = DefaultProbeOptions()
+	})
+
+	It("should have a slice per port and protocol of the model", func() {
+		cube := NewCubeTestCase(model, entities.PodIP, true)
+		Expect(cube.Slices).To(ConsistOf(
+			PortProtocol{80, v1.ProtocolTCP}, PortProtocol{80, v1.ProtocolUDP},
+			PortProtocol{81, v1.ProtocolTCP}, PortProtocol{81, v1.ProtocolUDP},
+		))
+		Expect(cube.Slices[0].String()).To(MatchRegexp(`^8[01]/(TCP|UDP)$`))
+	})
+
+	It("should probe every slice in a single pass", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true})
+		Expect(ValidateCubeOrFail(ctx, prober, model, NewCubeTestCase(model, entities.PodIP, true), opts)).To(BeZero())
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(4))
+	})
+
+	It("should flag the slices differing from the others", func() {
+		prober := NewFakeProber(
+			&FakeRule{Port: 81, Protocol: v1.ProtocolUDP, Outcome: OutcomeTimeout},
+			&FakeRule{Connected: true},
+		)
+		opts.Retries = 1
+		cube := NewCubeTestCase(model, entities.PodIP, true)
+		Expect(ValidateCubeOrFail(ctx, prober, model, cube, opts)).To(Equal(4))
+		Expect(cube.WrongSlices(false, false)).To(Equal([]PortProtocol{{81, v1.ProtocolUDP}}))
+		Expect(cube.DifferingSlices()).To(Equal([]PortProtocol{{81, v1.ProtocolUDP}}))
+		// the retry only probes the wrong slice
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(5))
+
+		report := cube.PrettyPrint("", false)
+		Expect(report).To(MatchRegexp(`81/UDP\t\t0\t4\t\*\ttimeout: 4`))
+		Expect(report).To(ContainSubstring("80/TCP\t\t4\t0\t\t"))
+	})
+})
@@ -0,0 +1,58 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+// DefaultDataplanePollInterval is the wait between two probes of the wrong pairs while waiting for the dataplane
+const DefaultDataplanePollInterval = 2 * time.Second
+
+// WaitUntilDataplaneReflects probes the matrix of the test case until its observations match the expectation,
+// e.g. until the proxies programmed the rules of new services, instead of sleeping a fixed delay. The wrong pairs
+// are probed again every opts.RetryBackoff, DefaultDataplanePollInterval if zero, the right ones are not probed
+// again. A *kubernetes.TimeoutError is returned if the dataplane did not reflect the expectation within timeout.
+func WaitUntilDataplaneReflects(ctx context.Context, prober Prober, model *Model, testCase *TestCase, opts *ProbeOptions, timeout time.Duration) error {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	interval := opts.RetryBackoff
+	if interval <= 0 {
+		interval = DefaultDataplanePollInterval
+	}
+	measureBandWidth := opts.GetMode() == ProbeModeBandwidth
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ProbePodToPodConnectivity(waitCtx, prober, model, testCase, opts)
+	for {
+		wrongPairs := testCase.Reachability.WrongPairs(opts.IgnoreLoopback, measureBandWidth)
+		if len(wrongPairs) == 0 {
+			return nil
+		}
+		zap.L().Debug("Waiting for the dataplane.", zap.Int("wrong", len(wrongPairs)), zap.String("service", testCase.ServiceType))
+
+		select {
+		case <-time.After(interval):
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return &ek.TimeoutError{
+				Kind: "dataplane", Name: testCase.ServiceType, Timeout: timeout,
+				Condition: fmt.Sprintf("the matrix to match the expectation, %d wrong pairs", len(wrongPairs)),
+			}
+		}
+
+		pairs := make(map[Pair]bool, len(wrongPairs))
+		for _, pair := range wrongPairs {
+			pairs[pair] = true
+		}
+		probeTestCases(waitCtx, prober, model, []*TestCase{testCase}, map[*TestCase]map[Pair]bool{testCase: pairs}, opts)
+	}
+}
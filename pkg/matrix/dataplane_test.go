@@ -0,0 +1,48 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+var _ = Describe("waiting for the dataplane", func() {
+	var (
+		ctx   context.Context
+		model *Model
+		pods  []*entities.Pod
+		opts  *ProbeOptions
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = newFakeModel()
+		pods = model.AllPods()
+		opts = DefaultProbeOptions()
+		opts.RetryBackoff = 10 * time.Millisecond
+	})
+
+	newTestCase := func() *TestCase {
+		return &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.NodePort, Reachability: NewReachability(pods, true)}
+	}
+
+	It("should poll the wrong pairs until the dataplane is programmed", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: true, Failures: 2}, &FakeRule{Connected: true})
+		Expect(WaitUntilDataplaneReflects(ctx, prober, model, newTestCase(), opts, time.Second)).To(Succeed())
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(3))
+		Expect(prober.Calls(pods[0].PodString(), pods[2].PodString())).To(Equal(1))
+	})
+
+	It("should return a timeout error when the dataplane is never programmed", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: false}, &FakeRule{Connected: true})
+		err := WaitUntilDataplaneReflects(ctx, prober, model, newTestCase(), opts, 100*time.Millisecond)
+		Expect(ek.IsTimeout(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("3 wrong pairs"))
+	})
+})
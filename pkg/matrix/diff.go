@@ -0,0 +1,288 @@
+package matrix
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ResultKey identifies the results of a test case across runs, by its feature, i.e. the directory of its file
+// relative to the results directory, and its name, suffixed with its occurrence if the feature validated
+// several test cases of the same name, e.g. "clusteip-tcp-80#2"
+type ResultKey struct {
+	Feature  string
+	TestCase string
+}
+
+// String returns the key as feature/test case
+func (k ResultKey) String() string {
+	if k.Feature == "" {
+		return k.TestCase
+	}
+	return k.Feature + "/" + k.TestCase
+}
+
+// ResultSet are the results of the test cases of a run
+type ResultSet map[ResultKey]*TestCaseResults
+
+// LoadResultSet reads all the results written to dir and its sub directories, one per feature
+func LoadResultSet(dir string) (ResultSet, error) {
+	set := ResultSet{}
+	occurrences := map[ResultKey]int{}
+	// the files are walked in lexical order, i.e. in the order they were written in a directory
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+		results, err := ReadTestCaseResults(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load %s", path)
+		}
+		feature, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if feature == "." {
+			feature = ""
+		}
+		key := ResultKey{Feature: filepath.ToSlash(feature), TestCase: results.Name}
+		occurrences[key]++
+		if n := occurrences[key]; n > 1 {
+			key.TestCase = fmt.Sprintf("%s#%d", key.TestCase, n)
+		}
+		set[key] = results
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// podIdentity returns the node/pod name of a pod string, the same for the pods of two runs whatever the random
+// namespace of the runs
+func podIdentity(podString string) string {
+	parts := strings.Split(podString, "/")
+	if len(parts) != 3 {
+		return podString
+	}
+	return parts[0] + "/" + parts[2]
+}
+
+// CellChange classifies a pair of a test case between a baseline and a current run
+type CellChange string
+
+const (
+	// CellRegression is a pair right in the baseline and wrong in the current run
+	CellRegression CellChange = "regression"
+	// CellFix is a pair wrong in the baseline and right in the current run
+	CellFix CellChange = "fix"
+	// CellUnchangedFailure is a pair wrong in both runs
+	CellUnchangedFailure CellChange = "unchanged-failure"
+)
+
+// CellDiff is a pair whose observation is wrong in a run, by the identities of its pods
+type CellDiff struct {
+	From   string
+	To     string
+	Change CellChange
+	// Baseline and Current are the outcomes of the probes of the pair in each run
+	Baseline Outcome
+	Current  Outcome
+}
+
+// String returns the change of the pair and its outcomes, e.g. "regression node-1/a -> node-2/b: connected -> timeout"
+func (c *CellDiff) String() string {
+	return fmt.Sprintf("%s %s -> %s: %s -> %s", c.Change, c.From, c.To, outcomeOrUnknown(c.Baseline), outcomeOrUnknown(c.Current))
+}
+
+func outcomeOrUnknown(outcome Outcome) string {
+	if outcome == OutcomeUnknown {
+		return "unknown"
+	}
+	return string(outcome)
+}
+
+// TestCaseDiff is the comparison of a test case between a baseline and a current run
+type TestCaseDiff struct {
+	Key   ResultKey
+	Cells []*CellDiff
+	// Unmatched counts the pairs present in a single run, e.g. with more nodes in a cluster
+	Unmatched int
+}
+
+// Count returns the number of pairs with the change
+func (d *TestCaseDiff) Count(change CellChange) int {
+	count := 0
+	for _, cell := range d.Cells {
+		if cell.Change == change {
+			count++
+		}
+	}
+	return count
+}
+
+// ResultsDiff is the comparison of the test cases of a baseline and a current run
+type ResultsDiff struct {
+	TestCases []*TestCaseDiff
+	// OnlyBaseline and OnlyCurrent are the test cases found in a single run
+	OnlyBaseline []ResultKey
+	OnlyCurrent  []ResultKey
+}
+
+// cellObservation is the observation of a pair by its pod identities
+type cellObservation struct {
+	right   bool
+	outcome Outcome
+}
+
+// observationsByIdentity returns the observations of the pairs of the results, keyed by the identities of the pods
+func observationsByIdentity(results *TestCaseResults, ignoreLoopback bool) map[Pair]*cellObservation {
+	r := results.Reachability
+	comparison := r.Expected.Compare(r.Observed)
+	observations := map[Pair]*cellObservation{}
+	for _, from := range comparison.Froms {
+		for _, to := range comparison.Tos {
+			if ignoreLoopback && from == to {
+				continue
+			}
+			if _, observed := r.Observed.Values[from][to]; !observed {
+				continue
+			}
+			pair := Pair{From: podIdentity(from), To: podIdentity(to)}
+			observations[pair] = &cellObservation{right: comparison.Values[from][to], outcome: r.Observed.GetOutcome(from, to)}
+		}
+	}
+	return observations
+}
+
+// DiffTestCases compares the pairs of a test case between the baseline and the current results
+func DiffTestCases(key ResultKey, baseline, current *TestCaseResults, ignoreLoopback bool) *TestCaseDiff {
+	diff := &TestCaseDiff{Key: key}
+	before := observationsByIdentity(baseline, ignoreLoopback)
+	after := observationsByIdentity(current, ignoreLoopback)
+	for pair, observation := range after {
+		previous, ok := before[pair]
+		if !ok {
+			diff.Unmatched++
+			continue
+		}
+		var change CellChange
+		switch {
+		case previous.right && !observation.right:
+			change = CellRegression
+		case !previous.right && observation.right:
+			change = CellFix
+		case !previous.right && !observation.right:
+			change = CellUnchangedFailure
+		default:
+			continue
+		}
+		diff.Cells = append(diff.Cells, &CellDiff{
+			From: pair.From, To: pair.To, Change: change, Baseline: previous.outcome, Current: observation.outcome,
+		})
+	}
+	for pair := range before {
+		if _, ok := after[pair]; !ok {
+			diff.Unmatched++
+		}
+	}
+	sort.Slice(diff.Cells, func(i, j int) bool {
+		if diff.Cells[i].From != diff.Cells[j].From {
+			return diff.Cells[i].From < diff.Cells[j].From
+		}
+		return diff.Cells[i].To < diff.Cells[j].To
+	})
+	return diff
+}
+
+// DiffResultSets compares the test cases of the baseline and the current runs, matched by feature and name
+func DiffResultSets(baseline, current ResultSet, ignoreLoopback bool) *ResultsDiff {
+	diff := &ResultsDiff{}
+	for key, results := range current {
+		previous, ok := baseline[key]
+		if !ok {
+			diff.OnlyCurrent = append(diff.OnlyCurrent, key)
+			continue
+		}
+		diff.TestCases = append(diff.TestCases, DiffTestCases(key, previous, results, ignoreLoopback))
+	}
+	for key := range baseline {
+		if _, ok := current[key]; !ok {
+			diff.OnlyBaseline = append(diff.OnlyBaseline, key)
+		}
+	}
+	sort.Slice(diff.TestCases, func(i, j int) bool { return diff.TestCases[i].Key.less(diff.TestCases[j].Key) })
+	sortKeys(diff.OnlyBaseline)
+	sortKeys(diff.OnlyCurrent)
+	return diff
+}
+
+// less orders the keys by feature, then by test case
+func (k ResultKey) less(other ResultKey) bool {
+	if k.Feature != other.Feature {
+		return k.Feature < other.Feature
+	}
+	return k.TestCase < other.TestCase
+}
+
+func sortKeys(keys []ResultKey) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+}
+
+// Regressions returns the number of pairs right in the baseline and wrong in the current run
+func (d *ResultsDiff) Regressions() int {
+	count := 0
+	for _, testCase := range d.TestCases {
+		count += testCase.Count(CellRegression)
+	}
+	return count
+}
+
+// PrettyPrint produces a line per test case with its regressions, fixes and unchanged failures, followed by the
+// pairs changing, grouped by feature
+func (d *ResultsDiff) PrettyPrint(indent string) string {
+	var lines []string
+	feature := ""
+	for i, testCase := range d.TestCases {
+		if i == 0 || testCase.Key.Feature != feature {
+			feature = testCase.Key.Feature
+			name := feature
+			if name == "" {
+				name = "-"
+			}
+			lines = append(lines, fmt.Sprintf("%sfeature %s", indent, name))
+		}
+		line := fmt.Sprintf("%s  %s: regressions %d, fixes %d, unchanged failures %d", indent, testCase.Key.TestCase,
+			testCase.Count(CellRegression), testCase.Count(CellFix), testCase.Count(CellUnchangedFailure))
+		if testCase.Unmatched > 0 {
+			line += fmt.Sprintf(", unmatched pairs %d", testCase.Unmatched)
+		}
+		lines = append(lines, line)
+		for _, cell := range testCase.Cells {
+			if cell.Change != CellUnchangedFailure {
+				lines = append(lines, fmt.Sprintf("%s    %s", indent, cell))
+			}
+		}
+	}
+	for _, key := range d.OnlyBaseline {
+		lines = append(lines, fmt.Sprintf("%sonly in the baseline: %s", indent, key))
+	}
+	for _, key := range d.OnlyCurrent {
+		lines = append(lines, fmt.Sprintf("%sonly in the current run: %s", indent, key))
+	}
+	lines = append(lines, fmt.Sprintf("%sregressions: %d", indent, d.Regressions()))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,85 @@
+package matrix
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+// newRunTestCase returns a ClusterIP test case probed in a namespace of its own, as in a run of the suite
+func newRunTestCase(namespace string, rules ...*FakeRule) *TestCase {
+	model := NewModel([]string{namespace}, []string{"pod-1", "pod-2", "pod-3"}, []int32{80}, []v1.Protocol{v1.ProtocolTCP}, "cluster.local")
+	for i, pod := range model.AllPods() {
+		pod.SetNodeName([]string{"node-1", "node-2", "node-3"}[i])
+	}
+	testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.ClusterIP, Reachability: NewReachability(model.AllPods(), true)}
+	ProbePodToPodConnectivity(context.Background(), NewFakeProber(append(rules, &FakeRule{Connected: true})...), model, testCase, DefaultProbeOptions())
+	return testCase
+}
+
+var _ = Describe("results diff", func() {
+	var baseline, current *TestCase
+
+	BeforeEach(func() {
+		loopback := &FakeRule{From: &Peer{Pod: "pod-1"}, To: &Peer{Pod: "pod-1"}, Connected: false, Outcome: OutcomeTimeout}
+		baseline = newRunTestCase("x-11111", loopback, &FakeRule{To: &Peer{Pod: "pod-3"}, Connected: false, Outcome: OutcomeRefused})
+		current = newRunTestCase("x-22222", loopback, &FakeRule{To: &Peer{Pod: "pod-2"}, Connected: false, Outcome: OutcomeTimeout})
+	})
+
+	It("should align the pairs by node and pod name whatever the namespace", func() {
+		diff := DiffTestCases(ResultKey{TestCase: "clusteip-tcp-80"}, NewTestCaseResults(baseline), NewTestCaseResults(current), false)
+		Expect(diff.Unmatched).To(BeZero())
+		Expect(diff.Count(CellRegression)).To(Equal(3))
+		Expect(diff.Count(CellFix)).To(Equal(3))
+		Expect(diff.Count(CellUnchangedFailure)).To(Equal(1))
+		Expect(diff.Cells[0].String()).To(Equal("unchanged-failure node-1/pod-1 -> node-1/pod-1: timeout -> timeout"))
+		Expect(diff.Cells[1].String()).To(Equal("regression node-1/pod-1 -> node-2/pod-2: connected -> timeout"))
+		Expect(diff.Cells[2].String()).To(Equal("fix node-1/pod-1 -> node-3/pod-3: refused -> connected"))
+
+		diff = DiffTestCases(ResultKey{TestCase: "clusteip-tcp-80"}, NewTestCaseResults(baseline), NewTestCaseResults(current), true)
+		Expect(diff.Count(CellRegression)).To(Equal(2))
+		Expect(diff.Count(CellFix)).To(Equal(2))
+		Expect(diff.Count(CellUnchangedFailure)).To(BeZero())
+	})
+
+	It("should load and compare the result sets of two runs per feature", func() {
+		root, err := os.MkdirTemp("", "diff")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(root)
+
+		baselineDir, currentDir := filepath.Join(root, "iptables"), filepath.Join(root, "ipvs")
+		for _, dir := range []string{filepath.Join(baselineDir, "clusterip"), filepath.Join(currentDir, "clusterip")} {
+			testCase := baseline
+			if filepath.Dir(dir) == currentDir {
+				testCase = current
+			}
+			// the same test case validated twice by the feature
+			for i := 0; i < 2; i++ {
+				_, err := WriteTestCaseResults(dir, testCase, ResultsFormatJSON)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+		_, err = WriteTestCaseResults(filepath.Join(currentDir, "nodeport"), current, ResultsFormatYAML)
+		Expect(err).NotTo(HaveOccurred())
+
+		baselineSet, err := LoadResultSet(baselineDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(baselineSet).To(HaveKey(ResultKey{Feature: "clusterip", TestCase: "clusteip-tcp-80#2"}))
+		currentSet, err := LoadResultSet(currentDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		diff := DiffResultSets(baselineSet, currentSet, false)
+		Expect(diff.TestCases).To(HaveLen(2))
+		Expect(diff.OnlyCurrent).To(Equal([]ResultKey{{Feature: "nodeport", TestCase: "clusteip-tcp-80"}}))
+		Expect(diff.Regressions()).To(Equal(6))
+		report := diff.PrettyPrint("")
+		Expect(report).To(ContainSubstring("feature clusterip\n  clusteip-tcp-80: regressions 3, fixes 3, unchanged failures 1"))
+		Expect(report).To(ContainSubstring("only in the current run: nodeport/clusteip-tcp-80"))
+	})
+})
@@ -0,0 +1,308 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+const (
+	// DefaultDistributionConnections is the number of connections sent by each client through the service
+	DefaultDistributionConnections = 30
+	// DefaultDistributionSignificance is the p-value below which a distribution is not uniform
+	DefaultDistributionSignificance = 0.001
+)
+
+// DistributionVerdict tells if the backends of a client distribution are balanced
+type DistributionVerdict string
+
+const (
+	// DistributionFair is a distribution matching an uniform one
+	DistributionFair DistributionVerdict = "fair"
+	// DistributionSkewed is a distribution statistically different from an uniform one
+	DistributionSkewed DistributionVerdict = "skewed"
+	// DistributionSingleBackend is a distribution where a single backend out of several answered
+	DistributionSingleBackend DistributionVerdict = "single-backend"
+	// DistributionUnexpectedBackend is a distribution with answers from pods not backing the service
+	DistributionUnexpectedBackend DistributionVerdict = "unexpected-backend"
+	// DistributionNoAnswer is a distribution without any successful connection
+	DistributionNoAnswer DistributionVerdict = "no-answer"
+	// DistributionPartialFailure is a distribution with more failed connections than tolerated
+	DistributionPartialFailure DistributionVerdict = "partial-failure"
+)
+
+// ServiceTarget is a service backed by several pods, probed through its address
+type ServiceTarget struct {
+	Address     string
+	Port        int
+	Protocol    v1.Protocol
+	ServiceType string
+	// Backends are the names of the pods backing the service
+	Backends []string
+	// Connections is the number of connections sent by each client, DefaultDistributionConnections if zero
+	Connections int
+}
+
+// GetConnections returns the number of connections sent by each client
+func (t *ServiceTarget) GetConnections() int {
+	if t.Connections <= 0 {
+		return DefaultDistributionConnections
+	}
+	return t.Connections
+}
+
+// Name returns the name of the distribution validated through the target, e.g. "nodeport-tcp-30080-distribution"
+func (t *ServiceTarget) Name() string {
+	return fmt.Sprintf("%s-%s-%d-distribution", t.ServiceType, strings.ToLower(string(t.Protocol)), t.Port)
+}
+
+// Distribution counts, for each client, the backends answering its connections through a service
+type Distribution struct {
+	Clients  []string
+	Backends []string
+	Counts   map[string]map[string]int
+	Failures map[string]int
+	// FailureTolerance is the number of failed connections of a client tolerated in a fair distribution
+	FailureTolerance int
+
+	expected map[string]bool
+}
+
+// NewDistribution returns an empty distribution of the clients over the backends
+func NewDistribution(clients, backends []string) *Distribution {
+	counts := map[string]map[string]int{}
+	for _, client := range clients {
+		counts[client] = map[string]int{}
+	}
+	expected := map[string]bool{}
+	for _, backend := range backends {
+		expected[backend] = true
+	}
+	return &Distribution{
+		Clients:  clients,
+		Backends: append([]string{}, backends...),
+		Counts:   counts,
+		Failures: map[string]int{},
+		expected: expected,
+	}
+}
+
+// Observe counts the backend answering the connection of the client, or the failed connection
+func (d *Distribution) Observe(client string, result *ProbeJobResults) {
+	if !result.IsConnected || result.Endpoint == "" {
+		d.Failures[client]++
+		return
+	}
+	if !stringOnSlice(result.Endpoint, d.Backends) {
+		d.Backends = append(d.Backends, result.Endpoint)
+	}
+	d.Counts[client][result.Endpoint]++
+}
+
+// ChiSquare returns the chi-square statistic of the answers of the expected backends
+// against an uniform distribution, and its p-value
+func (d *Distribution) ChiSquare(client string) (statistic, pValue float64) {
+	total := 0
+	for backend := range d.expected {
+		total += d.Counts[client][backend]
+	}
+	if total == 0 || len(d.expected) < 2 {
+		return 0, 1
+	}
+	expected := float64(total) / float64(len(d.expected))
+	for backend := range d.expected {
+		diff := float64(d.Counts[client][backend]) - expected
+		statistic += diff * diff / expected
+	}
+	return statistic, chiSquarePValue(statistic, len(d.expected)-1)
+}
+
+// Verdict returns whether the backends answering the client are balanced, a distribution
+// is skewed when its p-value is below significance. Only the distributions with no more failed
+// connections than tolerated are checked for balance.
+func (d *Distribution) Verdict(client string, significance float64) DistributionVerdict {
+	answered, unexpected, backends := 0, 0, 0
+	for backend, count := range d.Counts[client] {
+		answered += count
+		if !d.expected[backend] {
+			unexpected += count
+		}
+		if count > 0 {
+			backends++
+		}
+	}
+	if answered == 0 {
+		return DistributionNoAnswer
+	}
+	if d.Failures[client] > d.FailureTolerance {
+		return DistributionPartialFailure
+	}
+	if unexpected > 0 {
+		return DistributionUnexpectedBackend
+	}
+	if backends == 1 && len(d.expected) > 1 {
+		return DistributionSingleBackend
+	}
+	if _, pValue := d.ChiSquare(client); pValue < significance {
+		return DistributionSkewed
+	}
+	return DistributionFair
+}
+
+// Summary returns the number of clients with a fair and unfair distribution
+func (d *Distribution) Summary(significance float64) (fair, unfair int) {
+	for _, client := range d.Clients {
+		if d.Verdict(client, significance) == DistributionFair {
+			fair++
+		} else {
+			unfair++
+		}
+	}
+	return fair, unfair
+}
+
+// PrettyPrint produces a client x backend count matrix, with the failed connections, p-value and verdict of each client.
+func (d *Distribution) PrettyPrint(indent string, significance float64) string {
+	columns := append(append([]string{"-\t"}, d.Backends...), "failed", "p-value", "verdict")
+	lines := []string{indent + strings.Join(columns, "\t")}
+	for _, client := range d.Clients {
+		line := []string{client}
+		for _, backend := range d.Backends {
+			line = append(line, fmt.Sprintf("%d\t", d.Counts[client][backend]))
+		}
+		_, pValue := d.ChiSquare(client)
+		line = append(line, fmt.Sprintf("%d\t", d.Failures[client]), fmt.Sprintf("%.4f\t", pValue), string(d.Verdict(client, significance)))
+		lines = append(lines, indent+strings.Join(line, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ProbeBackendDistribution sends the target connections from each client to the service address in
+// ProbeModeReachTargetPod, and counts the backends answering.
+func ProbeBackendDistribution(ctx context.Context, prober Prober, clients []*entities.Pod, target *ServiceTarget, opts *ProbeOptions) *Distribution {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	clientNames := make([]string, len(clients))
+	for i, client := range clients {
+		clientNames[i] = client.PodString().String()
+	}
+	distribution := NewDistribution(clientNames, target.Backends)
+	distribution.FailureTolerance = opts.DistributionFailureTolerance
+	ctx, cancel := context.WithTimeout(ctx, opts.GetDeadline())
+	defer cancel()
+
+	connections := target.GetConnections()
+	size := len(clients) * connections
+	jobs := make(chan *ProbeJob, size)
+	results := make(chan *ProbeJobResults, size)
+	limiter := newNodeLimiter(opts.MaxExecPerNode)
+	for i := 0; i < opts.GetWorkers(); i++ {
+		go probeWorker(ctx, prober, limiter, jobs, results)
+	}
+	for i := 0; i < connections; i++ {
+		for _, client := range clients {
+			jobs <- &ProbeJob{
+				PodFrom:     client,
+				ToAddress:   target.Address,
+				ToPort:      target.Port,
+				Protocol:    target.Protocol,
+				ServiceType: target.ServiceType,
+				Mode:        ProbeModeReachTargetPod,
+				Timeout:     opts.GetProbeTimeout(),
+			}
+		}
+	}
+	close(jobs)
+
+	for i := 0; i < size; i++ {
+		result := <-results
+		if result.Err != nil {
+			zap.L().Debug("Connection through the service failed.",
+				zap.String("from", string(result.Job.PodFrom.PodString())),
+				zap.String("to", target.Address),
+				zap.String("outcome", string(result.Outcome)),
+				zap.String("err", result.Err.Error()),
+			)
+		}
+		distribution.Observe(result.Job.PodFrom.PodString().String(), result)
+	}
+	return distribution
+}
+
+// ValidateDistributionOrFail checks the connections of every client through the service are balanced
+// over its backends, and returns the number of clients with an unfair distribution.
+func ValidateDistributionOrFail(ctx context.Context, prober Prober, clients []*entities.Pod, target *ServiceTarget, opts *ProbeOptions) int {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	zap.L().Info("Validating backend distribution.",
+		zap.String("address", target.Address), zap.Int("connections", target.GetConnections()),
+	)
+	distribution := ProbeBackendDistribution(ctx, prober, clients, target, opts)
+	fair, unfair := distribution.Summary(DefaultDistributionSignificance)
+	zap.L().Info(fmt.Sprintf("Distribution results (%t): fair: %v, unfair: %v", unfair == 0, fair, unfair))
+	zap.L().Info(fmt.Sprintf("backend distribution:\n\n%s\n\n\n", distribution.PrettyPrint("", DefaultDistributionSignificance)))
+	collect(opts, target.Name(), target.ServiceType, target.Protocol, unfair, distribution)
+	return unfair
+}
+
+// chiSquarePValue returns the probability of a chi-square statistic at least as extreme as the given one,
+// the regularized upper incomplete gamma function Q(df/2, statistic/2)
+func chiSquarePValue(statistic float64, df int) float64 {
+	a, x := float64(df)/2, statistic/2
+	if x <= 0 {
+		return 1
+	}
+	lgammaA, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgammaA)
+	const (
+		maxIterations = 500
+		epsilon       = 1e-12
+		tiny          = 1e-300
+	)
+
+	if x < a+1 {
+		// series of the lower function P(a, x)
+		term := 1 / a
+		sum := term
+		for n := 1; n < maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	// continued fraction of Q(a, x), with the modified Lentz method
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for n := 1; n < maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,115 @@
+package matrix
+
+import (
+	"context"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("backend distribution", func() {
+	var (
+		ctx     context.Context
+		clients []*entities.Pod
+		target  *ServiceTarget
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clients = newFakeModel().AllPods()
+		target = &ServiceTarget{
+			Address: "10.96.0.10", Port: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.ClusterIP,
+			Backends: []string{"backend-1", "backend-2", "backend-3"}, Connections: 30,
+		}
+	})
+
+	It("should compute the chi-square p-values", func() {
+		Expect(chiSquarePValue(0, 2)).To(Equal(1.0))
+		Expect(chiSquarePValue(2, 2)).To(BeNumerically("~", math.Exp(-1), 1e-9))
+		Expect(chiSquarePValue(3.841, 1)).To(BeNumerically("~", 0.05, 1e-3))
+		Expect(chiSquarePValue(30, 2)).To(BeNumerically("~", math.Exp(-15), 1e-9))
+	})
+
+	It("should pass an uniform distribution", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: target.Backends})
+		Expect(ValidateDistributionOrFail(ctx, prober, clients, target, nil)).To(BeZero())
+
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		client := clients[0].PodString().String()
+		Expect(distribution.Counts[client]).To(Equal(map[string]int{"backend-1": 10, "backend-2": 10, "backend-3": 10}))
+		Expect(distribution.Verdict(client, DefaultDistributionSignificance)).To(Equal(DistributionFair))
+	})
+
+	It("should flag a single backend distribution", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: []string{"backend-2"}})
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		Expect(distribution.Verdict(clients[0].PodString().String(), DefaultDistributionSignificance)).To(Equal(DistributionSingleBackend))
+		_, unfair := distribution.Summary(DefaultDistributionSignificance)
+		Expect(unfair).To(Equal(3))
+	})
+
+	It("should register the result of the validation in the run summary", func() {
+		MatrixResults = &Results{}
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: []string{"backend-2"}})
+		opts := DefaultProbeOptions()
+		opts.Feature = "LoadBalancing"
+		Expect(ValidateDistributionOrFail(ctx, prober, clients, target, opts)).To(Equal(3))
+
+		summary := MatrixResults.Summary()
+		Expect(summary.Results).To(HaveLen(1))
+		Expect(summary.Results[0].Name).To(Equal("LoadBalancing"))
+		Expect(summary.Results[0].TestCase).To(Equal("clusteip-tcp-80-distribution"))
+		Expect(summary.Results[0].WrongNum).To(Equal(3))
+		Expect(string(summary.Results[0].Matrix)).To(ContainSubstring(`"backend-2":30`))
+	})
+
+	It("should flag a skewed distribution", func() {
+		target.Connections = 60
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: []string{
+			"backend-1", "backend-1", "backend-1", "backend-1", "backend-2", "backend-3",
+		}})
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		client := clients[0].PodString().String()
+		statistic, pValue := distribution.ChiSquare(client)
+		Expect(statistic).To(BeNumerically("~", 30, 1e-9))
+		Expect(pValue).To(BeNumerically("<", DefaultDistributionSignificance))
+		Expect(distribution.Verdict(client, DefaultDistributionSignificance)).To(Equal(DistributionSkewed))
+		Expect(distribution.PrettyPrint("", DefaultDistributionSignificance)).To(ContainSubstring("skewed"))
+	})
+
+	It("should flag answers from pods not backing the service", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: []string{"backend-1", "backend-2", "backend-3", "other"}})
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		Expect(distribution.Backends).To(ContainElement("other"))
+		Expect(distribution.Verdict(clients[0].PodString().String(), DefaultDistributionSignificance)).To(Equal(DistributionUnexpectedBackend))
+	})
+
+	It("should fail a distribution with more failed connections than tolerated", func() {
+		target.Connections = 33
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoints: target.Backends, Failures: 3})
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		client := clients[0].PodString().String()
+		Expect(distribution.Failures[client]).To(Equal(3))
+		Expect(distribution.Counts[client]).To(Equal(map[string]int{"backend-1": 10, "backend-2": 10, "backend-3": 10}))
+		Expect(distribution.Verdict(client, DefaultDistributionSignificance)).To(Equal(DistributionPartialFailure))
+		_, unfair := distribution.Summary(DefaultDistributionSignificance)
+		Expect(unfair).To(Equal(3))
+
+		opts := DefaultProbeOptions()
+		opts.DistributionFailureTolerance = 3
+		prober = NewFakeProber(&FakeRule{Connected: true, Endpoints: target.Backends, Failures: 3})
+		Expect(ValidateDistributionOrFail(ctx, prober, clients, target, opts)).To(BeZero())
+	})
+
+	It("should count the failed connections", func() {
+		prober := NewFakeProber(&FakeRule{Connected: false})
+		distribution := ProbeBackendDistribution(ctx, prober, clients, target, nil)
+		client := clients[0].PodString().String()
+		Expect(distribution.Failures[client]).To(Equal(30))
+		Expect(distribution.Verdict(client, DefaultDistributionSignificance)).To(Equal(DistributionNoAnswer))
+	})
+})
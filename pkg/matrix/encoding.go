@@ -0,0 +1,376 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+// ResultsVersion is the version of the encoding of the results, changed on incompatible changes of the schema
+const ResultsVersion = "v1"
+
+// ResultsFormat is the encoding of the results written to the output directory
+type ResultsFormat string
+
+const (
+	// ResultsFormatJSON encodes the results in JSON
+	ResultsFormatJSON ResultsFormat = "json"
+	// ResultsFormatYAML encodes the results in YAML
+	ResultsFormatYAML ResultsFormat = "yaml"
+)
+
+// cellDocument is the encoding of a pair of a truth table, the fields not set for the pair are left out
+type cellDocument struct {
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Value       bool         `json:"value"`
+	Outcome     Outcome      `json:"outcome,omitempty"`
+	Bandwidth   *float64     `json:"bandwidthBitsPerSec,omitempty"`
+	LatenciesNs []int64      `json:"latenciesNs,omitempty"`
+	Samples     *SampleCount `json:"samples,omitempty"`
+	SourceIP    string       `json:"sourceIP,omitempty"`
+	Attempts    int          `json:"attempts,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	Stderr      string       `json:"stderr,omitempty"`
+}
+
+// truthTableDocument is the encoding of a truth table, with a cell per pair holding a value, in order
+type truthTableDocument struct {
+	Froms []string        `json:"froms"`
+	Tos   []string        `json:"tos"`
+	Cells []*cellDocument `json:"cells"`
+}
+
+// MarshalJSON encodes the truth table as its pairs holding a value
+func (tt *TruthTable) MarshalJSON() ([]byte, error) {
+	doc := truthTableDocument{Froms: tt.Froms, Tos: tt.Tos, Cells: []*cellDocument{}}
+	for _, from := range tt.Froms {
+		for _, to := range tt.Tos {
+			value, ok := tt.Values[from][to]
+			if !ok {
+				continue
+			}
+			cell := &cellDocument{
+				From: from, To: to, Value: value,
+				Outcome:  tt.Outcomes[from][to],
+				Samples:  tt.Samples[from][to],
+				SourceIP: tt.SourceIPs[from][to],
+				Attempts: tt.Attempts[from][to],
+			}
+			if bandwidth := tt.Bandwidths[from][to]; bandwidth != nil {
+				cell.Bandwidth = &bandwidth.Bandwidth
+			}
+			if details := tt.Details[from][to]; details != nil {
+				cell.Command, cell.Stderr = details.Command, details.Stderr
+			}
+			if latency := tt.Latencies[from][to]; latency != nil {
+				for _, duration := range latency.Durations {
+					cell.LatenciesNs = append(cell.LatenciesNs, duration.Nanoseconds())
+				}
+			}
+			doc.Cells = append(doc.Cells, cell)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes a truth table encoded by MarshalJSON
+func (tt *TruthTable) UnmarshalJSON(data []byte) error {
+	var doc truthTableDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	*tt = *NewTruthTable(doc.Froms, doc.Tos, nil)
+	for _, cell := range doc.Cells {
+		if _, ok := tt.Values[cell.From]; !ok || !tt.toSet[cell.To] {
+			return errors.Errorf("pair %s -> %s is not in the truth table", cell.From, cell.To)
+		}
+		tt.Values[cell.From][cell.To] = cell.Value
+		if cell.Outcome != OutcomeUnknown {
+			tt.Outcomes[cell.From][cell.To] = cell.Outcome
+		}
+		if cell.Bandwidth != nil {
+			tt.Bandwidths[cell.From][cell.To] = &ProbeJobBandwidthResults{Bandwidth: *cell.Bandwidth}
+		}
+		if cell.LatenciesNs != nil {
+			latency := &ProbeJobLatencyResults{}
+			for _, ns := range cell.LatenciesNs {
+				latency.Durations = append(latency.Durations, time.Duration(ns))
+			}
+			tt.Latencies[cell.From][cell.To] = latency
+		}
+		if cell.Samples != nil {
+			tt.Samples[cell.From][cell.To] = cell.Samples
+		}
+		if cell.SourceIP != "" {
+			tt.SourceIPs[cell.From][cell.To] = cell.SourceIP
+		}
+		if cell.Attempts != 0 {
+			tt.Attempts[cell.From][cell.To] = cell.Attempts
+		}
+		if cell.Command != "" || cell.Stderr != "" {
+			tt.Details[cell.From][cell.To] = &ProbeDetails{Command: cell.Command, Stderr: cell.Stderr}
+		}
+	}
+	return nil
+}
+
+// externalIPDocument is the encoding of an external IP of a pod
+type externalIPDocument struct {
+	IP       string      `json:"ip"`
+	Protocol v1.Protocol `json:"protocol,omitempty"`
+}
+
+// podDocument is the encoding of the metadata of a pod of the matrix
+type podDocument struct {
+	Namespace   string                `json:"namespace"`
+	Name        string                `json:"name"`
+	Node        string                `json:"node,omitempty"`
+	PodIPs      []string              `json:"podIPs,omitempty"`
+	HostIPs     []string              `json:"hostIPs,omitempty"`
+	ClusterIPs  []string              `json:"clusterIPs,omitempty"`
+	ExternalIPs []*externalIPDocument `json:"externalIPs,omitempty"`
+	ToPort      int32                 `json:"toPort,omitempty"`
+	HostNetwork bool                  `json:"hostNetwork,omitempty"`
+}
+
+// ipsOrPrimary returns ips, or the primary IP alone if ips were not set
+func ipsOrPrimary(primary string, ips []string) []string {
+	if len(ips) == 0 && primary != "" {
+		return []string{primary}
+	}
+	return ips
+}
+
+func newPodDocument(pod *entities.Pod) *podDocument {
+	doc := &podDocument{
+		Namespace:   pod.Namespace,
+		Name:        pod.Name,
+		Node:        pod.NodeName,
+		PodIPs:      ipsOrPrimary(pod.PodIP, pod.PodIPs),
+		HostIPs:     ipsOrPrimary(pod.HostIP, pod.HostIPs),
+		ClusterIPs:  pod.GetClusterIPs(),
+		ToPort:      pod.ToPort,
+		HostNetwork: pod.HostNetwork,
+	}
+	for _, externalIP := range pod.ExternalIPs {
+		doc.ExternalIPs = append(doc.ExternalIPs, &externalIPDocument{IP: externalIP.IP, Protocol: externalIP.Protocol})
+	}
+	return doc
+}
+
+func (doc *podDocument) pod() *entities.Pod {
+	pod := &entities.Pod{Namespace: doc.Namespace, Name: doc.Name, NodeName: doc.Node, ToPort: doc.ToPort, HostNetwork: doc.HostNetwork}
+	pod.SetPodIPs(doc.PodIPs)
+	pod.SetHostIPs(doc.HostIPs)
+	pod.SetClusterIPs(doc.ClusterIPs)
+	for _, externalIP := range doc.ExternalIPs {
+		pod.ExternalIPs = append(pod.ExternalIPs, entities.NewExternalIP(externalIP.IP, externalIP.Protocol))
+	}
+	return pod
+}
+
+// reachabilityDocument is the encoding of a reachability, the comparison is derived from the expected
+// and observed tables and only encoded for the readers of the results
+type reachabilityDocument struct {
+	Pods              []*podDocument `json:"pods"`
+	Externals         []*podDocument `json:"externals,omitempty"`
+	Expected          *TruthTable    `json:"expected"`
+	Observed          *TruthTable    `json:"observed"`
+	Comparison        *TruthTable    `json:"comparison,omitempty"`
+	ConsistentAfterNs int64          `json:"consistentAfterNs,omitempty"`
+}
+
+// MarshalJSON encodes the reachability with the metadata of its pods and the comparison of its tables
+func (r *Reachability) MarshalJSON() ([]byte, error) {
+	doc := reachabilityDocument{
+		Pods:              []*podDocument{},
+		Expected:          r.Expected,
+		Observed:          r.Observed,
+		Comparison:        r.Expected.Compare(r.Observed),
+		ConsistentAfterNs: r.ConsistentAfter.Nanoseconds(),
+	}
+	for _, pod := range r.Pods {
+		doc.Pods = append(doc.Pods, newPodDocument(pod))
+	}
+	for _, external := range r.Externals {
+		doc.Externals = append(doc.Externals, newPodDocument(external))
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes a reachability encoded by MarshalJSON
+func (r *Reachability) UnmarshalJSON(data []byte) error {
+	var doc reachabilityDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Expected == nil || doc.Observed == nil {
+		return errors.New("reachability without expected or observed truth table")
+	}
+	*r = Reachability{Expected: doc.Expected, Observed: doc.Observed, ConsistentAfter: time.Duration(doc.ConsistentAfterNs)}
+	for _, pod := range doc.Pods {
+		r.Pods = append(r.Pods, pod.pod())
+	}
+	for _, external := range doc.Externals {
+		r.Externals = append(r.Externals, external.pod())
+	}
+	return nil
+}
+
+// TestCaseResults is the versioned encoding of the results of a test case
+type TestCaseResults struct {
+	Version      string        `json:"version"`
+	Name         string        `json:"name"`
+	ServiceType  string        `json:"serviceType"`
+	Protocol     v1.Protocol   `json:"protocol"`
+	ToPort       int           `json:"toPort,omitempty"`
+	IPFamily     v1.IPFamily   `json:"ipFamily,omitempty"`
+	Reachability *Reachability `json:"reachability"`
+}
+
+// NewTestCaseResults returns the results of the test case in the current version
+func NewTestCaseResults(testCase *TestCase) *TestCaseResults {
+	return &TestCaseResults{
+		Version:      ResultsVersion,
+		Name:         testCase.Name(),
+		ServiceType:  testCase.ServiceType,
+		Protocol:     testCase.Protocol,
+		ToPort:       testCase.ToPort,
+		IPFamily:     testCase.IPFamily,
+		Reachability: testCase.Reachability,
+	}
+}
+
+// TestCase returns the test case of the results
+func (r *TestCaseResults) TestCase() *TestCase {
+	return &TestCase{
+		ToPort: r.ToPort, Protocol: r.Protocol, Reachability: r.Reachability, ServiceType: r.ServiceType, IPFamily: r.IPFamily,
+	}
+}
+
+// Encode encodes the results in the format
+func (r *TestCaseResults) Encode(format ResultsFormat) ([]byte, error) {
+	switch format {
+	case ResultsFormatJSON:
+		return json.MarshalIndent(r, "", "  ")
+	case ResultsFormatYAML:
+		return yaml.Marshal(r)
+	}
+	return nil, errors.Errorf("unknown results format %q", format)
+}
+
+// DecodeTestCaseResults decodes results encoded in the format, and fails on results of another version
+func DecodeTestCaseResults(data []byte, format ResultsFormat) (*TestCaseResults, error) {
+	var results TestCaseResults
+	var err error
+	switch format {
+	case ResultsFormatJSON:
+		err = json.Unmarshal(data, &results)
+	case ResultsFormatYAML:
+		err = yaml.Unmarshal(data, &results)
+	default:
+		return nil, errors.Errorf("unknown results format %q", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode results")
+	}
+	if results.Version != ResultsVersion {
+		return nil, errors.Errorf("unsupported results version %q, expected %q", results.Version, ResultsVersion)
+	}
+	if results.Reachability == nil {
+		return nil, errors.New("results without reachability")
+	}
+	return &results, nil
+}
+
+// resultsSequence numbers the results written by the run, keeping the files in the order of the test cases
+var resultsSequence int64
+
+// WriteTestCaseResults writes the results of the test case to a new file of dir, named after the test case,
+// and returns the path of the file
+func WriteTestCaseResults(dir string, testCase *TestCase, format ResultsFormat) (string, error) {
+	data, err := NewTestCaseResults(testCase).Encode(format)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.Wrap(err, "failed to create the results directory")
+	}
+	name := fmt.Sprintf("%03d-%s.%s", atomic.AddInt64(&resultsSequence, 1), testCase.Name(), format)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", errors.Wrap(err, "failed to write the results")
+	}
+	return path, nil
+}
+
+// ReadTestCaseResults reads results written by WriteTestCaseResults, in the format of the file extension
+func ReadTestCaseResults(path string) (*TestCaseResults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the results")
+	}
+	format := ResultsFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if format == "yml" {
+		format = ResultsFormatYAML
+	}
+	return DecodeTestCaseResults(data, format)
+}
+
+// writeResults writes the results of the test cases to the output directory of opts, if any, the failures
+// to write them are logged and do not fail the validation
+func writeResults(opts *ProbeOptions, testCases ...*TestCase) {
+	if opts.OutputDir == "" {
+		return
+	}
+	for _, testCase := range testCases {
+		path, err := WriteTestCaseResults(opts.OutputDir, testCase, opts.GetOutputFormat())
+		if err != nil {
+			zap.L().Error("Unable to write the results.", zap.String("test", testCase.Name()), zap.Error(err))
+			continue
+		}
+		zap.L().Debug("Results written.", zap.String("path", path))
+	}
+}
+
+// writeRenders writes the matrices of the summaries of the test cases rendered by the renderer of opts to new
+// files of the output directory of opts, named after the test case and the matrix, if the renderer renders
+// files, e.g. HTML. The failures to write them are logged and do not fail the validation.
+func writeRenders(opts *ProbeOptions, measureBandWidth bool, testCases ...*TestCase) {
+	extension := fileExtension(opts.Renderer)
+	if extension == "" {
+		return
+	}
+	if opts.OutputDir == "" {
+		zap.L().Warn(fmt.Sprintf("No output directory, the %s matrices are logged as text.", extension))
+		return
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		zap.L().Error("Unable to create the results directory.", zap.Error(err))
+		return
+	}
+	for _, testCase := range testCases {
+		r := testCase.Reachability
+		sequence := atomic.AddInt64(&resultsSequence, 1)
+		for _, m := range r.renderMatrices(opts.Renderer, r.Expected.Compare(r.Observed), true, true, true, measureBandWidth) {
+			path := filepath.Join(opts.OutputDir, fmt.Sprintf("%03d-%s-%s.%s", sequence, testCase.Name(), m.name, extension))
+			if err := os.WriteFile(path, []byte(m.render), 0o644); err != nil {
+				zap.L().Error("Unable to write the matrix.", zap.String("test", testCase.Name()), zap.Error(err))
+				continue
+			}
+			zap.L().Info("Matrix written.", zap.String("matrix", m.title), zap.String("path", path))
+		}
+	}
+}
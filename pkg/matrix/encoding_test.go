@@ -0,0 +1,86 @@
+package matrix
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("results encoding", func() {
+	var (
+		testCase *TestCase
+		pods     []*entities.Pod
+	)
+
+	BeforeEach(func() {
+		model := newFakeModel()
+		pods = model.AllPods()
+		pods[0].SetClusterIPs([]string{"10.96.0.1", "fd00::1"})
+		pods[1].SetHostIPs([]string{"172.18.0.2"})
+		testCase = &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.ClusterIP, Reachability: NewReachability(pods, true)}
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-3"}, Connected: false, Outcome: OutcomeRefused},
+			&FakeRule{Connected: true, Latency: &ProbeJobLatencyResults{Durations: []time.Duration{time.Millisecond}}})
+		ProbePodToPodConnectivity(context.Background(), prober, model, testCase, DefaultProbeOptions().WithMode(ProbeModeLatency))
+	})
+
+	expectRoundTrip := func(format ResultsFormat) {
+		data, err := NewTestCaseResults(testCase).Encode(format)
+		Expect(err).NotTo(HaveOccurred())
+		results, err := DecodeTestCaseResults(data, format)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(results.Version).To(Equal(ResultsVersion))
+		Expect(results.Name).To(Equal("clusteip-tcp-80"))
+		Expect(results.TestCase().Name()).To(Equal(testCase.Name()))
+		decoded := results.Reachability
+		Expect(decoded.Expected.Values).To(Equal(testCase.Reachability.Expected.Values))
+		Expect(decoded.Observed.Values).To(Equal(testCase.Reachability.Observed.Values))
+		from, to := pods[0].PodString().String(), pods[2].PodString().String()
+		Expect(decoded.Observed.GetOutcome(from, to)).To(Equal(OutcomeRefused))
+		Expect(decoded.Observed.GetAttempts(from, to)).To(Equal(1))
+		Expect(decoded.Observed.GetLatency(from, pods[1].PodString().String()).Durations).To(Equal([]time.Duration{time.Millisecond}))
+		_, wrong, _, _ := decoded.Summary(false, false)
+		Expect(wrong).To(Equal(3))
+
+		Expect(decoded.Pods).To(HaveLen(3))
+		Expect(decoded.Pods[0].NodeName).To(Equal("node-1"))
+		Expect(decoded.Pods[0].GetPodIP()).To(Equal("10.0.0.1"))
+		Expect(decoded.Pods[0].GetClusterIPByFamily(v1.IPv6Protocol)).To(Equal("fd00::1"))
+		Expect(decoded.Pods[1].GetHostIP()).To(Equal("172.18.0.2"))
+	}
+
+	It("should round trip in JSON", func() {
+		expectRoundTrip(ResultsFormatJSON)
+	})
+
+	It("should round trip in YAML", func() {
+		expectRoundTrip(ResultsFormatYAML)
+	})
+
+	It("should refuse results of another version", func() {
+		_, err := DecodeTestCaseResults([]byte(`{"version": "v0"}`), ResultsFormatJSON)
+		Expect(err).To(MatchError(ContainSubstring("unsupported results version")))
+	})
+
+	It("should write and read the results of a test case in the output directory", func() {
+		dir, err := os.MkdirTemp("", "results")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path, err := WriteTestCaseResults(dir, testCase, ResultsFormatYAML)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Dir(path)).To(Equal(dir))
+		Expect(filepath.Base(path)).To(MatchRegexp(`^\d{3}-clusteip-tcp-80\.yaml$`))
+
+		results, err := ReadTestCaseResults(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results.Reachability.Observed.Values).To(Equal(testCase.Reachability.Observed.Values))
+	})
+})
@@ -0,0 +1,116 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+const (
+	// ExternalNamespace is the namespace of the synthetic pods standing for the clients outside of the cluster
+	ExternalNamespace = "external"
+	// externalDialTimeout bounds a connection from outside of the cluster, as agnhost connect does in the pods
+	externalDialTimeout = 5 * time.Second
+)
+
+// NewExternalPod returns the synthetic pod standing for the validator process, as a client outside of the cluster
+func NewExternalPod() *entities.Pod {
+	return &entities.Pod{Namespace: ExternalNamespace, Name: "external", NodeName: "validator"}
+}
+
+// IsExternalPod returns true if the pod stands for a client outside of the cluster
+func IsExternalPod(pod *entities.Pod) bool {
+	return pod.Namespace == ExternalNamespace
+}
+
+// ExternalProber dials the targets from the validator process for the jobs of external pods,
+// e.g. node IPs for NodePort and ingress IPs for LoadBalancer services, other jobs are probed by next.
+type ExternalProber struct {
+	next   Prober
+	dialer net.Dialer
+}
+
+// NewExternalProber returns an ExternalProber delegating the probes of the cluster pods to next
+func NewExternalProber(next Prober) *ExternalProber {
+	return &ExternalProber{next: next}
+}
+
+// Probe dials the target of the job from the validator process when the source is external
+func (p *ExternalProber) Probe(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	if !IsExternalPod(job.PodFrom) {
+		return p.next.Probe(ctx, job)
+	}
+
+	address := net.JoinHostPort(job.Address(), strconv.Itoa(job.ToPort))
+	result := &ProbeJobResults{
+		Job:     job,
+		Command: fmt.Sprintf("dial %s %s", strings.ToLower(string(job.Protocol)), address),
+	}
+	var network string
+	switch job.Protocol {
+	case v1.ProtocolTCP:
+		network = "tcp"
+	case v1.ProtocolUDP:
+		network = "udp"
+	default:
+		result.Outcome, result.Err = OutcomeFailed, errors.Errorf("protocol %s not supported from outside of the cluster", job.Protocol)
+		return result
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, externalDialTimeout)
+	defer cancel()
+	conn, err := p.dialer.DialContext(dialCtx, network, address)
+	if err != nil {
+		result.Outcome, result.Stderr = dialOutcome(ctx, err), err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	// agnhost serve-hostname answers the hostname of the pod, on connection for TCP and on any datagram for UDP
+	deadline, _ := dialCtx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		result.Outcome, result.Err = OutcomeFailed, err
+		return result
+	}
+	if network == "udp" {
+		if _, err := conn.Write([]byte("hostname\n")); err != nil {
+			result.Outcome, result.Stderr = dialOutcome(ctx, err), err.Error()
+			return result
+		}
+	}
+	buffer := make([]byte, 256)
+	n, err := conn.Read(buffer)
+	if n == 0 && err != nil {
+		result.Outcome, result.Stderr = dialOutcome(ctx, err), err.Error()
+		return result
+	}
+	result.IsConnected, result.Outcome = true, OutcomeConnected
+	result.Endpoint = strings.TrimSpace(string(buffer[:n]))
+	return result
+}
+
+// dialOutcome classifies the error of a connection from outside of the cluster
+func dialOutcome(ctx context.Context, err error) Outcome {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case ctx.Err() != nil:
+		return OutcomeCancelled
+	case errors.As(err, &dnsErr):
+		return OutcomeDNSFailure
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return OutcomeRefused
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return OutcomeTimeout
+	}
+	return OutcomeFailed
+}
@@ -0,0 +1,108 @@
+package matrix
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("external prober", func() {
+	var (
+		ctx      context.Context
+		external *entities.Pod
+		target   *entities.Pod
+		prober   *ExternalProber
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		external = NewExternalPod()
+		target = &entities.Pod{Namespace: "ns-1", Name: "pod-1", NodeName: "node-1", PodIP: "127.0.0.1", HostIP: "127.0.0.1"}
+		prober = NewExternalProber(NewFakeProber(&FakeRule{Connected: true}))
+	})
+
+	newJob := func(port int, protocol v1.Protocol) *ProbeJob {
+		return &ProbeJob{PodFrom: external, PodTo: target, ToPort: port, Protocol: protocol, ServiceType: entities.NodePort}
+	}
+
+	It("should read the hostname answered over TCP", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte("pod-1\n"))
+		}()
+
+		result := prober.Probe(ctx, newJob(listener.Addr().(*net.TCPAddr).Port, v1.ProtocolTCP))
+		Expect(result.Err).NotTo(HaveOccurred())
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(result.Outcome).To(Equal(OutcomeConnected))
+		Expect(result.Endpoint).To(Equal("pod-1"))
+	})
+
+	It("should read the hostname answered over UDP", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		go func() {
+			buffer := make([]byte, 64)
+			_, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo([]byte("pod-1"), addr)
+		}()
+
+		_, port, err := net.SplitHostPort(conn.LocalAddr().String())
+		Expect(err).NotTo(HaveOccurred())
+		toPort, err := strconv.Atoi(port)
+		Expect(err).NotTo(HaveOccurred())
+		result := prober.Probe(ctx, newJob(toPort, v1.ProtocolUDP))
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(result.Endpoint).To(Equal("pod-1"))
+	})
+
+	It("should report a refused connection", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+
+		result := prober.Probe(ctx, newJob(port, v1.ProtocolTCP))
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Outcome).To(Equal(OutcomeRefused))
+	})
+
+	It("should delegate the probes of the cluster pods", func() {
+		result := prober.Probe(ctx, &ProbeJob{PodFrom: target, PodTo: target, ToPort: 80, Protocol: v1.ProtocolTCP})
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(result.Command).To(HavePrefix("fake"))
+	})
+
+	It("should add the external sources as rows of the matrix", func() {
+		model := newFakeModel()
+		pods := model.AllPods()
+		reachability := NewReachabilityWithExternals(pods, []*entities.Pod{external}, true)
+		reachability.ExpectPeer(&Peer{Namespace: ExternalNamespace}, &Peer{Pod: "pod-2"}, false)
+		fake := NewFakeProber(
+			&FakeRule{From: &Peer{Namespace: ExternalNamespace}, To: &Peer{Pod: "pod-2"}, Connected: false},
+			&FakeRule{Connected: true},
+		)
+		testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP, Reachability: reachability}
+		Expect(ValidateOrFail(ctx, fake, model, testCase, nil)).To(BeZero())
+		Expect(reachability.Observed.Froms).To(HaveLen(4))
+		Expect(reachability.Observed.Tos).To(HaveLen(3))
+		Expect(fake.Calls(external.PodString(), pods[0].PodString())).To(Equal(1))
+	})
+})
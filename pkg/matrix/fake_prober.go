@@ -0,0 +1,134 @@
+package matrix
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+// FakeRule programs the result of the probes it matches, empty fields match everything
+type FakeRule struct {
+	From        *Peer
+	To          *Peer
+	Port        int
+	Protocol    v1.Protocol
+	ServiceType string
+	IPFamily    v1.IPFamily
+
+	// Connected is the connectivity reported by the matching probes
+	Connected bool
+	// Outcome is reported by the matching probes, OutcomeConnected or OutcomeFailed following Connected if empty
+	Outcome Outcome
+	// Endpoint is the backend answering the connection, the target pod name if empty
+	Endpoint string
+	// Endpoints are the backends answering the successive connections of each pair in turn, overriding Endpoint
+	Endpoints []string
+	// Bandwidth is reported by the matching probes in ProbeModeBandwidth
+	Bandwidth *ProbeJobBandwidthResults
+	// Latency is reported by the matching probes in ProbeModeLatency
+	Latency *ProbeJobLatencyResults
+	// SourceIP is the client IP seen by the target in ProbeModeClientIP, the source pod IP if empty
+	SourceIP string
+	// Err is reported by the matching probes
+	Err error
+	// Failures makes the first matching probes of each pair fail before the rule applies,
+	// emulating a dataplane that is not programmed yet
+	Failures int
+}
+
+// Matches returns true if the rule applies to the job
+func (r *FakeRule) Matches(job *ProbeJob) bool {
+	return (r.From == nil || r.From.Matches(job.PodFrom.PodString())) &&
+		(r.To == nil || (job.PodTo != nil && r.To.Matches(job.PodTo.PodString()))) &&
+		(r.Port == 0 || r.Port == job.ToPort) &&
+		(r.Protocol == "" || r.Protocol == job.Protocol) &&
+		(r.ServiceType == "" || r.ServiceType == job.GetServiceType()) &&
+		(r.IPFamily == "" || r.IPFamily == job.IPFamily)
+}
+
+// FakeProber is an in-memory Prober, the result of each probe is given by the first matching rule,
+// probes matching no rule are not connected.
+type FakeProber struct {
+	Rules []*FakeRule
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// NewFakeProber returns a FakeProber programmed with rules, evaluated in order
+func NewFakeProber(rules ...*FakeRule) *FakeProber {
+	return &FakeProber{Rules: rules, calls: map[string]int{}}
+}
+
+// Probe returns the result programmed by the first rule matching the job
+func (f *FakeProber) Probe(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	calls := f.call(job.PodFrom.PodString(), jobTarget(job))
+	result := &ProbeJobResults{Job: job, Command: "fake " + job.Address(), Outcome: OutcomeFailed}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		result.Outcome = OutcomeCancelled
+		return result
+	}
+
+	for _, rule := range f.Rules {
+		if !rule.Matches(job) {
+			continue
+		}
+		if calls <= rule.Failures {
+			return result
+		}
+		result.IsConnected = rule.Connected
+		result.Err = rule.Err
+		result.Outcome = rule.Outcome
+		if result.Outcome == OutcomeUnknown {
+			result.Outcome = OutcomeFailed
+			if rule.Connected {
+				result.Outcome = OutcomeConnected
+			}
+		}
+		if rule.Connected {
+			result.Endpoint = rule.Endpoint
+			if len(rule.Endpoints) > 0 {
+				result.Endpoint = rule.Endpoints[(calls-rule.Failures-1)%len(rule.Endpoints)]
+			} else if result.Endpoint == "" && job.PodTo != nil {
+				result.Endpoint = job.PodTo.Name
+			}
+			if job.Mode == ProbeModeBandwidth {
+				result.Bandwidth = rule.Bandwidth
+			}
+			if job.Mode == ProbeModeClientIP {
+				result.SourceIP = rule.SourceIP
+				if result.SourceIP == "" {
+					result.SourceIP = job.PodFrom.GetPodIPByFamily(job.IPFamily)
+				}
+			}
+			if job.Mode == ProbeModeLatency && rule.Latency != nil {
+				result.Latency = &ProbeJobLatencyResults{Durations: append([]time.Duration{}, rule.Latency.Durations...)}
+			}
+		}
+		return result
+	}
+	return result
+}
+
+// Calls returns the number of probes executed from->to
+func (f *FakeProber) Calls(from, to entities.PodString) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[string(from)+"->"+string(to)]
+}
+
+func (f *FakeProber) call(from, to entities.PodString) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	key := string(from) + "->" + string(to)
+	f.calls[key]++
+	return f.calls[key]
+}
@@ -1,10 +1,12 @@
 package matrix
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -55,34 +57,34 @@ func NewClientSet() (*kubernetes.Clientset, *rest.Config) {
 	return clientset, config
 }
 
-// ValidateOrFail validates connectivity
-func ValidateOrFail(k8s *KubeManager, model *Model, testCase *TestCase, ignoreLoopback, reachTargetPod bool) int {
-	return ValidateAndMeasureBandwidthOrFail(k8s, model, testCase, ignoreLoopback, reachTargetPod, false)
-}
-
-// ValidateAndMeasureBandwidthOrFail validates connectivity and also measure bandwidth
-// if measureBandWidth is true
-func ValidateAndMeasureBandwidthOrFail(k8s *KubeManager, model *Model, testCase *TestCase, ignoreLoopback,
-	reachTargetPod, measureBandWidth bool,
-) int {
+// ValidateOrFail validates connectivity, probing the matrix as configured by opts, the wrong pairs are probed
+// again following the retry policy of opts
+func ValidateOrFail(ctx context.Context, prober Prober, model *Model, testCase *TestCase, opts *ProbeOptions) int {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
 	var wrong int
+	measureBandWidth := opts.GetMode() == ProbeModeBandwidth
 
 	// 1st try
 	zap.L().Info("Validating reachability matrix, first try.")
-	ProbePodToPodConnectivity(k8s, model, testCase, reachTargetPod, measureBandWidth)
+	start := time.Now()
+	ProbePodToPodConnectivity(ctx, prober, model, testCase, opts)
 
-	// 2nd try, in case first one failed
-	if _, wrong, _, _ = testCase.Reachability.Summary(ignoreLoopback, measureBandWidth); wrong != 0 {
-		zap.L().Warn("Failed first probe with wrong results, retrying...", zap.Int("wrong", wrong))
-		ProbePodToPodConnectivity(k8s, model, testCase, reachTargetPod, measureBandWidth)
-	}
+	// next tries, only on the wrong pairs, as configured by the retry policy
+	retryWrongPairs(ctx, prober, model, []*TestCase{testCase}, opts, start)
 
 	// at this point we know if we passed or failed, print final matrix and pass/fail the test.
-	if _, wrong, _, _ = testCase.Reachability.Summary(ignoreLoopback, measureBandWidth); wrong != 0 {
-		testCase.Reachability.PrintSummary(true, true, true, measureBandWidth)
+	renderer := logRenderer(opts.Renderer)
+	if _, wrong, _, _ = testCase.Reachability.Summary(opts.IgnoreLoopback, measureBandWidth); wrong != 0 {
+		testCase.Reachability.PrintSummary(renderer, true, true, true, measureBandWidth)
 		zap.L().Info("Had wrong results in reachability matrix", zap.Int("wrong", wrong))
+		printAnalysis(testCase, opts.IgnoreLoopback)
 	}
-	testCase.Reachability.PrintSummary(true, true, true, measureBandWidth)
+	testCase.Reachability.PrintSummary(renderer, true, true, true, measureBandWidth)
+	writeResults(opts, testCase)
+	writeRenders(opts, measureBandWidth, testCase)
+	collectResult(opts, testCase, wrong)
 
 	if wrong == 0 {
 		zap.L().Info("Tests passed, validation succeeded!")
@@ -90,6 +92,42 @@ func ValidateAndMeasureBandwidthOrFail(k8s *KubeManager, model *Model, testCase
 	return wrong
 }
 
+// ValidateIPFamiliesOrFail validates connectivity once per IP family, with the test case built for the family,
+// and returns the number of wrong results over all the families
+func ValidateIPFamiliesOrFail(ctx context.Context, prober Prober, model *Model, families []v1.IPFamily,
+	newTestCase func(family v1.IPFamily) *TestCase, opts *ProbeOptions) int {
+	var wrong int
+	results := make([]string, 0, len(families))
+	for _, family := range families {
+		zap.L().Info("Validating IP family.", zap.String("family", string(family)))
+		testCase := newTestCase(family)
+		testCase.IPFamily = family
+		familyWrong := ValidateOrFail(ctx, prober, model, testCase, opts)
+		results = append(results, fmt.Sprintf("%s: wrong %d", family, familyWrong))
+		wrong += familyWrong
+	}
+	zap.L().Info(fmt.Sprintf("IP families results (%t): %s", wrong == 0, strings.Join(results, ", ")))
+	return wrong
+}
+
+// ValidateAndMeasureBandwidthOrFail validates connectivity and also measure bandwidth,
+// it probes the matrix with opts in ProbeModeBandwidth
+func ValidateAndMeasureBandwidthOrFail(ctx context.Context, prober Prober, model *Model, testCase *TestCase, opts *ProbeOptions) int {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	return ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeBandwidth))
+}
+
+// ValidateAndMeasureLatencyOrFail validates connectivity and also measure the latency of the connects,
+// it probes the matrix with opts in ProbeModeLatency
+func ValidateAndMeasureLatencyOrFail(ctx context.Context, prober Prober, model *Model, testCase *TestCase, opts *ProbeOptions) int {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	return ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeLatency))
+}
+
 // todo(knabben) - make a generic in slice contains function
 func protocolOnSlice(value v1.Protocol, slice []v1.Protocol) bool {
 	for _, item := range slice {
@@ -100,6 +138,15 @@ func protocolOnSlice(value v1.Protocol, slice []v1.Protocol) bool {
 	return false
 }
 
+func stringOnSlice(value string, slice []string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
 func intOnSlice(value int32, slice []int32) bool {
 	for _, item := range slice {
 		if item == value {
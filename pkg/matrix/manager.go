@@ -3,6 +3,8 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 	"time"
 
@@ -22,24 +24,33 @@ import (
 
 const (
 	waitInterval = 1 * time.Second
+	// ncTries is the number of netcat connections tried before a pod is unreachable
+	ncTries = 3
+	// ncTryOverhead is the time a netcat try spends out of its wait, running the exec and starting the process
+	ncTryOverhead = 2 * time.Second
 )
 
 // KubeManager is the core struct to manage kubernetes entities
 type KubeManager struct {
-	config    *rest.Config
-	clientSet *kubernetes.Clientset
+	clientSet kubernetes.Interface
+	executor  ek.PodExecutor
 
 	// Pods keep in pending state and cannot get scheduled
 	PendingPods map[string]int
 }
 
-// NewKubeManager returns a new KubeManager
-func NewKubeManager(cs *kubernetes.Clientset, config *rest.Config) *KubeManager {
-	return &KubeManager{clientSet: cs, config: config, PendingPods: map[string]int{}}
+// NewKubeManager returns a new KubeManager, executing the probes through the API server
+func NewKubeManager(cs kubernetes.Interface, config *rest.Config) *KubeManager {
+	return NewKubeManagerWithExecutor(cs, ek.NewSPDYExecutor(config, cs))
+}
+
+// NewKubeManagerWithExecutor returns a new KubeManager executing the probes with executor
+func NewKubeManagerWithExecutor(cs kubernetes.Interface, executor ek.PodExecutor) *KubeManager {
+	return &KubeManager{clientSet: cs, executor: executor, PendingPods: map[string]int{}}
 }
 
 // GetClientSet returns the Kubernetes clientset
-func (k *KubeManager) GetClientSet() *kubernetes.Clientset {
+func (k *KubeManager) GetClientSet() kubernetes.Interface {
 	return k.clientSet
 }
 
@@ -65,7 +76,7 @@ func (k *KubeManager) StartPodsInNamespace(_ *Model, nodes []*v1.Node, namespace
 }
 
 // StartPods start all pods and wait them to be up
-func (k *KubeManager) StartPods(model *Model, nodes []*v1.Node) error {
+func (k *KubeManager) StartPods(ctx context.Context, model *Model, nodes []*v1.Node) error {
 	zap.L().Info("Creating test pods in the cluster.")
 	for _, ns := range model.Namespaces { // create namespaces
 		// Check size of nodes and already modeled pods
@@ -78,7 +89,7 @@ func (k *KubeManager) StartPods(model *Model, nodes []*v1.Node) error {
 	}
 	// waiting for pods running.
 	for _, createdPod := range model.AllPods() {
-		if err := k.WaitAndSetIPs(createdPod); err != nil {
+		if err := k.WaitAndSetIPs(ctx, createdPod); err != nil {
 			return err
 		}
 	}
@@ -86,13 +97,13 @@ func (k *KubeManager) StartPods(model *Model, nodes []*v1.Node) error {
 }
 
 // WaitAndSetIPs wait for running pods and set internal pod and host IP addresses.
-func (k *KubeManager) WaitAndSetIPs(modelPod *entities.Pod) error {
+func (k *KubeManager) WaitAndSetIPs(ctx context.Context, modelPod *entities.Pod) error {
 	var err error
 
 	kubePod := modelPod.ToK8SSpec()
 	zap.L().Debug("Wait for pod running.", zap.String("name", modelPod.Name), zap.String("namespace", modelPod.Namespace))
 
-	if err := ek.WaitForPodRunningInNamespace(k.clientSet, kubePod, k.PendingPods); err != nil {
+	if err := ek.WaitForPodRunningInNamespace(ctx, k.clientSet, kubePod, k.PendingPods); err != nil {
 		return errors.Wrapf(err, "unable to wait for pod %s/%s", modelPod.Namespace, modelPod.Name)
 	}
 
@@ -103,11 +114,34 @@ func (k *KubeManager) WaitAndSetIPs(modelPod *entities.Pod) error {
 		}
 		modelPod.SetPodIP(kubePod.Status.PodIP)
 		modelPod.SetHostIP(kubePod.Status.HostIP)
+		podIPs := make([]string, len(kubePod.Status.PodIPs))
+		for i, podIP := range kubePod.Status.PodIPs {
+			podIPs[i] = podIP.IP
+		}
+		modelPod.SetPodIPs(podIPs)
+		modelPod.SetHostIPs(k.nodeIPs(ctx, kubePod.Spec.NodeName, kubePod.Status.HostIP))
 	}
 	modelPod.SetNodeName(kubePod.Spec.NodeName)
 	return nil
 }
 
+// nodeIPs returns the internal IPs of the node, one per IP family on dual-stack clusters, the primary
+// host IP first. Only the host IP is returned if the node can not be read.
+func (k *KubeManager) nodeIPs(ctx context.Context, nodeName, hostIP string) []string {
+	ips := []string{hostIP}
+	node, err := k.clientSet.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		zap.L().Debug("Unable to get the node IPs.", zap.String("node", nodeName), zap.String("err", err.Error()))
+		return ips
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP && address.Address != hostIP {
+			ips = append(ips, address.Address)
+		}
+	}
+	return ips
+}
+
 // CreatePod is a convenience function for pod setup
 func (k *KubeManager) CreatePod(podSpec *v1.Pod) (*v1.Pod, error) {
 	nsName := podSpec.Namespace
@@ -221,63 +255,193 @@ func (k *KubeManager) GetPod(ns, name string) (*v1.Pod, error) {
 	return kubePod, nil
 }
 
+// Probe execs into the source pod of the job and runs the command matching the job mode
+func (k *KubeManager) Probe(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	podFrom, addrTo := job.PodFrom, job.Address()
+	var result *ProbeJobResults
+	switch job.Mode {
+	case ProbeModeBandwidth:
+		result = k.ProbeConnectivityIPerf(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
+		)
+	case ProbeModeLatency:
+		result = k.ProbeConnectivityLatency(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
+		)
+	case ProbeModeHTTP:
+		result = k.ProbeConnectivityHTTP(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort, job.GetExpectedStatus(),
+		)
+	case ProbeModeClientIP:
+		result = k.ProbeConnectivityClientIP(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
+		)
+	case ProbeModeReachTargetPod:
+		result = k.ProbeConnectivityWithNc(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
+		)
+	default:
+		result = k.ProbeConnectivity(
+			ctx, podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
+		)
+	}
+	result.Job = job
+	return result
+}
+
+// executeClient runs the client command and records its stderr and outcome in a new result,
+// only the errors of the exec itself are reported as result error.
+func (k *KubeManager) executeClient(ctx context.Context, client commands.Client) (string, *ProbeJobResults) {
+	result := &ProbeJobResults{Command: client.DebugString()}
+	stdout, stderr, err := client.Execute(ctx, k.executor)
+	result.Stderr = stderr
+	result.Outcome = ParseOutcome(stderr, err)
+	result.IsConnected = result.Outcome.IsConnected()
+	if result.Outcome == OutcomeExecError || result.Outcome == OutcomeCancelled {
+		result.Err = err
+	}
+	return stdout, result
+}
+
 // ProbeConnectivityIPerf execs into a pod, checks its connectivity and measures bandwidth to another pod.
-func (k *KubeManager) ProbeConnectivityIPerf(nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) (bool, *ProbeJobBandwidthResults, string, error) { // nolint
+func (k *KubeManager) ProbeConnectivityIPerf(ctx context.Context, nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) *ProbeJobResults { // nolint
 	iperf := commands.NewIPerfClient(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol)
-	commandDebugString := iperf.DebugString()
-	zap.L().Debug("commandDebugString " + commandDebugString)
-	stdout, stderr, err := iperf.Execute(k.config, k.clientSet)
-	if err != nil {
-		zap.L().Debug("Stderr from iperf client: ", zap.String("stderr", stderr))
+	zap.L().Debug("commandDebugString " + iperf.DebugString())
+	stdout, result := k.executeClient(ctx, iperf)
+	if !result.IsConnected {
+		zap.L().Debug("Stderr from iperf client: ", zap.String("stderr", result.Stderr))
 		zap.L().Debug("Stdout from iperf client: ", zap.String("stdout", stdout))
-		return false, nil, commandDebugString, nil
+		return result
 	}
 	bandwidthResult := &ProbeJobBandwidthResults{}
 	if err := bandwidthResult.FromCommaSeparatedString(stdout); err != nil {
-		return false, nil, commandDebugString, err
+		result.IsConnected, result.Outcome, result.Err = false, OutcomeFailed, err
+		return result
+	}
+	result.Bandwidth = bandwidthResult
+	return result
+}
+
+// ProbeConnectivityLatency fails the latency probes of the pods without probe agent. The connects are timed by
+// the probe agent in process, timing a command per connect in a shell would time the start-up of the command.
+func (k *KubeManager) ProbeConnectivityLatency(_ context.Context, nsFrom, podFrom, _, addrTo string, _ v1.Protocol, _ int) *ProbeJobResults { // nolint
+	return &ProbeJobResults{
+		Command: "latency",
+		Outcome: OutcomeExecError,
+		Err:     errors.Errorf("%s/%s -> %s: the latency is measured by the probe agent sidecar", nsFrom, podFrom, addrTo),
+	}
+}
+
+// ProbeConnectivityHTTP execs into a pod and requests the hostname of another pod over HTTP,
+// the request succeeds when answered with expectedStatus.
+func (k *KubeManager) ProbeConnectivityHTTP(ctx context.Context, nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort, expectedStatus int) *ProbeJobResults { // nolint
+	client := commands.NewHTTPClient(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol)
+	zap.L().Debug("commandDebugString " + client.DebugString())
+	stdout, result := k.executeClient(ctx, client)
+	if !result.IsConnected {
+		zap.L().Debug("Stderr from HTTP client: ", zap.String("stderr", result.Stderr))
+		return result
+	}
+	httpResult := &ProbeJobHTTPResults{}
+	if err := httpResult.FromCurlOutput(stdout); err != nil {
+		result.IsConnected, result.Outcome, result.Err = false, OutcomeFailed, err
+		return result
+	}
+	result.HTTP = httpResult
+	result.Endpoint = httpResult.Body
+	result.Latency = &ProbeJobLatencyResults{Durations: []time.Duration{httpResult.Latency}}
+	if httpResult.StatusCode != expectedStatus {
+		result.IsConnected, result.Outcome = false, OutcomeBadStatus
 	}
-	return true, bandwidthResult, commandDebugString, nil
+	return result
+}
+
+// ProbeConnectivityClientIP execs into a pod and requests the client address seen by the netexec server of another pod.
+func (k *KubeManager) ProbeConnectivityClientIP(ctx context.Context, nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) *ProbeJobResults { // nolint
+	client := commands.NewClientIPClient(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol)
+	zap.L().Debug("commandDebugString " + client.DebugString())
+	stdout, result := k.executeClient(ctx, client)
+	if !result.IsConnected {
+		zap.L().Debug("Stderr from client IP client: ", zap.String("stderr", result.Stderr))
+		return result
+	}
+	httpResult := &ProbeJobHTTPResults{}
+	if err := httpResult.FromCurlOutput(stdout); err != nil {
+		result.IsConnected, result.Outcome, result.Err = false, OutcomeFailed, err
+		return result
+	}
+	result.HTTP = httpResult
+	if httpResult.StatusCode != http.StatusOK {
+		result.IsConnected, result.Outcome = false, OutcomeBadStatus
+		return result
+	}
+	sourceIP, _, err := net.SplitHostPort(httpResult.Body)
+	if err != nil {
+		result.IsConnected, result.Outcome, result.Err = false, OutcomeFailed, errors.Wrapf(err, "invalid client address %q", httpResult.Body)
+		return result
+	}
+	result.SourceIP = sourceIP
+	return result
 }
 
 // ProbeConnectivity execs into a pod and checks its connectivity to another pod.
-func (k *KubeManager) ProbeConnectivity(nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) (bool, string, error) { // nolint
+func (k *KubeManager) ProbeConnectivity(ctx context.Context, nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) *ProbeJobResults { // nolint
 	agnHost := commands.NewAgnHostClient(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol)
-	commandDebugString := agnHost.DebugString()
-	_, stderr, err := agnHost.Execute(k.config, k.clientSet)
-	zap.L().Debug(
-		fmt.Sprintf("Can't connect: %s/%s -> %s", nsFrom, podFrom, addrTo),
-		zap.String("stderr", stderr), zap.Error(err),
-	)
-	if err != nil {
-		return false, commandDebugString, nil
+	_, result := k.executeClient(ctx, agnHost)
+	if !result.IsConnected {
+		zap.L().Debug(
+			fmt.Sprintf("Can't connect: %s/%s -> %s", nsFrom, podFrom, addrTo),
+			zap.String("stderr", result.Stderr), zap.String("outcome", string(result.Outcome)),
+		)
 	}
-	return true, commandDebugString, nil
+	return result
 }
 
-// ProbeConnectivityWithNc execs into a pod and connect the endpoint, return endpoint
-func (k *KubeManager) ProbeConnectivityWithNc(nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) (bool, string, string, error) { // nolint
-	nc := commands.NewNcClient(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol)
-	commandDebugString := nc.DebugString()
-	zap.L().Debug("commandDebugString " + commandDebugString)
+// ProbeConnectivityWithNc execs into a pod and connect the endpoint, return endpoint. The netcat wait is shrunk
+// so the ncTries tries fit in the deadline of ctx.
+func (k *KubeManager) ProbeConnectivityWithNc(ctx context.Context, nsFrom, podFrom, containerFrom, addrTo string, protocol v1.Protocol, toPort int) *ProbeJobResults { // nolint
+	var budget time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	}
+	nc := commands.NewNcClientWithWait(nsFrom, podFrom, containerFrom, addrTo, toPort, protocol, ncWait(budget, ncTries))
+	zap.L().Debug("commandDebugString " + nc.DebugString())
 
-	maxRetries := 3
 	var stdout string
-	var err error
-
-	for i := 0; i < maxRetries; i++ {
-		stdout, _, err := nc.Execute(k.config, k.clientSet)
-		if err == nil {
-			ep := strings.TrimSpace(stdout)
-			return true, ep, commandDebugString, nil
+	result := &ProbeJobResults{Command: nc.DebugString(), Outcome: OutcomeCancelled, Err: ctx.Err()}
+	for i := 0; i < ncTries && ctx.Err() == nil; i++ {
+		stdout, result = k.executeClient(ctx, nc)
+		if result.IsConnected {
+			result.Endpoint = strings.TrimSpace(stdout)
+			return result
 		}
 	}
-	return false, "", commandDebugString, errors.Wrapf(err, fmt.Sprintf("%s/%s -> %s: error when running command:"+
-		" err - %v /// stdout - %s", nsFrom, podFrom, addrTo, err, stdout))
+	if result.Err == nil {
+		result.Err = errors.Errorf("%s/%s -> %s: %s after %d tries: stdout - %s /// stderr - %s",
+			nsFrom, podFrom, addrTo, result.Outcome, ncTries, stdout, result.Stderr)
+	}
+	return result
+}
+
+// ncWait returns the netcat wait of each of the tries so they all fit in budget, up to commands.DefaultNcWait
+// and at least a second. A budget of 0 is unbounded.
+func ncWait(budget time.Duration, tries int) time.Duration {
+	if budget <= 0 || tries < 1 {
+		return commands.DefaultNcWait
+	}
+	wait := budget/time.Duration(tries) - ncTryOverhead
+	if wait > commands.DefaultNcWait {
+		return commands.DefaultNcWait
+	}
+	if wait < time.Second {
+		return time.Second
+	}
+	return wait
 }
 
 // executeRemoteCommand executes a remote shell command on the given pod.
-func (k *KubeManager) executeRemoteCommand(namespace, pod, containerName string, command []string) (string, string, error) { // nolint
-	return ek.ExecWithOptions(k.config, k.clientSet, &ek.ExecOptions{
+func (k *KubeManager) executeRemoteCommand(ctx context.Context, namespace, pod, containerName string, command []string) (string, string, error) { // nolint
+	return k.executor.Exec(ctx, &ek.ExecOptions{
 		Command:            command,
 		Namespace:          namespace,
 		PodName:            pod,
@@ -290,7 +454,7 @@ func (k *KubeManager) executeRemoteCommand(namespace, pod, containerName string,
 }
 
 // WaitForHTTPServers waits for all webservers to be up, on all protocols, and then validates them using the same probe logic as the rest of the suite.
-func (k *KubeManager) WaitForHTTPServers(model *Model) error {
+func (k *KubeManager) WaitForHTTPServers(ctx context.Context, model *Model) error {
 	zap.L().Info("Waiting for HTTP servers (ports 80 and 81) to become ready")
 
 	testCases := map[string]*TestCase{}
@@ -317,7 +481,7 @@ func (k *KubeManager) WaitForHTTPServers(model *Model) error {
 			}
 			reachability := NewReachability(model.AllPods(), true)
 			testCase.Reachability = reachability
-			ProbePodToPodConnectivity(k, model, testCase, false, false)
+			ProbePodToPodConnectivity(ctx, k, model, testCase, DefaultProbeOptions())
 			_, wrong, _, _ := reachability.Summary(false, false)
 			if wrong == 0 {
 				zap.L().Debug("Server is ready", zap.String("case", caseName))
@@ -330,13 +494,50 @@ func (k *KubeManager) WaitForHTTPServers(model *Model) error {
 			zap.L().Info("Pods are ready, starting the test suite.")
 			return nil
 		}
-		time.Sleep(waitInterval)
+		select {
+		case <-time.After(waitInterval):
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "stopped waiting for HTTP servers")
+		}
 	}
 	return errors.Errorf("after %d tries, %d HTTP servers are not ready", maxTries, len(notReady))
 }
 
+// SCTPSupported checks the SCTP servers of the pods answer on their own loopback, the nodes lacking
+// the SCTP kernel module cannot open SCTP sockets.
+func (k *KubeManager) SCTPSupported(ctx context.Context, pods []*entities.Pod) bool {
+	const maxTries = 3
+	for _, pod := range pods {
+		for _, container := range pod.Containers {
+			if container.Protocol != v1.ProtocolSCTP {
+				continue
+			}
+			var result *ProbeJobResults
+			for i := 0; i < maxTries; i++ {
+				result = k.ProbeConnectivity(ctx, pod.Namespace, pod.Name, container.GetName(), "127.0.0.1", v1.ProtocolSCTP, int(container.Port))
+				if result.IsConnected || i == maxTries-1 {
+					break
+				}
+				select {
+				case <-time.After(waitInterval):
+				case <-ctx.Done():
+					return false
+				}
+			}
+			if !result.IsConnected {
+				zap.L().Warn("SCTP is not supported.",
+					zap.String("node", pod.GetNodeName()), zap.String("pod", pod.Name),
+					zap.String("outcome", string(result.Outcome)), zap.String("stderr", result.Stderr),
+				)
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // CreateServiceFromTemplate creates k8s service based on template
-func CreateServiceFromTemplate(cs *kubernetes.Clientset, t entities.ServiceTemplate) (string, ek.ServiceBase, string, error) { //nolint
+func CreateServiceFromTemplate(ctx context.Context, cs kubernetes.Interface, t entities.ServiceTemplate) (string, ek.ServiceBase, string, error) { //nolint
 	entities.IncreaseServiceID()
 
 	servicePorts := make([]v1.ServicePort, len(t.ProtocolPorts))
@@ -356,11 +557,15 @@ func CreateServiceFromTemplate(cs *kubernetes.Clientset, t entities.ServiceTempl
 		Spec: v1.ServiceSpec{
 			Selector: t.Selector,
 			Ports:    servicePorts,
+			Type:     t.Type,
 		},
 	}
 	if t.SessionAffinity {
 		s.Spec.SessionAffinity = "ClientIP"
 	}
+	if t.IPFamilyPolicy != nil {
+		entities.WithIPFamilies(s, *t.IPFamilyPolicy, t.IPFamilies...)
+	}
 
 	var service ek.ServiceBase = ek.NewService(cs, s)
 	if _, err := service.Create(); err != nil {
@@ -368,18 +573,19 @@ func CreateServiceFromTemplate(cs *kubernetes.Clientset, t entities.ServiceTempl
 	}
 
 	// wait for final status
-	clusterIP, err := service.WaitForClusterIP()
+	clusterIP, err := service.WaitForClusterIP(ctx)
 	if err != nil || clusterIP == "" {
 		return "", nil, "", errors.Wrapf(err, "no cluster IP available")
 	}
 	return s.Name, service, clusterIP, nil
 }
 
-func (k *KubeManager) InitializePod(pod *entities.Pod) error {
+// InitializePod creates the pod and waits for it to be running
+func (k *KubeManager) InitializePod(ctx context.Context, pod *entities.Pod) error {
 	if _, err := k.CreatePod(pod.ToK8SSpec()); err != nil {
 		return err
 	}
-	if err := k.WaitAndSetIPs(pod); err != nil {
+	if err := k.WaitAndSetIPs(ctx, pod); err != nil {
 		return err
 	}
 
@@ -0,0 +1,234 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/consts"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	ek "github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+)
+
+// stubExecutor is a PodExecutor returning the same output for every command
+type stubExecutor struct {
+	stdout, stderr string
+	err            error
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func (s *stubExecutor) Exec(_ context.Context, options *ek.ExecOptions) (stdout, stderr string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, options.Command)
+	return s.stdout, s.stderr, s.err
+}
+
+var _ = Describe("kube manager with fake clientset", func() {
+	var (
+		ctx      context.Context
+		cs       *fake.Clientset
+		executor *stubExecutor
+		manager  *KubeManager
+		model    *Model
+		pods     []*entities.Pod
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cs = fake.NewSimpleClientset()
+		executor = &stubExecutor{}
+		manager = NewKubeManagerWithExecutor(cs, executor)
+		model = newFakeModel()
+		pods = model.AllPods()
+		for _, pod := range pods {
+			_, err := manager.CreatePod(pod.ToK8SSpec())
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("should add and remove labels of a pod", func() {
+		Expect(manager.AddLabelToPod(pods[0], "app", "test")).To(Succeed())
+		kubePod, err := manager.GetPod(pods[0].Namespace, pods[0].Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubePod.Labels).To(HaveKeyWithValue("app", "test"))
+
+		Expect(manager.RemoveLabelFromPod(pods[0], "app")).To(Succeed())
+		kubePod, err = manager.GetPod(pods[0].Namespace, pods[0].Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubePod.Labels).NotTo(HaveKey("app"))
+	})
+
+	It("should set the IPs of a running pod", func() {
+		kubePod, err := manager.GetPod(pods[0].Namespace, pods[0].Name)
+		Expect(err).NotTo(HaveOccurred())
+		kubePod.Status = v1.PodStatus{Phase: v1.PodRunning, PodIP: "10.244.1.2", HostIP: "172.18.0.2"}
+		_, err = cs.CoreV1().Pods(pods[0].Namespace).UpdateStatus(ctx, kubePod, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.WaitAndSetIPs(ctx, pods[0])).To(Succeed())
+		Expect(pods[0].GetPodIP()).To(Equal("10.244.1.2"))
+		Expect(pods[0].GetHostIP()).To(Equal("172.18.0.2"))
+	})
+
+	It("should set all the IPs of a running pod on a dual-stack cluster", func() {
+		kubePod, err := manager.GetPod(pods[0].Namespace, pods[0].Name)
+		Expect(err).NotTo(HaveOccurred())
+		kubePod.Status = v1.PodStatus{
+			Phase: v1.PodRunning, PodIP: "10.244.1.2", HostIP: "172.18.0.2",
+			PodIPs: []v1.PodIP{{IP: "10.244.1.2"}, {IP: "fd00:10:244:1::2"}},
+		}
+		_, err = cs.CoreV1().Pods(pods[0].Namespace).UpdateStatus(ctx, kubePod, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cs.CoreV1().Nodes().Create(ctx, &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: kubePod.Spec.NodeName},
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "172.18.0.2"},
+				{Type: v1.NodeInternalIP, Address: "fc00:f853:ccd:e793::2"},
+				{Type: v1.NodeHostName, Address: kubePod.Spec.NodeName},
+			}},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.WaitAndSetIPs(ctx, pods[0])).To(Succeed())
+		Expect(pods[0].PodIPs).To(Equal([]string{"10.244.1.2", "fd00:10:244:1::2"}))
+		Expect(pods[0].GetHostIPByFamily(v1.IPv6Protocol)).To(Equal("fc00:f853:ccd:e793::2"))
+		Expect(model.IPFamilies()).To(Equal([]v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}))
+	})
+
+	It("should remove the stale pending pods", func() {
+		pendingPod, runningPod := pods[1].Name, pods[0].Name
+		manager.PendingPods[pendingPod] = consts.PollTimesToDeterminePendingPod + 1
+		Expect(manager.RemovePendingPodsInNamespace(model, "ns-1")).To(Succeed())
+
+		Expect(manager.PendingPods).To(BeEmpty())
+		Expect(model.AllPods()).To(HaveLen(2))
+		_, err := manager.GetPod("ns-1", pendingPod)
+		Expect(err).To(HaveOccurred())
+		_, err = manager.GetPod("ns-1", runningPod)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should probe through the executor", func() {
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeConnect,
+		}
+		result := manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(executor.commands).To(HaveLen(1))
+		Expect(executor.commands[0]).To(ContainElement("10.0.0.2:80"))
+
+		Expect(result.Outcome).To(Equal(OutcomeConnected))
+
+		executor.stderr = "TIMEOUT"
+		executor.err = utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+		result = manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Outcome).To(Equal(OutcomeTimeout))
+		Expect(result.Err).NotTo(HaveOccurred())
+	})
+
+	It("should leave the latency to the probe agent", func() {
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeLatency,
+		}
+		result := manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Outcome).To(Equal(OutcomeExecError))
+		Expect(result.Err).To(MatchError(ContainSubstring("probe agent")))
+		Expect(executor.commands).To(BeEmpty())
+	})
+
+	It("should parse the HTTP responses", func() {
+		executor.stdout = "pod-2\n200 0.001500"
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeHTTP,
+		}
+		result := manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(result.Endpoint).To(Equal("pod-2"))
+		Expect(result.HTTP.StatusCode).To(Equal(200))
+		Expect(result.Latency.Durations).To(Equal([]time.Duration{1500 * time.Microsecond}))
+		Expect(executor.commands[0]).To(ContainElement("http://10.0.0.2:80/hostname"))
+
+		executor.stdout = "service unavailable\n503 0.000800"
+		result = manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Outcome).To(Equal(OutcomeBadStatus))
+
+		job.ExpectedStatus = 503
+		result = manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeTrue())
+	})
+
+	It("should parse the client IP seen by the target", func() {
+		executor.stdout = "10.0.0.1:43512\n200 0.001000"
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeClientIP,
+		}
+		result := manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeTrue())
+		Expect(result.SourceIP).To(Equal("10.0.0.1"))
+		Expect(executor.commands[0]).To(ContainElement("http://10.0.0.2:80/clientip"))
+
+		executor.stdout = "not an address\n200 0.001000"
+		result = manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Err).To(HaveOccurred())
+	})
+
+	It("should shrink the netcat wait so the tries fit in the probe timeout", func() {
+		executor.stderr = "TIMEOUT"
+		executor.err = utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeReachTargetPod, Timeout: 15 * time.Second,
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+		result := manager.Probe(probeCtx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(executor.commands).To(HaveLen(ncTries))
+		Expect(executor.commands[0]).To(ContainElement("-w2"))
+
+		Expect(ncWait(consts.DefaultProbeTimeout, ncTries)).To(Equal(8 * time.Second))
+		Expect(ncWait(0, ncTries)).To(Equal(10 * time.Second))
+		Expect(ncWait(time.Second, ncTries)).To(Equal(time.Second))
+	})
+
+	It("should report the exec failures as errors", func() {
+		executor.err = errors.New("unable to upgrade connection: pod does not exist")
+		job := &ProbeJob{
+			PodFrom: pods[0], PodTo: pods[1], ToPort: 80, Protocol: v1.ProtocolTCP,
+			ServiceType: entities.PodIP, Mode: ProbeModeConnect,
+		}
+		result := manager.Probe(ctx, job)
+		Expect(result.IsConnected).To(BeFalse())
+		Expect(result.Outcome).To(Equal(OutcomeExecError))
+		Expect(result.Err).To(MatchError(executor.err))
+	})
+
+	It("should check the SCTP servers answer on their loopback", func() {
+		sctpModel := NewModel([]string{"ns-sctp"}, []string{"pod-1"}, []int32{80}, []v1.Protocol{v1.ProtocolSCTP}, "cluster.local")
+		Expect(manager.SCTPSupported(ctx, sctpModel.AllPods())).To(BeTrue())
+		Expect(executor.commands[0]).To(Equal([]string{"/agnhost", "connect", "127.0.0.1:80", "--timeout=5s", "--protocol=sctp"}))
+
+		executor.stderr = "socket: protocol not supported"
+		executor.err = utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+		Expect(manager.SCTPSupported(ctx, sctpModel.AllPods())).To(BeFalse())
+	})
+})
@@ -105,6 +105,26 @@ func (m *Model) AllPods() []*entities.Pod {
 	return *m.pods
 }
 
+// AddProbeAgents adds the probe agent sidecar to all the pods, before they are started
+func (m *Model) AddProbeAgents(image entities.ContainerImage) {
+	for _, pod := range m.AllPods() {
+		pod.AddProbeAgent(image)
+	}
+}
+
+// IPFamilies returns the IP families of the pods addresses, IPv4 and IPv6 on dual-stack clusters
+func (m *Model) IPFamilies() []v1.IPFamily {
+	var families []v1.IPFamily
+	for _, pod := range m.AllPods() {
+		for _, family := range pod.IPFamilies() {
+			if !entities.IPFamilyOnSlice(family, families) {
+				families = append(families, family)
+			}
+		}
+	}
+	return families
+}
+
 func (m *Model) ResetAllPods() {
 	pods := m.AllPods()
 	for _, p := range pods {
@@ -0,0 +1,153 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultMonitorInterval is the wait between two rounds of the monitor
+const DefaultMonitorInterval = 30 * time.Second
+
+// MonitorCase is a matrix probed again on each round of the monitor
+type MonitorCase struct {
+	// Name tells apart the matrix in the transitions, e.g. "nodeport-tcp"
+	Name string
+	// NewTestCase returns the test case of a round, with a new reachability
+	NewTestCase func() *TestCase
+}
+
+// Transition is a change of the connectivity of a pair between two rounds of the monitor
+type Transition struct {
+	Time      time.Time `json:"time"`
+	Matrix    string    `json:"matrix"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Connected bool      `json:"connected"`
+	// Outcome is the reason of the connectivity observed by the round, e.g. a timeout
+	Outcome Outcome `json:"outcome,omitempty"`
+}
+
+// String returns the transition as a log line, e.g. "... nodeport-tcp x/a -> x/b: reachable -> unreachable (timeout)"
+func (t *Transition) String() string {
+	before, after := "unreachable", "reachable"
+	if !t.Connected {
+		before, after = after, before
+	}
+	s := fmt.Sprintf("%s %s %s -> %s: %s -> %s", t.Time.Format(time.RFC3339), t.Matrix, t.From, t.To, before, after)
+	if t.Outcome != OutcomeUnknown && !t.Outcome.IsConnected() {
+		s += fmt.Sprintf(" (%s)", t.Outcome)
+	}
+	return s
+}
+
+// Monitor probes the matrices of its cases on an interval, keeping the pods and services in place, and reports
+// only the pairs whose connectivity changed since the previous round, e.g. during a node upgrade.
+type Monitor struct {
+	prober Prober
+	model  *Model
+	opts   *ProbeOptions
+	cases  []*MonitorCase
+
+	// Interval is the wait between two rounds, DefaultMonitorInterval if zero
+	Interval time.Duration
+	// Export receives each transition as a JSON line if not nil
+	Export io.Writer
+
+	// last keeps the connectivity of each pair of each case seen by the previous rounds
+	last map[string]map[Pair]bool
+}
+
+// NewMonitor returns a monitor probing the matrices of the cases with the prober
+func NewMonitor(prober Prober, model *Model, opts *ProbeOptions, cases ...*MonitorCase) *Monitor {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
+	return &Monitor{
+		prober: prober,
+		model:  model,
+		opts:   opts,
+		cases:  cases,
+		last:   map[string]map[Pair]bool{},
+	}
+}
+
+// Round probes the matrices of all the cases once, and returns the transitions of the pairs since the previous
+// round. The first round only records the connectivity of the pairs, and the cancelled probes are ignored.
+func (m *Monitor) Round(ctx context.Context) []*Transition {
+	testCases := make([]*TestCase, len(m.cases))
+	for i, monitorCase := range m.cases {
+		testCases[i] = monitorCase.NewTestCase()
+	}
+	probeTestCases(ctx, m.prober, m.model, testCases, nil, m.opts)
+	now := time.Now()
+
+	var transitions []*Transition
+	for i, monitorCase := range m.cases {
+		observed := testCases[i].Reachability.Observed
+		last, seen := m.last[monitorCase.Name]
+		if !seen {
+			last = map[Pair]bool{}
+			m.last[monitorCase.Name] = last
+		}
+		reachable, total := 0, 0
+		for _, from := range observed.Froms {
+			for _, to := range observed.Tos {
+				connected, ok := observed.Values[from][to]
+				if !ok || observed.IsCancelled(from, to) {
+					continue
+				}
+				pair := Pair{From: from, To: to}
+				if previous, ok := last[pair]; ok && previous != connected {
+					transitions = append(transitions, &Transition{
+						Time: now, Matrix: monitorCase.Name, From: from, To: to,
+						Connected: connected, Outcome: observed.GetOutcome(from, to),
+					})
+				}
+				last[pair] = connected
+				total++
+				if connected {
+					reachable++
+				}
+			}
+		}
+		if !seen {
+			zap.L().Info(fmt.Sprintf("Monitoring %s: %d/%d pairs reachable", monitorCase.Name, reachable, total))
+		}
+	}
+	return transitions
+}
+
+// Run probes the matrices on each interval until ctx is done, logging the transitions and writing them to Export.
+// An error is returned only if a transition could not be exported.
+func (m *Monitor) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	var encoder *json.Encoder
+	if m.Export != nil {
+		encoder = json.NewEncoder(m.Export)
+	}
+
+	for {
+		for _, transition := range m.Round(ctx) {
+			zap.L().Warn(transition.String())
+			if encoder != nil {
+				if err := encoder.Encode(transition); err != nil {
+					return errors.Wrap(err, "failed to export transition")
+				}
+			}
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
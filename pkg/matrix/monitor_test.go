@@ -0,0 +1,81 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("monitor", func() {
+	var (
+		ctx     context.Context
+		model   *Model
+		pods    []*entities.Pod
+		cases   []*MonitorCase
+		prober  *FakeProber
+		monitor *Monitor
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = newFakeModel()
+		pods = model.AllPods()
+		cases = []*MonitorCase{{Name: "nodeport-tcp", NewTestCase: func() *TestCase {
+			return &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.NodePort, Reachability: NewReachability(pods, true)}
+		}}}
+		prober = NewFakeProber(&FakeRule{Connected: true})
+		monitor = NewMonitor(prober, model, DefaultProbeOptions(), cases...)
+	})
+
+	It("should report only the pairs changing between rounds", func() {
+		Expect(monitor.Round(ctx)).To(BeEmpty())
+		Expect(monitor.Round(ctx)).To(BeEmpty())
+
+		prober.Rules = append([]*FakeRule{{To: &Peer{Pod: "pod-2"}, Connected: false, Outcome: OutcomeRefused}}, prober.Rules...)
+		transitions := monitor.Round(ctx)
+		Expect(transitions).To(HaveLen(3))
+		for _, transition := range transitions {
+			Expect(transition.Matrix).To(Equal("nodeport-tcp"))
+			Expect(transition.To).To(Equal(pods[1].PodString().String()))
+			Expect(transition.Connected).To(BeFalse())
+			Expect(transition.Outcome).To(Equal(OutcomeRefused))
+			Expect(transition.String()).To(HaveSuffix("reachable -> unreachable (refused)"))
+		}
+		Expect(monitor.Round(ctx)).To(BeEmpty())
+
+		prober.Rules = prober.Rules[1:]
+		transitions = monitor.Round(ctx)
+		Expect(transitions).To(HaveLen(3))
+		for _, transition := range transitions {
+			Expect(transition.Connected).To(BeTrue())
+			Expect(transition.String()).To(HaveSuffix("unreachable -> reachable"))
+		}
+	})
+
+	It("should export the transitions as JSON lines until done", func() {
+		prober.Rules = []*FakeRule{{To: &Peer{Pod: "pod-3"}, From: &Peer{Pod: "pod-1"}, Connected: true, Failures: 1}, {Connected: true}}
+		var export bytes.Buffer
+		monitor.Interval = 10 * time.Millisecond
+		monitor.Export = &export
+
+		runCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		Expect(monitor.Run(runCtx)).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(export.String()), "\n")
+		Expect(lines).To(HaveLen(1))
+		var transition Transition
+		Expect(json.Unmarshal([]byte(lines[0]), &transition)).To(Succeed())
+		Expect(transition.From).To(Equal(pods[0].PodString().String()))
+		Expect(transition.To).To(Equal(pods[2].PodString().String()))
+		Expect(transition.Connected).To(BeTrue())
+	})
+})
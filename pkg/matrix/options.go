@@ -0,0 +1,248 @@
+package matrix
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/consts"
+)
+
+// ProbeMode defines the kind of probe executed for each pair of pods
+type ProbeMode string
+
+const (
+	// ProbeModeConnect only checks the connection is established, using agnhost connect
+	ProbeModeConnect ProbeMode = "connect"
+	// ProbeModeReachTargetPod checks the connection is responded by the target pod, using netcat
+	ProbeModeReachTargetPod ProbeMode = "reach-target-pod"
+	// ProbeModeBandwidth checks the connection and measures the bandwidth, using iperf
+	ProbeModeBandwidth ProbeMode = "bandwidth"
+	// ProbeModeLatency checks the connection and measures the duration of repeated connects, timed by the probe agent
+	ProbeModeLatency ProbeMode = "latency"
+	// ProbeModeHTTP checks an HTTP request is answered by the target pod with the expected status, using curl
+	ProbeModeHTTP ProbeMode = "http"
+	// ProbeModeClientIP checks the connection and records the client IP seen by an agnhost netexec target, using curl
+	ProbeModeClientIP ProbeMode = "client-ip"
+)
+
+const (
+	// DefaultProbeWorkers is the number of concurrent probes, see https://github.com/kubernetes/kubernetes/pull/97690
+	DefaultProbeWorkers = 4
+	// DefaultProbeRetries is the number of times the matrix is probed again when it has wrong results
+	DefaultProbeRetries = 1
+	// DefaultProbeSamples is the number of probes executed for each pair of pods
+	DefaultProbeSamples = 1
+	// DefaultSuccessThreshold is the ratio of successful samples for a pair to be connected
+	DefaultSuccessThreshold = 1.0
+	// MaxRetryBackoff caps the wait before a retry, doubled on each retry
+	MaxRetryBackoff = 30 * time.Second
+)
+
+// ProbeOptions configures how a matrix is probed, the zero value uses the defaults
+type ProbeOptions struct {
+	// Workers is the number of probes running concurrently, DefaultProbeWorkers if zero
+	Workers int
+	// MaxExecPerNode caps the concurrent probes executed from pods of the same node, no cap if zero
+	MaxExecPerNode int
+	// Retries is the number of times the wrong pairs of the matrix are probed again,
+	// DefaultProbeRetries if zero, no retry if negative
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled on each next retry, no wait if zero
+	RetryBackoff time.Duration
+	// RetryDeadline bounds the time from the first probe after which no retry is started, no bound if zero
+	RetryDeadline time.Duration
+	// Mode is the kind of probe executed for each pair of pods, ProbeModeConnect if empty
+	Mode ProbeMode
+	// IgnoreLoopback does not fail on the probes from a pod to itself
+	IgnoreLoopback bool
+	// Samples is the number of probes executed for each pair of pods, DefaultProbeSamples if zero
+	Samples int
+	// SuccessThreshold is the ratio of successful samples, between 0 and 1, for a pair to be connected,
+	// DefaultSuccessThreshold if zero
+	SuccessThreshold float64
+	// ServiceDNS probes ClusterIP, headless and ExternalName services through their qualified DNS name
+	ServiceDNS bool
+	// OutputDir is the directory the results of each validated test case are written to, not written if empty
+	OutputDir string
+	// OutputFormat is the encoding of the results written to OutputDir, ResultsFormatJSON if empty
+	OutputFormat ResultsFormat
+	// Renderer renders the matrices of the summaries, a TextRenderer if nil
+	Renderer Renderer
+	// ProbeTimeout bounds each probe of a backend distribution, consts.DefaultProbeTimeout if zero,
+	// the probes of a matrix being bounded by its test case
+	ProbeTimeout time.Duration
+	// Deadline bounds the probing of a whole backend distribution, consts.DefaultTestCaseDeadline if zero
+	Deadline time.Duration
+	// DistributionFailureTolerance is the number of failed connections of a client tolerated in a fair
+	// backend distribution, none if zero
+	DistributionFailureTolerance int
+	// Feature and Labels identify the feature validating the test cases in MatrixResults
+	Feature string
+	Labels  []Label
+}
+
+// DefaultProbeOptions returns the options used when none are provided
+func DefaultProbeOptions() *ProbeOptions {
+	return &ProbeOptions{
+		Workers:          DefaultProbeWorkers,
+		Retries:          DefaultProbeRetries,
+		Mode:             ProbeModeConnect,
+		Samples:          DefaultProbeSamples,
+		SuccessThreshold: DefaultSuccessThreshold,
+	}
+}
+
+// GetWorkers returns the number of concurrent probe workers
+func (o *ProbeOptions) GetWorkers() int {
+	if o.Workers <= 0 {
+		return DefaultProbeWorkers
+	}
+	return o.Workers
+}
+
+// GetProbeTimeout returns the timeout of each probe of a backend distribution
+func (o *ProbeOptions) GetProbeTimeout() time.Duration {
+	if o.ProbeTimeout <= 0 {
+		return consts.DefaultProbeTimeout
+	}
+	return o.ProbeTimeout
+}
+
+// GetDeadline returns the deadline for probing a whole backend distribution
+func (o *ProbeOptions) GetDeadline() time.Duration {
+	if o.Deadline <= 0 {
+		return consts.DefaultTestCaseDeadline
+	}
+	return o.Deadline
+}
+
+// GetRetries returns the number of times the matrix is probed again on wrong results
+func (o *ProbeOptions) GetRetries() int {
+	if o.Retries == 0 {
+		return DefaultProbeRetries
+	}
+	if o.Retries < 0 {
+		return 0
+	}
+	return o.Retries
+}
+
+// RetryPolicy configures how the wrong pairs of a matrix are probed again
+type RetryPolicy struct {
+	// Attempts is the number of retries
+	Attempts int
+	// Backoff is the wait before the first retry, doubled on each next retry up to MaxRetryBackoff
+	Backoff time.Duration
+	// Deadline bounds the time from the first probe after which no retry is started, no bound if zero
+	Deadline time.Duration
+}
+
+// GetRetryPolicy returns the retry policy of the options
+func (o *ProbeOptions) GetRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{Attempts: o.GetRetries(), Backoff: o.RetryBackoff, Deadline: o.RetryDeadline}
+}
+
+// GetBackoff returns the wait before the given retry, starting at 1
+func (p *RetryPolicy) GetBackoff(retry int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < retry && backoff < MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxRetryBackoff {
+		return MaxRetryBackoff
+	}
+	return backoff
+}
+
+// GetSamples returns the number of probes executed for each pair of pods
+func (o *ProbeOptions) GetSamples() int {
+	if o.Samples <= 0 {
+		return DefaultProbeSamples
+	}
+	return o.Samples
+}
+
+// GetSuccessThreshold returns the ratio of successful samples for a pair to be connected
+func (o *ProbeOptions) GetSuccessThreshold() float64 {
+	if o.SuccessThreshold <= 0 || o.SuccessThreshold > 1 {
+		return DefaultSuccessThreshold
+	}
+	return o.SuccessThreshold
+}
+
+// GetMode returns the probe mode
+func (o *ProbeOptions) GetMode() ProbeMode {
+	if o.Mode == "" {
+		return ProbeModeConnect
+	}
+	return o.Mode
+}
+
+// GetOutputFormat returns the encoding of the results written to the output directory
+func (o *ProbeOptions) GetOutputFormat() ResultsFormat {
+	if o.OutputFormat == "" {
+		return ResultsFormatJSON
+	}
+	return o.OutputFormat
+}
+
+// WithServiceDNS returns a copy of the options probing the services through their DNS name
+func (o *ProbeOptions) WithServiceDNS() *ProbeOptions {
+	opts := *o
+	opts.ServiceDNS = true
+	return &opts
+}
+
+// WithMode returns a copy of the options using the given probe mode
+func (o *ProbeOptions) WithMode(mode ProbeMode) *ProbeOptions {
+	opts := *o
+	opts.Mode = mode
+	return &opts
+}
+
+// nodeLimiter caps the number of concurrent probes executed from pods of a same node,
+// so the kubelet of a node is not flooded with exec streams
+type nodeLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// newNodeLimiter returns a limiter for limit concurrent probes per node, no limit if zero
+func newNodeLimiter(limit int) *nodeLimiter {
+	return &nodeLimiter{limit: limit, slots: map[string]chan struct{}{}}
+}
+
+func (l *nodeLimiter) nodeSlots(nodeName string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots, ok := l.slots[nodeName]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[nodeName] = slots
+	}
+	return slots
+}
+
+// acquire blocks until a probe can run on the node or ctx is done
+func (l *nodeLimiter) acquire(ctx context.Context, nodeName string) error {
+	if l.limit <= 0 {
+		return nil
+	}
+	select {
+	case l.nodeSlots(nodeName) <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire on the node
+func (l *nodeLimiter) release(nodeName string) {
+	if l.limit <= 0 {
+		return
+	}
+	<-l.nodeSlots(nodeName)
+}
@@ -0,0 +1,113 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// Outcome is the result of a single probe, it tells apart the reasons a connection failed
+type Outcome string
+
+const (
+	// OutcomeUnknown is the outcome of a pair not probed yet
+	OutcomeUnknown Outcome = ""
+	// OutcomeConnected is a successful connection
+	OutcomeConnected Outcome = "connected"
+	// OutcomeSkipped is a probe not executed, considered as connected
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeDNSFailure is a failure to resolve the target name
+	OutcomeDNSFailure Outcome = "dns-failure"
+	// OutcomeRefused is a connection refused by the target, e.g. a service without endpoints
+	OutcomeRefused Outcome = "refused"
+	// OutcomeTimeout is a connection not answered in time, e.g. a broken proxy dropping packets
+	OutcomeTimeout Outcome = "timeout"
+	// OutcomeWrongBackend is a connection answered by another pod than the target one
+	OutcomeWrongBackend Outcome = "wrong-backend"
+	// OutcomeBadStatus is an HTTP request answered with another status code than the expected one
+	OutcomeBadStatus Outcome = "bad-status"
+	// OutcomeUnexpectedSourceIP is a connection where the target saw a source IP not matching the expected policy
+	OutcomeUnexpectedSourceIP Outcome = "unexpected-source-ip"
+	// OutcomeExecError is a failure of the harness to execute the probe in the source pod
+	OutcomeExecError Outcome = "exec-error"
+	// OutcomeCancelled is a probe interrupted by its deadline
+	OutcomeCancelled Outcome = "cancelled"
+	// OutcomeFailed is any other failed connection
+	OutcomeFailed Outcome = "failed"
+)
+
+// outcomeGlyphs are the marks used to print the outcomes in a matrix
+var outcomeGlyphs = map[Outcome]string{
+	OutcomeUnknown:            "?",
+	OutcomeConnected:          ".",
+	OutcomeSkipped:            "S",
+	OutcomeDNSFailure:         "D",
+	OutcomeRefused:            "R",
+	OutcomeTimeout:            "T",
+	OutcomeWrongBackend:       "W",
+	OutcomeBadStatus:          "H",
+	OutcomeUnexpectedSourceIP: "N",
+	OutcomeExecError:          "E",
+	OutcomeCancelled:          "C",
+	OutcomeFailed:             "X",
+}
+
+// Glyph returns the mark printing the outcome in a matrix
+func (o Outcome) Glyph() string {
+	if glyph, ok := outcomeGlyphs[o]; ok {
+		return glyph
+	}
+	return "X"
+}
+
+// IsConnected returns true if the outcome counts as a successful connection
+func (o Outcome) IsConnected() bool {
+	return o == OutcomeConnected || o == OutcomeSkipped
+}
+
+// OutcomesLegend returns the description of the glyphs printed in a matrix
+func OutcomesLegend() string {
+	outcomes := make([]string, 0, len(outcomeGlyphs))
+	for outcome, glyph := range outcomeGlyphs {
+		if outcome == OutcomeUnknown {
+			continue
+		}
+		outcomes = append(outcomes, fmt.Sprintf("%s %s", glyph, outcome))
+	}
+	sort.Strings(outcomes)
+	return strings.Join(outcomes, ", ")
+}
+
+// ParseOutcome classifies a probe from the stderr and error of the client command,
+// it understands the agnhost connect, netcat and iperf error messages.
+func ParseOutcome(stderr string, err error) Outcome {
+	if err == nil {
+		return OutcomeConnected
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return OutcomeCancelled
+	}
+	// a command exiting with a non-zero code ran in the pod, anything else is a failure of the exec itself
+	var exitErr utilexec.ExitError
+	if !errors.As(err, &exitErr) {
+		return OutcomeExecError
+	}
+
+	msg := strings.ToLower(stderr)
+	// the messages name the target, only the resolver errors are matched, not any DNS name, e.g. of a service
+	switch {
+	case strings.HasPrefix(msg, "dns:"), strings.Contains(msg, "bad address"),
+		strings.Contains(msg, "could not resolve"), strings.Contains(msg, "name does not resolve"),
+		strings.Contains(msg, "no such host"), strings.Contains(msg, "getaddrinfo"):
+		return OutcomeDNSFailure
+	case strings.Contains(msg, "refused"):
+		return OutcomeRefused
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"):
+		return OutcomeTimeout
+	}
+	return OutcomeFailed
+}
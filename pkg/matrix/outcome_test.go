@@ -0,0 +1,44 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var _ = Describe("probe outcome", func() {
+	exitErr := utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+
+	It("should parse the agnhost connect errors", func() {
+		Expect(ParseOutcome("", nil)).To(Equal(OutcomeConnected))
+		Expect(ParseOutcome("TIMEOUT", exitErr)).To(Equal(OutcomeTimeout))
+		Expect(ParseOutcome("REFUSED", exitErr)).To(Equal(OutcomeRefused))
+		Expect(ParseOutcome("DNS: lookup svc-1 on 10.96.0.10:53: no such host", exitErr)).To(Equal(OutcomeDNSFailure))
+		Expect(ParseOutcome("OTHER: unexpected", exitErr)).To(Equal(OutcomeFailed))
+	})
+
+	It("should parse the nc and iperf errors", func() {
+		Expect(ParseOutcome("nc: 10.96.0.10 (10.96.0.10:80): Connection refused", exitErr)).To(Equal(OutcomeRefused))
+		Expect(ParseOutcome("nc: 10.96.0.10 (10.96.0.10:80): Operation timed out", exitErr)).To(Equal(OutcomeTimeout))
+		Expect(ParseOutcome("nc: bad address 'svc-1'", exitErr)).To(Equal(OutcomeDNSFailure))
+		Expect(ParseOutcome("nc: s-x-a.x.svc.cluster.local (10.96.0.10:80): Connection refused", exitErr)).To(Equal(OutcomeRefused))
+		Expect(ParseOutcome("REFUSED: dial tcp s-x-a.x.svc.cluster.local:80: connect: connection refused", exitErr)).To(Equal(OutcomeRefused))
+		Expect(ParseOutcome("iperf3: error - unable to connect to server: Connection refused", exitErr)).To(Equal(OutcomeRefused))
+	})
+
+	It("should tell the harness errors apart", func() {
+		Expect(ParseOutcome("", errors.New("unable to upgrade connection: container not found"))).To(Equal(OutcomeExecError))
+		Expect(ParseOutcome("", context.DeadlineExceeded)).To(Equal(OutcomeCancelled))
+	})
+
+	It("should print a distinct glyph per outcome", func() {
+		glyphs := map[string]Outcome{}
+		for outcome := range outcomeGlyphs {
+			Expect(glyphs).NotTo(HaveKey(outcome.Glyph()))
+			glyphs[outcome.Glyph()] = outcome
+		}
+	})
+})
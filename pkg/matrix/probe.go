@@ -1,6 +1,10 @@
 package matrix
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 
@@ -15,10 +19,23 @@ type ProbeJob struct {
 	ToPodDNSDomain string
 	Protocol       v1.Protocol
 	ServiceType    string
-	// ReachTargetPod checks if connection is responded by the target pod, instead of only check successful connection
-	ReachTargetPod bool
-	// MeasureBandwidth defines a ProbeJob that measures the bandwidth from pod to pod with iperf
-	MeasureBandwidth bool
+	// Mode defines the kind of probe, e.g. checking the connection is responded by the target pod
+	// instead of only a successful connection, or measuring the bandwidth from pod to pod with iperf
+	Mode ProbeMode
+	// Timeout bounds the execution of the probe, no timeout if zero
+	Timeout time.Duration
+	// ToAddress overrides the address of the target pod, e.g. the address of a service with several backends,
+	// PodTo is nil when set
+	ToAddress string
+	// ServiceDNS resolves the qualified name of the service of the target pod in the cluster DNS, instead of
+	// dialing its IP, for ClusterIP, headless and ExternalName services
+	ServiceDNS bool
+	// ExpectedStatus is the status code of the HTTP request in ProbeModeHTTP, http.StatusOK if zero
+	ExpectedStatus int
+	// SourceIP is the source IP expected to be seen by the target in ProbeModeClientIP
+	SourceIP SourceIPPolicy
+	// IPFamily selects the addresses of the target in this IP family on dual-stack clusters, the primary ones if empty
+	IPFamily v1.IPFamily
 }
 
 // SetServiceType sets the ServiceType for the probeJob
@@ -31,123 +48,341 @@ func (p *ProbeJob) GetServiceType() string {
 	return p.ServiceType
 }
 
+// GetExpectedStatus returns the status code expected in answer to the HTTP request of the job
+func (p *ProbeJob) GetExpectedStatus() int {
+	if p.ExpectedStatus == 0 {
+		return http.StatusOK
+	}
+	return p.ExpectedStatus
+}
+
+// Address returns the address to reach the target pod, based on the service type of the job
+func (p *ProbeJob) Address() string {
+	if p.ToAddress != "" {
+		return p.ToAddress
+	}
+	if p.ServiceDNS {
+		switch p.GetServiceType() {
+		case entities.ClusterIP, entities.Headless, entities.ExternalName:
+			return p.PodTo.QualifiedServiceAddress(p.ToPodDNSDomain)
+		}
+	}
+	var addrTo string
+	// Choose the host and port based on service or probing
+	switch p.GetServiceType() {
+	case entities.PodIP:
+		addrTo = p.PodTo.GetPodIPByFamily(p.IPFamily)
+	case entities.ClusterIP:
+		addrTo = p.PodTo.GetClusterIPByFamily(p.IPFamily)
+	case entities.Headless:
+		addrTo = p.PodTo.GetPodIPByFamily(p.IPFamily)
+	case entities.NodePort:
+		addrTo = p.PodTo.GetHostIPByFamily(p.IPFamily)
+	case entities.ExternalName:
+		addrTo = p.PodTo.GetServiceName()
+	case entities.LoadBalancer:
+		var externalIPs []string
+		for _, externalIP := range p.PodTo.GetExternalIPsByProtocol(p.Protocol) {
+			externalIPs = append(externalIPs, externalIP.IP)
+		}
+		externalIPs = entities.FilterIPsByFamily(externalIPs, p.IPFamily)
+		// Temporary solution to unblock the tests, load balancer IPs take longer time than expected to get created.
+		// will solve in https://github.com/K8sbykeshed/k8s-service-validator/issues/44
+		if len(externalIPs) > 0 {
+			addrTo = externalIPs[0]
+		}
+
+	default:
+		addrTo = p.PodTo.GetPodIPByFamily(p.IPFamily)
+	}
+	return addrTo
+}
+
+// Prober probes the connectivity described by a job and returns its result,
+// it should not fail on probe errors but report them in the result.
+type Prober interface {
+	Probe(ctx context.Context, job *ProbeJob) *ProbeJobResults
+}
+
+// BatchProber is a Prober also probing at once several jobs from the same source pod, e.g. a whole row of
+// the matrix in a single exec
+type BatchProber interface {
+	Prober
+	// Batchable returns true if the job can be probed in a batch
+	Batchable(job *ProbeJob) bool
+	// ProbeBatch probes the jobs of a source pod and returns their results in the order of the jobs
+	ProbeBatch(ctx context.Context, jobs []*ProbeJob) []*ProbeJobResults
+}
+
 // probeWorker continues polling a pod connectivity status, until the incoming "jobs" channel is closed, and writes results back out to the "results" channel.
 // it only writes pass/fail status to a channel and has no failure side effects, this is by design since we do not want to fail inside a goroutine.
-func probeWorker(manager *KubeManager, jobs <-chan *ProbeJob, results chan<- *ProbeJobResults) {
+// Jobs received once ctx is done are not probed and are reported as cancelled.
+func probeWorker(ctx context.Context, prober Prober, limiter *nodeLimiter, jobs <-chan *ProbeJob, results chan<- *ProbeJobResults) {
 	for job := range jobs {
-		var addrTo string
-
-		if job.PodTo.SkipProbe {
-			results <- &ProbeJobResults{
-				Job:         job,
-				IsConnected: true,
-				Err:         nil,
-				Command:     "skip",
-			}
+		if result := unprobedResult(ctx, job); result != nil {
+			results <- result
 			continue
 		}
 
-		// Choose the host and port based on service or probing
-		switch job.GetServiceType() {
-		case entities.PodIP:
-			addrTo = job.PodTo.GetPodIP()
-		case entities.ClusterIP:
-			addrTo = job.PodTo.GetClusterIP()
-		case entities.NodePort:
-			addrTo = job.PodTo.GetHostIP()
-		case entities.ExternalName:
-			addrTo = job.PodTo.GetServiceName()
-		case entities.LoadBalancer:
-			var externalIPs []entities.ExternalIP
-			if job.Protocol == v1.ProtocolTCP {
-				externalIPs = job.PodTo.GetExternalIPsByProtocol(v1.ProtocolTCP)
-			} else if job.Protocol == v1.ProtocolUDP {
-				externalIPs = job.PodTo.GetExternalIPsByProtocol(v1.ProtocolUDP)
-			}
-			// Temporary solution to unblock the tests, load balancer IPs take longer time than expected to get created.
-			// will solve in https://github.com/K8sbykeshed/k8s-service-validator/issues/44
-			if len(externalIPs) > 0 {
-				addrTo = externalIPs[0].IP
+		nodeFrom := job.PodFrom.GetNodeName()
+		if err := limiter.acquire(ctx, nodeFrom); err != nil {
+			results <- &ProbeJobResults{Job: job, Err: err, Command: "cancelled", Outcome: OutcomeCancelled}
+			continue
+		}
+		probeCtx, cancel := ctx, context.CancelFunc(func() {})
+		if job.Timeout > 0 {
+			probeCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+		}
+		result := prober.Probe(probeCtx, job)
+		// a probe interrupted by its deadline tells nothing about the connectivity
+		if probeCtx.Err() != nil {
+			result.IsConnected = false
+			result.Err = probeCtx.Err()
+			result.Outcome = OutcomeCancelled
+		}
+		cancel()
+		limiter.release(nodeFrom)
+
+		checkResult(result)
+		results <- result
+	}
+}
+
+// batchWorker probes the incoming batches of jobs with a single call to the prober each, until the "batches"
+// channel is closed, and writes a result per job to the "results" channel.
+func batchWorker(ctx context.Context, prober BatchProber, limiter *nodeLimiter, batches <-chan []*ProbeJob, results chan<- *ProbeJobResults) {
+	for batch := range batches {
+		var jobs []*ProbeJob
+		for _, job := range batch {
+			if result := unprobedResult(ctx, job); result != nil {
+				results <- result
+				continue
 			}
+			jobs = append(jobs, job)
+		}
+		if len(jobs) == 0 {
+			continue
+		}
 
-		default:
-			addrTo = job.PodTo.GetPodIP()
+		nodeFrom := jobs[0].PodFrom.GetNodeName()
+		if err := limiter.acquire(ctx, nodeFrom); err != nil {
+			for _, job := range jobs {
+				results <- &ProbeJobResults{Job: job, Err: err, Command: "cancelled", Outcome: OutcomeCancelled}
+			}
+			continue
 		}
+		batchResults := prober.ProbeBatch(ctx, jobs)
+		limiter.release(nodeFrom)
 
-		podFrom := job.PodFrom
-		var connected bool
-		var command string
-		var err error
-		var ep string
-		var bandwidth *ProbeJobBandwidthResults
-		if job.MeasureBandwidth {
-			connected, bandwidth, command, err = manager.ProbeConnectivityIPerf(
-				podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
-			)
-		} else if job.ReachTargetPod {
-			connected, ep, command, err = manager.ProbeConnectivityWithNc(
-				podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
-			)
-		} else {
-			connected, command, err = manager.ProbeConnectivity(
-				podFrom.Namespace, podFrom.Name, podFrom.Containers[0].GetName(), addrTo, job.Protocol, job.ToPort,
-			)
+		for _, result := range batchResults {
+			checkResult(result)
+			results <- result
 		}
-		if job.ReachTargetPod && job.PodTo.Name != ep {
-			connected = false
+	}
+}
+
+// unprobedResult returns the result of a job not to be probed, cancelled once ctx is done or skipped
+// if its target is marked to skip, nil if the job must be probed
+func unprobedResult(ctx context.Context, job *ProbeJob) *ProbeJobResults {
+	if ctx.Err() != nil {
+		return &ProbeJobResults{
+			Job:     job,
+			Err:     ctx.Err(),
+			Command: "cancelled",
+			Outcome: OutcomeCancelled,
 		}
-		result := &ProbeJobResults{
+	}
+	if job.PodTo != nil && job.PodTo.SkipProbe {
+		return &ProbeJobResults{
 			Job:         job,
-			IsConnected: connected,
-			Err:         err,
-			Command:     command,
-			Endpoint:    ep,
-			Bandwidth:   bandwidth,
+			IsConnected: true,
+			Err:         nil,
+			Command:     "skip",
+			Outcome:     OutcomeSkipped,
 		}
-		results <- result
 	}
+	return nil
+}
+
+// checkResult fails the connected results not answered as expected by the target of the job
+func checkResult(result *ProbeJobResults) {
+	job := result.Job
+	targetChecked := job.Mode == ProbeModeReachTargetPod || job.Mode == ProbeModeHTTP
+	if targetChecked && job.PodTo != nil && job.PodTo.Name != result.Endpoint {
+		if result.IsConnected {
+			result.Outcome = OutcomeWrongBackend
+		}
+		result.IsConnected = false
+	}
+	if job.Mode == ProbeModeClientIP && result.IsConnected && !job.SourceIP.Matches(job.PodFrom.GetPodIPByFamily(job.IPFamily), result.SourceIP) {
+		result.IsConnected = false
+		result.Outcome = OutcomeUnexpectedSourceIP
+	}
+}
+
+// dispatchJobs probes the jobs with opts.Workers workers writing their results to the "results" channel,
+// the jobs a BatchProber can batch are probed in a batch per source pod.
+func dispatchJobs(ctx context.Context, prober Prober, opts *ProbeOptions, jobs []*ProbeJob, results chan<- *ProbeJobResults) {
+	limiter := newNodeLimiter(opts.MaxExecPerNode)
+	single := jobs
+	if batcher, ok := prober.(BatchProber); ok {
+		var batchable []*ProbeJob
+		single = nil
+		for _, job := range jobs {
+			if batcher.Batchable(job) {
+				batchable = append(batchable, job)
+			} else {
+				single = append(single, job)
+			}
+		}
+		batches := batchJobs(batchable)
+		batchCh := make(chan []*ProbeJob, len(batches))
+		for _, batch := range batches {
+			batchCh <- batch
+		}
+		close(batchCh)
+		for i := 0; i < opts.GetWorkers() && i < len(batches); i++ {
+			go batchWorker(ctx, batcher, limiter, batchCh, results)
+		}
+	}
+
+	jobCh := make(chan *ProbeJob, len(single))
+	for _, job := range single {
+		jobCh <- job
+	}
+	close(jobCh)
+	for i := 0; i < opts.GetWorkers() && i < len(single); i++ {
+		go probeWorker(ctx, prober, limiter, jobCh, results)
+	}
+}
+
+// jobTarget identifies the target of the job, the target pod or the overridden address
+func jobTarget(job *ProbeJob) entities.PodString {
+	if job.PodTo == nil {
+		return entities.PodString(job.ToAddress)
+	}
+	return job.PodTo.PodString()
+}
+
+// batchTarget identifies the probes of a pair in a batch
+type batchTarget struct {
+	to          entities.PodString
+	port        int
+	protocol    v1.Protocol
+	serviceType string
+}
+
+// batchJobs groups the jobs by source pod, in order. A batch holds a single probe of each target, the next
+// samples of a pair go to the next batches so they are not executed together.
+func batchJobs(jobs []*ProbeJob) [][]*ProbeJob {
+	var batches [][]*ProbeJob
+	current := map[entities.PodString]int{}
+	targets := map[entities.PodString]map[batchTarget]bool{}
+	for _, job := range jobs {
+		from := job.PodFrom.PodString()
+		target := batchTarget{to: jobTarget(job), port: job.ToPort, protocol: job.Protocol, serviceType: job.GetServiceType()}
+		index, ok := current[from]
+		if !ok || targets[from][target] {
+			index = len(batches)
+			batches = append(batches, nil)
+			current[from] = index
+			targets[from] = map[batchTarget]bool{}
+		}
+		batches[index] = append(batches[index], job)
+		targets[from][target] = true
+	}
+	return batches
 }
 
 // ProbePodToPodConnectivity runs a series of probes in kube, and records the results in `testCase.Reachability`
-func ProbePodToPodConnectivity(k8s *KubeManager, model *Model, testCase *TestCase, reachTargetPod, measureBandwidth bool) {
-	numberOfWorkers := 4 // See https://github.com/kubernetes/kubernetes/pull/97690
+// Each probe is bounded by the test case probe timeout and the whole matrix by the test case deadline,
+// probes which did not complete in time are recorded as cancelled.
+// Each pair is probed opts.Samples times, and connected when the ratio of successful samples meets opts.SuccessThreshold.
+func ProbePodToPodConnectivity(ctx context.Context, prober Prober, model *Model, testCase *TestCase, opts *ProbeOptions) {
+	probeTestCases(ctx, prober, model, []*TestCase{testCase}, nil, opts)
+}
 
-	var fromPods, toPods []*entities.Pod
-	fromPods = model.AllPods()
-	toPods = model.AllPods()
-	size := len(fromPods) * len(toPods)
+// probeTestCases probes the matrices of all the test cases in a single run of the worker pool, bounded by
+// the longest deadline of the test cases, and records the results in the reachability of each test case.
+// Only the given pairs of each test case are probed if pairs is not nil.
+func probeTestCases(ctx context.Context, prober Prober, model *Model, testCases []*TestCase, pairs map[*TestCase]map[Pair]bool, opts *ProbeOptions) {
+	if opts == nil {
+		opts = DefaultProbeOptions()
+	}
 
-	jobs := make(chan *ProbeJob, size)
-	results := make(chan *ProbeJobResults, size)
-	for i := 1; i < numberOfWorkers; i++ {
-		go probeWorker(k8s, jobs, results)
+	var deadline time.Duration
+	for _, testCase := range testCases {
+		if testCase.GetDeadline() > deadline {
+			deadline = testCase.GetDeadline()
+		}
 	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
 
-	for _, podFrom := range fromPods {
-		for _, podTo := range toPods {
-			// if testcase global toPort not set, fallbacks to Pod custom set Port.
-			toPort := testCase.ToPort
-			if toPort == 0 {
-				toPort = int(podTo.GetToPort())
-			}
+	toPods := model.AllPods()
+	samples := opts.GetSamples()
+	fromPods := make([][]*entities.Pod, len(testCases))
+	for i, testCase := range testCases {
+		fromPods[i] = append(append([]*entities.Pod{}, model.AllPods()...), testCase.Reachability.Externals...)
+	}
+	selected := func(testCase *TestCase, podFrom, podTo *entities.Pod) bool {
+		return pairs == nil || pairs[testCase][Pair{From: podFrom.PodString().String(), To: podTo.PodString().String()}]
+	}
 
-			jobs <- &ProbeJob{
-				PodFrom:          podFrom,
-				PodTo:            podTo,
-				ToPort:           toPort,
-				ToPodDNSDomain:   model.dnsDomain,
-				Protocol:         testCase.Protocol,
-				ServiceType:      testCase.ServiceType,
-				ReachTargetPod:   reachTargetPod,
-				MeasureBandwidth: measureBandwidth,
+	for i, testCase := range testCases {
+		for _, podFrom := range fromPods[i] {
+			for _, podTo := range toPods {
+				if !selected(testCase, podFrom, podTo) {
+					continue
+				}
+				testCase.Reachability.Observed.ResetSamples(podFrom.PodString().String(), podTo.PodString().String())
+				testCase.Reachability.Observed.AddAttempt(podFrom.PodString().String(), podTo.PodString().String())
+			}
+		}
+	}
+	// samples of a same pair are spread over the whole matrices, so they are not executed back to back
+	var jobs []*ProbeJob
+	jobTestCases := map[*ProbeJob]*TestCase{}
+	for i := 0; i < samples; i++ {
+		for j, testCase := range testCases {
+			for _, podFrom := range fromPods[j] {
+				for _, podTo := range toPods {
+					if !selected(testCase, podFrom, podTo) {
+						continue
+					}
+					// if testcase global toPort not set, fallbacks to Pod custom set Port.
+					toPort := testCase.ToPort
+					if toPort == 0 {
+						toPort = int(podTo.GetToPort())
+					}
+					job := &ProbeJob{
+						PodFrom:        podFrom,
+						PodTo:          podTo,
+						ToPort:         toPort,
+						ToPodDNSDomain: model.dnsDomain,
+						Protocol:       testCase.Protocol,
+						ServiceType:    testCase.ServiceType,
+						Mode:           opts.GetMode(),
+						Timeout:        testCase.GetProbeTimeout(),
+						ServiceDNS:     opts.ServiceDNS,
+						ExpectedStatus: testCase.ExpectedStatus,
+						SourceIP:       testCase.SourceIP,
+						IPFamily:       testCase.IPFamily,
+					}
+					jobTestCases[job] = testCase
+					jobs = append(jobs, job)
+				}
 			}
 		}
 	}
-	close(jobs)
+	size := len(jobs)
+	results := make(chan *ProbeJobResults, size)
+	dispatchJobs(ctx, prober, opts, jobs, results)
 
 	for i := 0; i < size; i++ {
 		result := <-results
 		job := result.Job
+		testCase := jobTestCases[job]
 		if result.Err != nil {
 			zap.L().Error("Unable to perform probe.",
 				zap.String("from", string(job.PodFrom.PodString())),
@@ -163,13 +398,21 @@ func ProbePodToPodConnectivity(k8s *KubeManager, model *Model, testCase *TestCas
 			zap.String("to", string(job.PodTo.PodString())),
 			zap.String("cmd", result.Command),
 		}
-		if job.PodTo.SkipProbe {
+		if job.PodTo != nil && job.PodTo.SkipProbe {
 			zap.L().Debug("Skipping probe", fields...)
 		} else {
 			zap.L().Debug("Validating matrix.", fields...)
 		}
 
-		testCase.Reachability.Observe(job.PodFrom.PodString(), job.PodTo.PodString(), result.IsConnected, result.Bandwidth)
+		if result.Outcome == OutcomeCancelled {
+			zap.L().Warn("Probe cancelled before completion", fields...)
+			// the completed samples of the pair still tell about its connectivity
+			if testCase.Reachability.Observed.GetSamples(job.PodFrom.PodString().String(), job.PodTo.PodString().String()) == nil {
+				testCase.Reachability.ObserveCancelled(job.PodFrom.PodString(), job.PodTo.PodString())
+			}
+			continue
+		}
+		testCase.Reachability.ObserveSample(result, opts.GetSuccessThreshold())
 		expected := testCase.Reachability.Expected.Get(job.PodFrom.PodString().String(), job.PodTo.PodString().String())
 
 		if result.IsConnected != expected {
@@ -177,6 +420,7 @@ func ProbePodToPodConnectivity(k8s *KubeManager, model *Model, testCase *TestCas
 				zap.String("result", result.Command),
 				zap.String("from", string(job.PodFrom.PodString())),
 				zap.String("to", string(job.PodTo.PodString())),
+				zap.String("outcome", string(result.Outcome)),
 			}
 			if result.Err != nil {
 				zap.L().Error("Command error", zap.String("err", result.Err.Error()))
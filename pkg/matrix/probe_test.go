@@ -0,0 +1,272 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+// newFakeModel returns a model of one namespace with a pod per node
+func newFakeModel() *Model {
+	model := NewModel([]string{"ns-1"}, []string{"pod-1", "pod-2", "pod-3"}, []int32{80}, []v1.Protocol{v1.ProtocolTCP}, "cluster.local")
+	for i, pod := range model.AllPods() {
+		pod.SetNodeName([]string{"node-1", "node-2", "node-3"}[i])
+		pod.SetPodIP([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}[i])
+	}
+	return model
+}
+
+var _ = Describe("probe with fake prober", func() {
+	var (
+		ctx   context.Context
+		model *Model
+		pods  []*entities.Pod
+		opts  *ProbeOptions
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		model = newFakeModel()
+		pods = model.AllPods()
+		opts = DefaultProbeOptions()
+	})
+
+	newTestCase := func(defaultExpectation bool) *TestCase {
+		return &TestCase{
+			ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP,
+			Reachability: NewReachability(pods, defaultExpectation),
+		}
+	}
+
+	It("should pass when the dataplane matches the expectations", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true})
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(BeZero())
+	})
+
+	It("should count the wrong cells of a blocked target", func() {
+		prober := NewFakeProber(
+			&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: false},
+			&FakeRule{Connected: true},
+		)
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(Equal(3))
+	})
+
+	It("should pass an expected blocked target", func() {
+		prober := NewFakeProber(
+			&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: false},
+			&FakeRule{Connected: true},
+		)
+		testCase := newTestCase(true)
+		testCase.Reachability.ExpectPeer(&Peer{Namespace: "ns-1"}, &Peer{Namespace: "ns-1", Pod: "pod-2"}, false)
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+	})
+
+	It("should recover from a slow dataplane with retries", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Failures: 1})
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(BeZero())
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(2))
+	})
+
+	It("should only retry the wrong pairs and count their attempts", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: true, Failures: 2}, &FakeRule{Connected: true})
+		testCase := newTestCase(true)
+		opts.Retries = 3
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(3))
+		Expect(prober.Calls(pods[0].PodString(), pods[2].PodString())).To(Equal(1))
+
+		observed := testCase.Reachability.Observed
+		Expect(observed.GetAttempts(pods[0].PodString().String(), pods[1].PodString().String())).To(Equal(3))
+		Expect(observed.GetAttempts(pods[0].PodString().String(), pods[2].PodString().String())).To(Equal(1))
+		Expect(testCase.Reachability.EventuallyConsistentPairs(false, false)).To(HaveLen(3))
+		Expect(testCase.Reachability.ConsistentAfter).To(BeNumerically(">", 0))
+	})
+
+	It("should not start a retry past the retry deadline", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Failures: 10})
+		opts.Retries, opts.RetryBackoff, opts.RetryDeadline = 5, 50*time.Millisecond, 120*time.Millisecond
+		// the first retry waits 50ms, the second would start after 150ms
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(Equal(9))
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(2))
+	})
+
+	It("should double the retry backoff up to its cap", func() {
+		policy := &RetryPolicy{Attempts: 10, Backoff: time.Second}
+		Expect(policy.GetBackoff(1)).To(Equal(time.Second))
+		Expect(policy.GetBackoff(3)).To(Equal(4 * time.Second))
+		Expect(policy.GetBackoff(10)).To(Equal(MaxRetryBackoff))
+	})
+
+	It("should fail a slow dataplane without retries", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Failures: 1})
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(Equal(9))
+	})
+
+	It("should not connect when another backend answers in reach target pod mode", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true, Endpoint: "pod-1"})
+		testCase := newTestCase(false)
+		testCase.Reachability.ExpectPeer(&Peer{Namespace: "ns-1"}, &Peer{Namespace: "ns-1", Pod: "pod-1"}, true)
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeReachTargetPod))).To(BeZero())
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[0].PodString().String(), pods[1].PodString().String())).To(Equal(OutcomeWrongBackend))
+	})
+
+	It("should record the outcome of the failed probes", func() {
+		prober := NewFakeProber(
+			&FakeRule{To: &Peer{Pod: "pod-2"}, Outcome: OutcomeTimeout},
+			&FakeRule{To: &Peer{Pod: "pod-3"}, Outcome: OutcomeRefused},
+			&FakeRule{Connected: true},
+		)
+		testCase := newTestCase(true)
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(Equal(6))
+		Expect(testCase.Reachability.Observed.CountOutcomes()).To(Equal(map[Outcome]int{
+			OutcomeConnected: 3, OutcomeTimeout: 3, OutcomeRefused: 3,
+		}))
+		printed := testCase.Reachability.Observed.PrettyPrint("")
+		Expect(printed).To(ContainSubstring("T"))
+		Expect(printed).To(ContainSubstring("R"))
+	})
+
+	It("should pass an intermittent pair meeting the success threshold", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: true, Failures: 2}, &FakeRule{Connected: true})
+		testCase := newTestCase(true)
+		opts.Retries, opts.Samples, opts.SuccessThreshold = -1, 5, 0.6
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+
+		samples := testCase.Reachability.Observed.GetSamples(pods[0].PodString().String(), pods[1].PodString().String())
+		Expect(samples).To(Equal(&SampleCount{Successes: 3, Total: 5}))
+		Expect(testCase.Reachability.Observed.CountIntermittent()).To(Equal(3))
+		Expect(testCase.Reachability.Observed.PrettyPrint("")).To(ContainSubstring("3/5"))
+	})
+
+	It("should fail an intermittent pair below the success threshold", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: true, Failures: 2}, &FakeRule{Connected: true})
+		opts.Retries, opts.Samples = -1, 5
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(Equal(3))
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(5))
+	})
+
+	It("should keep the latencies of all the samples", func() {
+		latency := &ProbeJobLatencyResults{Durations: []time.Duration{time.Millisecond, 3 * time.Millisecond}}
+		prober := NewFakeProber(&FakeRule{Connected: true, Latency: latency})
+		testCase := newTestCase(true)
+		opts.Samples = 2
+		Expect(ValidateAndMeasureLatencyOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+
+		observed := testCase.Reachability.Observed.GetLatency(pods[0].PodString().String(), pods[1].PodString().String())
+		Expect(observed.Durations).To(HaveLen(4))
+		Expect(observed.Min()).To(Equal(time.Millisecond))
+		Expect(observed.Median()).To(Equal(time.Millisecond))
+		Expect(observed.Percentile(99)).To(Equal(3 * time.Millisecond))
+		Expect(testCase.Reachability.Observed.PrettyPrintLatency("", 99)).To(ContainSubstring("3ms"))
+		Expect(latency.Durations).To(HaveLen(2))
+	})
+
+	It("should report probes as cancelled once the context is done", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true})
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		testCase := newTestCase(false)
+		opts.Retries = -1
+		Expect(ValidateOrFail(cancelledCtx, prober, model, testCase, opts)).To(Equal(9))
+		Expect(testCase.Reachability.Observed.CountOutcomes()).To(Equal(map[Outcome]int{OutcomeCancelled: 9}))
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(BeZero())
+	})
+
+	It("should use all the configured workers with a per node cap", func() {
+		prober := NewFakeProber(&FakeRule{Connected: true})
+		opts.Workers, opts.MaxExecPerNode = 8, 1
+		Expect(ValidateOrFail(ctx, prober, model, newTestCase(true), opts)).To(BeZero())
+	})
+
+	It("should skip probes to the pods marked to skip", func() {
+		prober := NewFakeProber()
+		pods[2].SkipProbe = true
+		testCase := newTestCase(false)
+		testCase.Reachability.ExpectPeer(&Peer{Namespace: "ns-1"}, &Peer{Namespace: "ns-1", Pod: "pod-3"}, true)
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts)).To(BeZero())
+		Expect(prober.Calls(pods[0].PodString(), pods[2].PodString())).To(BeZero())
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[0].PodString().String(), pods[2].PodString().String())).To(Equal(OutcomeSkipped))
+	})
+
+	It("should probe the services through their qualified DNS name", func() {
+		pods[1].SetClusterIP("10.96.0.2")
+		job := &ProbeJob{PodFrom: pods[0], PodTo: pods[1], ToPodDNSDomain: "cluster.local", ServiceType: entities.ClusterIP}
+		Expect(job.Address()).To(Equal("10.96.0.2"))
+		job.ServiceDNS = true
+		Expect(job.Address()).To(Equal("s-ns-1-pod-2.ns-1.svc.cluster.local"))
+		job.ServiceType = entities.NodePort
+		Expect(job.Address()).To(Equal(pods[1].GetHostIP()))
+	})
+
+	It("should probe the addresses of the IP family", func() {
+		pods[1].SetPodIPs([]string{"10.244.1.2", "fd00:10:244:1::2"})
+		pods[1].SetClusterIPs([]string{"10.96.0.2", "fd00:10:96::2"})
+		job := &ProbeJob{PodFrom: pods[0], PodTo: pods[1], ServiceType: entities.ClusterIP}
+		Expect(job.Address()).To(Equal("10.96.0.2"))
+		job.IPFamily = v1.IPv6Protocol
+		Expect(job.Address()).To(Equal("fd00:10:96::2"))
+		job.ServiceType = entities.PodIP
+		Expect(job.Address()).To(Equal("fd00:10:244:1::2"))
+	})
+
+	It("should validate the matrix of each IP family", func() {
+		prober := NewFakeProber(
+			&FakeRule{To: &Peer{Pod: "pod-2"}, IPFamily: v1.IPv6Protocol, Connected: false},
+			&FakeRule{Connected: true},
+		)
+		opts.Retries = -1
+		families := []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+		wrong := ValidateIPFamiliesOrFail(ctx, prober, model, families, func(v1.IPFamily) *TestCase {
+			return newTestCase(true)
+		}, opts)
+		Expect(wrong).To(Equal(3))
+		Expect(prober.Calls(pods[0].PodString(), pods[1].PodString())).To(Equal(2))
+	})
+
+	It("should tell the DNS failures apart from the connection failures", func() {
+		prober := NewFakeProber(
+			&FakeRule{To: &Peer{Pod: "pod-2"}, Outcome: OutcomeDNSFailure},
+			&FakeRule{Connected: true},
+		)
+		testCase := newTestCase(true)
+		testCase.ServiceType = entities.ClusterIP
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts.WithServiceDNS())).To(Equal(3))
+		Expect(testCase.Reachability.Observed.CountOutcomes()).To(Equal(map[Outcome]int{
+			OutcomeConnected: 6, OutcomeDNSFailure: 3,
+		}))
+	})
+
+	It("should check the HTTP requests are answered by the target pod", func() {
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-2"}, Connected: true, Endpoint: "pod-1"}, &FakeRule{Connected: true})
+		testCase := newTestCase(true)
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeHTTP))).To(Equal(3))
+		Expect(testCase.Reachability.Observed.GetOutcome(pods[2].PodString().String(), pods[1].PodString().String())).To(Equal(OutcomeWrongBackend))
+	})
+
+	It("should check the source IP seen by the targets", func() {
+		prober := NewFakeProber(&FakeRule{From: &Peer{Pod: "pod-1"}, Connected: true, SourceIP: "172.18.0.2"}, &FakeRule{Connected: true})
+		testCase := newTestCase(true)
+		testCase.SourceIP = SourceIPPreserved
+		opts.Retries = -1
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeClientIP))).To(Equal(3))
+		observed := testCase.Reachability.Observed
+		Expect(observed.GetOutcome(pods[0].PodString().String(), pods[1].PodString().String())).To(Equal(OutcomeUnexpectedSourceIP))
+		Expect(observed.GetSourceIP(pods[0].PodString().String(), pods[1].PodString().String())).To(Equal("172.18.0.2"))
+		Expect(observed.GetSourceIP(pods[1].PodString().String(), pods[0].PodString().String())).To(Equal("10.0.0.2"))
+
+		testCase = newTestCase(true)
+		testCase.SourceIP = SourceIPSNAT
+		Expect(ValidateOrFail(ctx, prober, model, testCase, opts.WithMode(ProbeModeClientIP))).To(Equal(6))
+	})
+})
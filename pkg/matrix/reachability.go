@@ -2,6 +2,10 @@ package matrix
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
@@ -16,6 +20,44 @@ type TestCase struct {
 	Protocol     v1.Protocol
 	Reachability *Reachability
 	ServiceType  string
+	// ProbeTimeout bounds each probe of the matrix, consts.DefaultProbeTimeout if zero
+	ProbeTimeout time.Duration
+	// Deadline bounds the probing of the whole matrix, consts.DefaultTestCaseDeadline if zero
+	Deadline time.Duration
+	// ExpectedStatus is the status code of the HTTP requests in ProbeModeHTTP, http.StatusOK if zero
+	ExpectedStatus int
+	// SourceIP is the source IP expected to be seen by the targets in ProbeModeClientIP
+	SourceIP SourceIPPolicy
+	// IPFamily is the IP family of the addresses probed on dual-stack clusters, the primary one if empty
+	IPFamily v1.IPFamily
+}
+
+// GetProbeTimeout returns the timeout of a single probe for the testCase
+func (t *TestCase) GetProbeTimeout() time.Duration {
+	if t.ProbeTimeout == 0 {
+		return consts.DefaultProbeTimeout
+	}
+	return t.ProbeTimeout
+}
+
+// GetDeadline returns the deadline for probing the whole matrix of the testCase
+func (t *TestCase) GetDeadline() time.Duration {
+	if t.Deadline == 0 {
+		return consts.DefaultTestCaseDeadline
+	}
+	return t.Deadline
+}
+
+// Name returns the name of the testCase, e.g. "nodeport-tcp-80-ipv6", the port and the family being left out if not set
+func (t *TestCase) Name() string {
+	parts := []string{t.ServiceType, strings.ToLower(string(t.Protocol))}
+	if t.ToPort != 0 {
+		parts = append(parts, strconv.Itoa(t.ToPort))
+	}
+	if t.IPFamily != "" {
+		parts = append(parts, strings.ToLower(string(t.IPFamily)))
+	}
+	return strings.Join(parts, "-")
 }
 
 // SetServiceType sets serviceType for the testCase
@@ -33,42 +75,112 @@ type Reachability struct {
 	Expected *TruthTable
 	Observed *TruthTable
 	Pods     []*entities.Pod
+	// Externals are the sources outside of the cluster probing the pods, added as rows of the matrix
+	Externals []*entities.Pod
+	// ConsistentAfter is the time from the first probe after which the pairs right on a retry were right,
+	// zero if no pair needed a retry
+	ConsistentAfter time.Duration
 }
 
 // NewReachability instantiates a reachability
 func NewReachability(pods []*entities.Pod, defaultExpectation bool) *Reachability {
+	return NewReachabilityWithExternals(pods, nil, defaultExpectation)
+}
+
+// NewReachabilityWithExternals instantiates a reachability where the pods are also probed from the external sources
+func NewReachabilityWithExternals(pods, externals []*entities.Pod, defaultExpectation bool) *Reachability {
 	podNames := make([]string, len(pods))
 	for i, pod := range pods {
 		podNames[i] = pod.PodString().String()
 	}
+	sourceNames := append([]string{}, podNames...)
+	for _, external := range externals {
+		sourceNames = append(sourceNames, external.PodString().String())
+	}
 	r := &Reachability{
-		Expected: NewTruthTableFromItems(podNames, &defaultExpectation),
-		Observed: NewTruthTableFromItems(podNames, nil),
-		Pods:     pods,
+		Expected:  NewTruthTable(sourceNames, podNames, &defaultExpectation),
+		Observed:  NewTruthTable(sourceNames, podNames, nil),
+		Pods:      pods,
+		Externals: externals,
 	}
 	return r
 }
 
-// PrintSummary prints the summary
-func (r *Reachability) PrintSummary(printExpected, printObserved, printComparison, printBandwidth bool) {
+// Sources returns the pods and external sources probing the pods
+func (r *Reachability) Sources() []*entities.Pod {
+	return append(append([]*entities.Pod{}, r.Pods...), r.Externals...)
+}
+
+// PrintSummary prints the summary, the matrices being rendered by renderer, a TextRenderer if nil
+func (r *Reachability) PrintSummary(renderer Renderer, printExpected, printObserved, printComparison, printBandwidth bool) {
+	if renderer == nil {
+		renderer = &TextRenderer{}
+	}
 	right, wrong, ignored, comparison := r.Summary(false, false)
 	if ignored > 0 {
 		zap.L().Warn(fmt.Sprintf("warning: this test doesn't take into consideration hairpin traffic, i.e. traffic whose source and destination is the same pod: %d cases ignored", ignored))
 	}
 	zap.L().Info(fmt.Sprintf("Reachability results (%t): correct: %v, incorrect: %v", wrong == 0, right, wrong))
+	outcomes := r.Observed.CountOutcomes()
+	if cancelled := outcomes[OutcomeCancelled]; cancelled > 0 {
+		zap.L().Warn(fmt.Sprintf("%d probes were cancelled before completion, marked as C", cancelled))
+	}
+	if unexpected := outcomes[OutcomeUnexpectedSourceIP]; unexpected > 0 {
+		zap.L().Warn(fmt.Sprintf("%d probes were seen by the target with an unexpected source IP, marked as N", unexpected))
+	}
+	if dnsFailures := outcomes[OutcomeDNSFailure]; dnsFailures > 0 {
+		zap.L().Warn(fmt.Sprintf("%d probes failed to resolve the target name, marked as D", dnsFailures))
+	}
+	if intermittent := r.Observed.CountIntermittent(); intermittent > 0 {
+		zap.L().Warn(fmt.Sprintf("%d pairs had both successful and failed samples", intermittent))
+	}
+	if retries := formatRetries([]*Reachability{r}, false, false); retries != "" {
+		zap.L().Warn(retries)
+	}
+	if failures := formatFailedOutcomes(outcomes); failures != "" {
+		zap.L().Info(fmt.Sprintf("failed probes by outcome: %s", failures))
+	}
 
+	for _, m := range r.renderMatrices(renderer, comparison, printExpected, printObserved, printComparison, printBandwidth) {
+		zap.L().Info(fmt.Sprintf("%s:\n\n%s\n\n\n", m.title, m.render))
+	}
+}
+
+// matrixRender is a matrix of a summary rendered by a renderer, name identifies it in the file names
+type matrixRender struct {
+	name, title, render string
+}
+
+// renderMatrices renders the matrices of the summary, comparison being the comparison of the expected and
+// observed matrices
+func (r *Reachability) renderMatrices(renderer Renderer, comparison *TruthTable, printExpected, printObserved, printComparison, printBandwidth bool) []matrixRender {
+	var renders []matrixRender
 	if printExpected {
-		zap.L().Info(fmt.Sprintf("expected:\n\n%s\n\n\n", r.Expected.PrettyPrint("")))
+		renders = append(renders, matrixRender{"expected", "expected", renderer.Render(r.Expected, GlyphValue)})
 	}
 	if !printBandwidth && printObserved {
-		zap.L().Info(fmt.Sprintf("observed:\n\n%s\n\n\n", r.Observed.PrettyPrint("")))
+		renders = append(renders, matrixRender{"observed", fmt.Sprintf("observed (%s)", OutcomesLegend()), renderer.Render(r.Observed, GlyphValue)})
 	}
 	if printBandwidth {
-		zap.L().Info(fmt.Sprintf("observed bandwidth:\n\n%s\n\n\n", r.Observed.PrettyPrintBandwidth("")))
+		renders = append(renders, matrixRender{"bandwidth", "observed bandwidth", renderer.Render(r.Observed, BandwidthValue)})
+	}
+	if r.Observed.HasLatencies() {
+		renders = append(renders,
+			matrixRender{"latency-min", "observed min latency", renderer.Render(r.Observed, LatencyValue(0))},
+			matrixRender{"latency-median", "observed median latency", renderer.Render(r.Observed, LatencyValue(50))},
+			matrixRender{"latency-p99", "observed p99 latency", renderer.Render(r.Observed, LatencyValue(99))},
+		)
+	}
+	if r.Observed.HasSourceIPs() {
+		renders = append(renders, matrixRender{"source-ip", "observed source IP", renderer.Render(r.Observed, SourceIPValue)})
+	}
+	if r.Observed.HasRetries() {
+		renders = append(renders, matrixRender{"attempts", "attempts", renderer.Render(r.Observed, AttemptsValue)})
 	}
 	if printComparison {
-		zap.L().Info(fmt.Sprintf("comparison:\n\n%s\n\n\n", comparison.PrettyPrint("")))
+		renders = append(renders, matrixRender{"comparison", "comparison", renderer.Render(comparison, GlyphValue)})
 	}
+	return renders
 }
 
 // Summary produces a useful summary of expected and observed model
@@ -79,22 +191,12 @@ func (r *Reachability) Summary(ignoreLoopback, measureBandWidth bool) (trueObs,
 		fmt.Println("observations not complete!")
 	}
 	for from, dict := range comparison.Values {
-		for to, val := range dict {
+		for to := range dict {
 			if ignoreLoopback && from == to {
 				// Never fail on loopback, because its not yet defined.
 				ignoredObs++
-			} else if val {
-				if !measureBandWidth {
-					trueObs++
-				} else {
-					connected := r.Observed.Values[from][to]
-					bandwidth := r.Observed.Bandwidths[from][to]
-					if connected && (bandwidth != nil && bandwidth.BandwidthToMegaBytes() < consts.PerfTestBandWidthBenchMarkMegabytesPerSecond) {
-						falseObs++
-					} else {
-						trueObs++
-					}
-				}
+			} else if r.isRight(comparison, from, to, measureBandWidth) {
+				trueObs++
 			} else {
 				falseObs++
 			}
@@ -103,6 +205,58 @@ func (r *Reachability) Summary(ignoreLoopback, measureBandWidth bool) (trueObs,
 	return
 }
 
+// isRight returns true if the observation of the pair matches the expectation in the comparison, and when
+// measuring the bandwidth, if a connected pair reaches the benchmark bandwidth
+func (r *Reachability) isRight(comparison *TruthTable, from, to string, measureBandWidth bool) bool {
+	if !comparison.Values[from][to] {
+		return false
+	}
+	if !measureBandWidth {
+		return true
+	}
+	connected := r.Observed.Values[from][to]
+	bandwidth := r.Observed.Bandwidths[from][to]
+	return !connected || bandwidth == nil || bandwidth.BandwidthToMegaBytes() >= consts.PerfTestBandWidthBenchMarkMegabytesPerSecond
+}
+
+// Pair is an ordered pair of the matrix, by pod strings
+type Pair struct {
+	From string
+	To   string
+}
+
+// WrongPairs returns the pairs whose observation does not match the expectation, in the order of the matrix
+func (r *Reachability) WrongPairs(ignoreLoopback, measureBandWidth bool) []Pair {
+	return r.pairs(ignoreLoopback, func(comparison *TruthTable, from, to string) bool {
+		return !r.isRight(comparison, from, to, measureBandWidth)
+	})
+}
+
+// EventuallyConsistentPairs returns the right pairs which were wrong on their first attempts, e.g. while the
+// dataplane was still being programmed
+func (r *Reachability) EventuallyConsistentPairs(ignoreLoopback, measureBandWidth bool) []Pair {
+	return r.pairs(ignoreLoopback, func(comparison *TruthTable, from, to string) bool {
+		return r.Observed.GetAttempts(from, to) > 1 && r.isRight(comparison, from, to, measureBandWidth)
+	})
+}
+
+// pairs returns the pairs matching the filter, in the order of the matrix
+func (r *Reachability) pairs(ignoreLoopback bool, filter func(comparison *TruthTable, from, to string) bool) []Pair {
+	comparison := r.Expected.Compare(r.Observed)
+	var pairs []Pair
+	for _, from := range comparison.Froms {
+		for _, to := range comparison.Tos {
+			if ignoreLoopback && from == to {
+				continue
+			}
+			if filter(comparison, from, to) {
+				pairs = append(pairs, Pair{From: from, To: to})
+			}
+		}
+	}
+	return pairs
+}
+
 // Peer is used for matching pods by either or both of the pod's namespace and name.
 type Peer struct {
 	Namespace string
@@ -119,7 +273,7 @@ func (p *Peer) Matches(pod entities.PodString) bool {
 
 // ExpectPeer sets expected values using Peer matchers
 func (r *Reachability) ExpectPeer(from, to *Peer, connected bool) {
-	for _, fromPod := range r.Pods {
+	for _, fromPod := range r.Sources() {
 		if from.Matches(fromPod.PodString()) {
 			for _, toPod := range r.Pods {
 				if to.Matches(toPod.PodString()) {
@@ -134,4 +288,57 @@ func (r *Reachability) ExpectPeer(from, to *Peer, connected bool) {
 func (r *Reachability) Observe(fromPod, toPod entities.PodString, isConnected bool, bandwidth *ProbeJobBandwidthResults) {
 	r.Observed.Set(string(fromPod), string(toPod), isConnected)
 	r.Observed.SetBandwidth(string(fromPod), string(toPod), bandwidth)
+	r.Observed.SetLatency(string(fromPod), string(toPod), nil)
+	r.Observed.SetOutcome(string(fromPod), string(toPod), OutcomeUnknown)
+	r.Observed.SetSourceIP(string(fromPod), string(toPod), "")
+	r.Observed.ResetSamples(string(fromPod), string(toPod))
+}
+
+// ObserveSample records one sample of a probe, the pair is connected when the ratio of successful
+// samples meets threshold. The outcome of the last failed sample is kept to explain the failures.
+func (r *Reachability) ObserveSample(result *ProbeJobResults, threshold float64) {
+	from, to := string(result.Job.PodFrom.PodString()), string(result.Job.PodTo.PodString())
+	samples := r.Observed.AddSample(from, to, result.IsConnected)
+	r.Observed.Set(from, to, samples.Ratio() >= threshold)
+	if samples.Total == 1 || result.Bandwidth != nil {
+		r.Observed.SetBandwidth(from, to, result.Bandwidth)
+	}
+	// the latencies of all the samples are kept for the percentiles
+	if latency := r.Observed.GetLatency(from, to); samples.Total > 1 && latency != nil && result.Latency != nil {
+		latency.Merge(result.Latency)
+	} else if samples.Total == 1 || result.Latency != nil {
+		r.Observed.SetLatency(from, to, result.Latency)
+	}
+	if samples.Total == 1 || !result.Outcome.IsConnected() {
+		r.Observed.SetOutcome(from, to, result.Outcome)
+		r.Observed.SetDetails(from, to, &ProbeDetails{Command: result.Command, Stderr: result.Stderr})
+	}
+	if samples.Total == 1 || result.SourceIP != "" {
+		r.Observed.SetSourceIP(from, to, result.SourceIP)
+	}
+}
+
+// ObserveCancelled records a probe which was cancelled before completion, the cell is
+// set as not connected but kept apart from the real connectivity failures.
+func (r *Reachability) ObserveCancelled(fromPod, toPod entities.PodString) {
+	r.Observed.ResetSamples(string(fromPod), string(toPod))
+	r.Observed.Set(string(fromPod), string(toPod), false)
+	r.Observed.SetBandwidth(string(fromPod), string(toPod), nil)
+	r.Observed.SetLatency(string(fromPod), string(toPod), nil)
+	r.Observed.SetSourceIP(string(fromPod), string(toPod), "")
+	r.Observed.SetDetails(string(fromPod), string(toPod), nil)
+	r.Observed.SetOutcome(string(fromPod), string(toPod), OutcomeCancelled)
+}
+
+// formatFailedOutcomes returns the counts of the failed outcomes, e.g. "refused: 2, timeout: 3"
+func formatFailedOutcomes(counts map[Outcome]int) string {
+	var failures []string
+	for outcome, count := range counts {
+		if outcome.IsConnected() || outcome == OutcomeCancelled {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %d", outcome, count))
+	}
+	sort.Strings(failures)
+	return strings.Join(failures, ", ")
 }
@@ -0,0 +1,58 @@
+package matrix
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("reachability summary", func() {
+	var (
+		pods         []*entities.Pod
+		reachability *Reachability
+	)
+
+	BeforeEach(func() {
+		pods = newFakeModel().AllPods()
+		reachability = NewReachability(pods, true)
+		for _, from := range pods {
+			for _, to := range pods {
+				reachability.Observe(from.PodString(), to.PodString(), true, nil)
+			}
+		}
+	})
+
+	It("should count right observations", func() {
+		right, wrong, ignored, comparison := reachability.Summary(false, false)
+		Expect(right).To(Equal(9))
+		Expect(wrong).To(BeZero())
+		Expect(ignored).To(BeZero())
+		Expect(comparison.IsComplete()).To(BeTrue())
+	})
+
+	It("should count wrong observations", func() {
+		reachability.Observe(pods[0].PodString(), pods[1].PodString(), false, nil)
+		right, wrong, _, comparison := reachability.Summary(false, false)
+		Expect(right).To(Equal(8))
+		Expect(wrong).To(Equal(1))
+		Expect(comparison.Get(pods[0].PodString().String(), pods[1].PodString().String())).To(BeFalse())
+	})
+
+	It("should ignore loopback observations", func() {
+		reachability.Observe(pods[0].PodString(), pods[0].PodString(), false, nil)
+		right, wrong, ignored, _ := reachability.Summary(true, false)
+		Expect(right).To(Equal(6))
+		Expect(wrong).To(BeZero())
+		Expect(ignored).To(Equal(3))
+	})
+
+	It("should never match the expectation with a cancelled probe", func() {
+		reachability.ExpectPeer(&Peer{Pod: pods[0].Name}, &Peer{Pod: pods[1].Name}, false)
+		reachability.ObserveCancelled(pods[0].PodString(), pods[1].PodString())
+		_, wrong, _, comparison := reachability.Summary(false, false)
+		Expect(wrong).To(Equal(1))
+		Expect(comparison.IsCancelled(pods[0].PodString().String(), pods[1].PodString().String())).To(BeTrue())
+		Expect(comparison.PrettyPrint("")).To(ContainSubstring("C"))
+	})
+})
@@ -0,0 +1,305 @@
+package matrix
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CellValue returns the text of the from->to cell of a rendered truth table
+type CellValue func(tt *TruthTable, from, to string) string
+
+// Renderer renders a truth table as a matrix, the text of each cell being given by a CellValue
+type Renderer interface {
+	Render(tt *TruthTable, value CellValue) string
+}
+
+const (
+	// RendererText renders tab separated text
+	RendererText = "text"
+	// RendererMarkdown renders a Markdown table, e.g. to paste in a pull request
+	RendererMarkdown = "markdown"
+	// RendererHTML renders a self-contained HTML page with color-coded cells and the probe details on hover
+	RendererHTML = "html"
+	// RendererCSV renders comma separated values
+	RendererCSV = "csv"
+	// RendererANSI renders aligned text with cells colored for the terminal
+	RendererANSI = "ansi"
+)
+
+// RendererFormats are the formats of the renderers returned by NewRenderer
+var RendererFormats = []string{RendererText, RendererMarkdown, RendererHTML, RendererCSV, RendererANSI}
+
+// NewRenderer returns the renderer of the format, one of RendererFormats
+func NewRenderer(format string) (Renderer, error) {
+	switch format {
+	case RendererText, "":
+		return &TextRenderer{}, nil
+	case RendererMarkdown:
+		return &MarkdownRenderer{}, nil
+	case RendererHTML:
+		return &HTMLRenderer{}, nil
+	case RendererCSV:
+		return &CSVRenderer{}, nil
+	case RendererANSI:
+		return &ANSIRenderer{}, nil
+	}
+	return nil, errors.Errorf("unknown matrix format %q, expected one of %s", format, strings.Join(RendererFormats, ", "))
+}
+
+// fileExtension returns the extension of the files the renders of renderer are written to, html or csv, or ""
+// for the renderers whose renders are logged
+func fileExtension(renderer Renderer) string {
+	switch renderer.(type) {
+	case *HTMLRenderer:
+		return RendererHTML
+	case *CSVRenderer:
+		return RendererCSV
+	}
+	return ""
+}
+
+// logRenderer returns the renderer of the logged matrices, a TextRenderer in place of the renderers whose
+// renders are written to files
+func logRenderer(renderer Renderer) Renderer {
+	if renderer == nil || fileExtension(renderer) != "" {
+		return &TextRenderer{}
+	}
+	return renderer
+}
+
+// GlyphValue renders the mark of the observation of the pair, with its successful samples if sampled
+func GlyphValue(tt *TruthTable, from, to string) string {
+	mark := tt.Glyph(from, to)
+	if samples := tt.GetSamples(from, to); samples != nil && samples.Total > 1 {
+		mark += " " + samples.String()
+	}
+	return mark
+}
+
+// BandwidthValue renders the bandwidth measured for the pair
+func BandwidthValue(tt *TruthTable, from, to string) string {
+	if bandwidth := tt.Bandwidths[from][to]; bandwidth != nil {
+		return bandwidth.PrettyString(true)
+	}
+	return "nil"
+}
+
+// LatencyValue returns a CellValue rendering the percentile of the latencies measured for the pair
+func LatencyValue(percentile float64) CellValue {
+	return func(tt *TruthTable, from, to string) string {
+		if latency := tt.Latencies[from][to]; latency != nil {
+			return latency.Percentile(percentile).Round(time.Microsecond).String()
+		}
+		return "nil"
+	}
+}
+
+// SourceIPValue renders the client IP seen by the target of the pair
+func SourceIPValue(tt *TruthTable, from, to string) string {
+	if sourceIP := tt.SourceIPs[from][to]; sourceIP != "" {
+		return sourceIP
+	}
+	return "nil"
+}
+
+// AttemptsValue renders the times the pair was probed
+func AttemptsValue(tt *TruthTable, from, to string) string {
+	return fmt.Sprintf("%d", tt.GetAttempts(from, to))
+}
+
+// cellState classifies the pair for coloring: "unknown" without value, "cancelled", "connected" if true, e.g. a
+// connected pair or a pair right in a comparison, "failed" otherwise
+func cellState(tt *TruthTable, from, to string) string {
+	value, ok := tt.Values[from][to]
+	switch {
+	case !ok:
+		return "unknown"
+	case tt.IsCancelled(from, to):
+		return "cancelled"
+	case value:
+		return "connected"
+	}
+	return "failed"
+}
+
+// TextRenderer renders tab separated text, each line starting with Indent
+type TextRenderer struct {
+	Indent string
+}
+
+// Render renders the truth table as tab separated text
+func (r *TextRenderer) Render(tt *TruthTable, value CellValue) string {
+	header := r.Indent + strings.Join(append([]string{"-\t"}, tt.Tos...), "\t")
+	lines := []string{header}
+	for _, from := range tt.Froms {
+		line := []string{from}
+		for _, to := range tt.Tos {
+			line = append(line, value(tt, from, to)+"\t")
+		}
+		lines = append(lines, r.Indent+strings.Join(line, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MarkdownRenderer renders a Markdown table
+type MarkdownRenderer struct{}
+
+// Render renders the truth table as a Markdown table
+func (r *MarkdownRenderer) Render(tt *TruthTable, value CellValue) string {
+	escape := func(s string) string { return strings.ReplaceAll(s, "|", `\|`) }
+	row := func(cells []string) string { return "| " + strings.Join(cells, " | ") + " |" }
+
+	header, separator := []string{"-"}, []string{"---"}
+	for _, to := range tt.Tos {
+		header = append(header, escape(to))
+		separator = append(separator, ":---:")
+	}
+	lines := []string{row(header), row(separator)}
+	for _, from := range tt.Froms {
+		cells := []string{escape(from)}
+		for _, to := range tt.Tos {
+			cells = append(cells, escape(value(tt, from, to)))
+		}
+		lines = append(lines, row(cells))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CSVRenderer renders comma separated values, with the targets as header
+type CSVRenderer struct{}
+
+// Render renders the truth table as comma separated values
+func (r *CSVRenderer) Render(tt *TruthTable, value CellValue) string {
+	var out strings.Builder
+	w := csv.NewWriter(&out)
+	records := [][]string{append([]string{""}, tt.Tos...)}
+	for _, from := range tt.Froms {
+		record := []string{from}
+		for _, to := range tt.Tos {
+			record = append(record, value(tt, from, to))
+		}
+		records = append(records, record)
+	}
+	// writing to a strings.Builder does not fail
+	_ = w.WriteAll(records)
+	return out.String()
+}
+
+// htmlStyle colors the cells of the HTML matrices by state
+const htmlStyle = `body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: center; font-family: monospace; }
+td.connected { background: #c8e6c9; }
+td.failed { background: #ffcdd2; }
+td.cancelled { background: #fff9c4; }
+td.unknown { background: #eeeeee; }`
+
+// HTMLRenderer renders a self-contained HTML page, the cells colored by state and showing the details of
+// their probe on hover
+type HTMLRenderer struct {
+	// Title is the title of the page, "matrix" if empty
+	Title string
+}
+
+// Render renders the truth table as an HTML page
+func (r *HTMLRenderer) Render(tt *TruthTable, value CellValue) string {
+	title := r.Title
+	if title == "" {
+		title = "matrix"
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<table>\n",
+		html.EscapeString(title), htmlStyle)
+	out.WriteString("<tr><th>-</th>")
+	for _, to := range tt.Tos {
+		fmt.Fprintf(&out, "<th>%s</th>", html.EscapeString(to))
+	}
+	out.WriteString("</tr>\n")
+	for _, from := range tt.Froms {
+		fmt.Fprintf(&out, "<tr><th>%s</th>", html.EscapeString(from))
+		for _, to := range tt.Tos {
+			fmt.Fprintf(&out, "<td class=\"%s\" title=\"%s\">%s</td>", cellState(tt, from, to),
+				html.EscapeString(cellDetails(tt, from, to)), html.EscapeString(value(tt, from, to)))
+		}
+		out.WriteString("</tr>\n")
+	}
+	out.WriteString("</table>\n</body>\n</html>\n")
+	return out.String()
+}
+
+// cellDetails returns the pair, the outcome, the command and the stderr of its probe, on a line each
+func cellDetails(tt *TruthTable, from, to string) string {
+	lines := []string{fmt.Sprintf("%s -> %s", from, to)}
+	if outcome := tt.GetOutcome(from, to); outcome != OutcomeUnknown {
+		lines = append(lines, "outcome: "+string(outcome))
+	}
+	if details := tt.GetDetails(from, to); details != nil {
+		if details.Command != "" {
+			lines = append(lines, "command: "+details.Command)
+		}
+		if details.Stderr != "" {
+			lines = append(lines, "stderr: "+details.Stderr)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ansiColors are the escape codes coloring the cells by state
+var ansiColors = map[string]string{
+	"connected": "\x1b[32m",
+	"failed":    "\x1b[31m",
+	"cancelled": "\x1b[33m",
+	"unknown":   "\x1b[90m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// ANSIRenderer renders aligned text with the cells colored by state for the terminal, each line starting with Indent
+type ANSIRenderer struct {
+	Indent string
+}
+
+// Render renders the truth table as colored text
+func (r *ANSIRenderer) Render(tt *TruthTable, value CellValue) string {
+	// the width of the columns is computed on the text, the escape codes taking no room
+	widths := make([]int, len(tt.Tos)+1)
+	widths[0] = 1
+	for _, from := range tt.Froms {
+		if len(from) > widths[0] {
+			widths[0] = len(from)
+		}
+	}
+	values := make([][]string, len(tt.Froms))
+	for j, to := range tt.Tos {
+		widths[j+1] = len(to)
+	}
+	for i, from := range tt.Froms {
+		values[i] = make([]string, len(tt.Tos))
+		for j, to := range tt.Tos {
+			values[i][j] = value(tt, from, to)
+			if len(values[i][j]) > widths[j+1] {
+				widths[j+1] = len(values[i][j])
+			}
+		}
+	}
+	pad := func(s string, width int) string { return s + strings.Repeat(" ", width-len(s)) }
+
+	header := []string{pad("-", widths[0])}
+	for j, to := range tt.Tos {
+		header = append(header, pad(to, widths[j+1]))
+	}
+	lines := []string{r.Indent + strings.Join(header, "  ")}
+	for i, from := range tt.Froms {
+		line := []string{pad(from, widths[0])}
+		for j, to := range tt.Tos {
+			line = append(line, ansiColors[cellState(tt, from, to)]+pad(values[i][j], widths[j+1])+ansiReset)
+		}
+		lines = append(lines, r.Indent+strings.Join(line, "  "))
+	}
+	return strings.Join(lines, "\n")
+}
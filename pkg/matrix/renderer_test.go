@@ -0,0 +1,111 @@
+package matrix
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+)
+
+var _ = Describe("matrix renderers", func() {
+	var (
+		observed *TruthTable
+		pods     []*entities.Pod
+	)
+
+	BeforeEach(func() {
+		model := newFakeModel()
+		pods = model.AllPods()
+		testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP, Reachability: NewReachability(pods, true)}
+		prober := NewFakeProber(&FakeRule{To: &Peer{Pod: "pod-3"}, Connected: false, Outcome: OutcomeRefused}, &FakeRule{Connected: true})
+		ProbePodToPodConnectivity(context.Background(), prober, model, testCase, DefaultProbeOptions())
+		observed = testCase.Reachability.Observed
+	})
+
+	It("should render tab separated text as PrettyPrint", func() {
+		text := (&TextRenderer{}).Render(observed, GlyphValue)
+		Expect(text).To(Equal(observed.PrettyPrint("")))
+		lines := strings.Split(text, "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(lines[1]).To(Equal(pods[0].PodString().String() + "\t.\t\t.\t\tR\t"))
+	})
+
+	It("should render a Markdown table", func() {
+		lines := strings.Split((&MarkdownRenderer{}).Render(observed, GlyphValue), "\n")
+		Expect(lines).To(HaveLen(5))
+		Expect(lines[0]).To(HavePrefix("| - | " + pods[0].PodString().String() + " |"))
+		Expect(lines[1]).To(Equal("| --- | :---: | :---: | :---: |"))
+		Expect(lines[2]).To(Equal("| " + pods[0].PodString().String() + " | . | . | R |"))
+	})
+
+	It("should render comma separated values", func() {
+		records, err := csv.NewReader(strings.NewReader((&CSVRenderer{}).Render(observed, GlyphValue))).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveLen(4))
+		Expect(records[0]).To(Equal([]string{"", pods[0].PodString().String(), pods[1].PodString().String(), pods[2].PodString().String()}))
+		Expect(records[3]).To(Equal([]string{pods[2].PodString().String(), ".", ".", "R"}))
+	})
+
+	It("should render a self-contained HTML page with the probe details on hover", func() {
+		page := (&HTMLRenderer{Title: "observed"}).Render(observed, GlyphValue)
+		Expect(page).To(HavePrefix("<!DOCTYPE html>"))
+		Expect(page).To(ContainSubstring("<style>"))
+		Expect(page).To(ContainSubstring(`<td class="connected"`))
+		Expect(page).To(MatchRegexp(`<td class="failed" title="[^"]*outcome: refused\ncommand: fake 10\.0\.0\.3">R</td>`))
+	})
+
+	It("should render colored text aligned on the visible width", func() {
+		text := (&ANSIRenderer{}).Render(observed, GlyphValue)
+		Expect(text).To(ContainSubstring(ansiColors["failed"] + "R"))
+		Expect(text).To(ContainSubstring(ansiColors["connected"] + "."))
+
+		escapes := regexp.MustCompile("\x1b\\[[0-9]+m")
+		lines := strings.Split(escapes.ReplaceAllString(text, ""), "\n")
+		Expect(lines).To(HaveLen(4))
+		for _, line := range lines {
+			Expect(len(line)).To(Equal(len(lines[0])))
+		}
+	})
+
+	It("should write the HTML renders of the summary to the output directory and log text", func() {
+		dir, err := os.MkdirTemp("", "renders")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		model := newFakeModel()
+		testCase := &TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, ServiceType: entities.PodIP, Reachability: NewReachability(pods, true)}
+		opts := DefaultProbeOptions()
+		opts.Renderer, opts.OutputDir = &HTMLRenderer{}, dir
+		ValidateOrFail(context.Background(), NewFakeProber(&FakeRule{Connected: true}), model, testCase, opts)
+
+		paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(HaveLen(3))
+		Expect(filepath.Base(paths[0])).To(MatchRegexp(`^\d{3}-podip-tcp-80-comparison\.html$`))
+		page, err := os.ReadFile(paths[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(page)).To(HavePrefix("<!DOCTYPE html>"))
+
+		Expect(logRenderer(opts.Renderer)).To(Equal(&TextRenderer{}))
+		Expect(logRenderer(&CSVRenderer{})).To(Equal(&TextRenderer{}))
+		Expect(logRenderer(&MarkdownRenderer{})).To(Equal(&MarkdownRenderer{}))
+	})
+
+	It("should select the renderer by format", func() {
+		for _, format := range RendererFormats {
+			renderer, err := NewRenderer(format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(renderer.Render(observed, AttemptsValue)).To(ContainSubstring("1"))
+		}
+		_, err := NewRenderer("pdf")
+		Expect(err).To(MatchError(ContainSubstring("unknown matrix format")))
+	})
+})
@@ -2,8 +2,13 @@ package matrix
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // ProbeJobBandwidthResults models the results of a pod->pod connectivity bandwidth
@@ -47,6 +52,74 @@ func (r *ProbeJobBandwidthResults) PrettyString(inBytes bool) string {
 	return prettyString(r.Bandwidth, "Bits")
 }
 
+// ProbeJobLatencyResults models the durations of the connects from pod to pod
+type ProbeJobLatencyResults struct {
+	Durations []time.Duration
+}
+
+// Merge adds the durations of other to the results
+func (r *ProbeJobLatencyResults) Merge(other *ProbeJobLatencyResults) {
+	r.Durations = append(r.Durations, other.Durations...)
+}
+
+// Percentile returns the duration below which p percent of the connects are, using the nearest rank
+func (r *ProbeJobLatencyResults) Percentile(p float64) time.Duration {
+	if len(r.Durations) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(r.Durations))
+	copy(sorted, r.Durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Min returns the fastest connect
+func (r *ProbeJobLatencyResults) Min() time.Duration {
+	return r.Percentile(0)
+}
+
+// Median returns the median connect duration
+func (r *ProbeJobLatencyResults) Median() time.Duration {
+	return r.Percentile(50)
+}
+
+// ProbeJobHTTPResults models the response to an HTTP request from pod to pod
+type ProbeJobHTTPResults struct {
+	StatusCode int
+	// Body is the response, the hostname of the answering pod or the client address seen by it
+	Body    string
+	Latency time.Duration
+}
+
+// FromCurlOutput parses the HTTP client stdout, the response body followed by a line with the status code
+// and the duration of the request in seconds, sample output: "pod-1\n200 0.001523"
+func (r *ProbeJobHTTPResults) FromCurlOutput(s string) error {
+	s = strings.TrimSpace(s)
+	body, trailer := "", s
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		body, trailer = s[:i], s[i+1:]
+	}
+	fields := strings.Fields(trailer)
+	if len(fields) != 2 {
+		return errors.Errorf("invalid HTTP client output %q", s)
+	}
+	statusCode, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return errors.Wrapf(err, "invalid HTTP status code %q", fields[0])
+	}
+	seconds, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid HTTP request duration %q", fields[1])
+	}
+	r.StatusCode, r.Body = statusCode, strings.TrimSpace(body)
+	r.Latency = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
 // ProbeJobResults packages the model for the results of a pod->pod connectivity probe
 type ProbeJobResults struct {
 	Job         *ProbeJob
@@ -55,4 +128,11 @@ type ProbeJobResults struct {
 	Command     string
 	Endpoint    string
 	Bandwidth   *ProbeJobBandwidthResults // nil if error or bandwidth is not required to measure
+	Latency     *ProbeJobLatencyResults   // nil if error or latency is not required to measure
+	HTTP        *ProbeJobHTTPResults      // nil if error or not probed over HTTP
+	SourceIP    string                    // the client IP seen by the target, empty if not probed in ProbeModeClientIP
+	// Outcome tells apart the reasons of a failed connection
+	Outcome Outcome
+	// Stderr of the probe command, the outcome is parsed from it
+	Stderr string
 }
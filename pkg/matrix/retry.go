@@ -0,0 +1,82 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// retryWrongPairs probes again the wrong pairs of the test cases as configured by the retry policy of opts,
+// waiting the backoff before each retry, until no pair is wrong, the retries are exhausted or the retry would
+// start past the deadline of the policy, counted from start. The right pairs are not probed again, and each
+// test case records the time from start after which its pairs right on a retry were right.
+func retryWrongPairs(ctx context.Context, prober Prober, model *Model, testCases []*TestCase, opts *ProbeOptions, start time.Time) {
+	policy := opts.GetRetryPolicy()
+	measureBandWidth := opts.GetMode() == ProbeModeBandwidth
+
+	for retry := 1; retry <= policy.Attempts && ctx.Err() == nil; retry++ {
+		var retried []*TestCase
+		pairs := map[*TestCase]map[Pair]bool{}
+		wrong := 0
+		for _, testCase := range testCases {
+			wrongPairs := testCase.Reachability.WrongPairs(opts.IgnoreLoopback, measureBandWidth)
+			if len(wrongPairs) == 0 {
+				continue
+			}
+			retried = append(retried, testCase)
+			pairs[testCase] = make(map[Pair]bool, len(wrongPairs))
+			for _, pair := range wrongPairs {
+				pairs[testCase][pair] = true
+			}
+			wrong += len(wrongPairs)
+		}
+		if wrong == 0 {
+			return
+		}
+
+		backoff := policy.GetBackoff(retry)
+		if policy.Deadline > 0 && time.Since(start)+backoff > policy.Deadline {
+			zap.L().Warn("Retry deadline reached, giving up on the wrong pairs.",
+				zap.Int("wrong", wrong), zap.Duration("deadline", policy.Deadline))
+			return
+		}
+		zap.L().Warn("Failed probe with wrong results, retrying the wrong pairs...",
+			zap.Int("wrong", wrong), zap.Int("retry", retry), zap.Duration("backoff", backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		probeTestCases(ctx, prober, model, retried, pairs, opts)
+		elapsed := time.Since(start)
+		for _, testCase := range retried {
+			// only the wrong pairs were probed again, less wrong pairs are pairs right on this retry
+			if len(testCase.Reachability.WrongPairs(opts.IgnoreLoopback, measureBandWidth)) < len(pairs[testCase]) {
+				testCase.Reachability.ConsistentAfter = elapsed
+			}
+		}
+	}
+}
+
+// formatRetries returns the number of pairs right on a retry of the matrices, with the longest time after which
+// they were right, and the number of pairs still wrong, e.g. "3 pairs eventually consistent after 4s, hard failures: 1"
+func formatRetries(reachabilities []*Reachability, ignoreLoopback, measureBandWidth bool) string {
+	var (
+		consistent, wrong int
+		after             time.Duration
+	)
+	for _, reachability := range reachabilities {
+		consistent += len(reachability.EventuallyConsistentPairs(ignoreLoopback, measureBandWidth))
+		wrong += len(reachability.WrongPairs(ignoreLoopback, measureBandWidth))
+		if reachability.ConsistentAfter > after {
+			after = reachability.ConsistentAfter
+		}
+	}
+	if consistent == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d pairs eventually consistent after %s, hard failures: %d", consistent, after.Round(time.Millisecond), wrong)
+}
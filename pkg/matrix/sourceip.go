@@ -0,0 +1,25 @@
+package matrix
+
+// SourceIPPolicy is the source IP a target is expected to see for the connections of a client
+type SourceIPPolicy string
+
+const (
+	// SourceIPAny accepts any source IP
+	SourceIPAny SourceIPPolicy = ""
+	// SourceIPPreserved expects the target to see the IP of the client pod, e.g. with the Local traffic policy
+	SourceIPPreserved SourceIPPolicy = "preserved"
+	// SourceIPSNAT expects the target to see another IP than the client pod one, e.g. the IP of a node
+	// masquerading the connections with the Cluster traffic policy
+	SourceIPSNAT SourceIPPolicy = "snat"
+)
+
+// Matches returns true if the source IP seen by the target follows the policy for a client with clientIP
+func (p SourceIPPolicy) Matches(clientIP, sourceIP string) bool {
+	switch p {
+	case SourceIPPreserved:
+		return sourceIP == clientIP
+	case SourceIPSNAT:
+		return sourceIP != "" && sourceIP != clientIP
+	}
+	return true
+}
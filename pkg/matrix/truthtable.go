@@ -3,6 +3,8 @@ package matrix
 import (
 	"fmt"
 	"strings"
+
+	"go.uber.org/zap"
 )
 
 // TruthTable takes in n items and maintains an n x n table of booleans for each ordered pair
@@ -12,6 +14,47 @@ type TruthTable struct {
 	toSet      map[string]bool
 	Values     map[string]map[string]bool
 	Bandwidths map[string]map[string]*ProbeJobBandwidthResults
+	Latencies  map[string]map[string]*ProbeJobLatencyResults
+	// Outcomes keeps the reason of each observed value, empty for the expected values
+	Outcomes map[string]map[string]Outcome
+	// Samples counts the successful probes of each pair probed more than once
+	Samples map[string]map[string]*SampleCount
+	// SourceIPs keeps the client IP seen by the target of each pair probed in ProbeModeClientIP
+	SourceIPs map[string]map[string]string
+	// Attempts counts the times each pair was probed by the first try and the retries of a validation
+	Attempts map[string]map[string]int
+	// Details keeps the command and stderr of the probe of each pair, the failed one if any
+	Details map[string]map[string]*ProbeDetails
+}
+
+// ProbeDetails are the command and stderr of the probe of a pair
+type ProbeDetails struct {
+	Command string
+	Stderr  string
+}
+
+// SampleCount counts the successful probes among the samples of a pair
+type SampleCount struct {
+	Successes int `json:"successes"`
+	Total     int `json:"total"`
+}
+
+// Ratio returns the ratio of successful samples
+func (s *SampleCount) Ratio() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Successes) / float64(s.Total)
+}
+
+// IsIntermittent returns true if some samples succeeded and some failed
+func (s *SampleCount) IsIntermittent() bool {
+	return s.Successes > 0 && s.Successes < s.Total
+}
+
+// String returns the samples as successes/total
+func (s *SampleCount) String() string {
+	return fmt.Sprintf("%d/%d", s.Successes, s.Total)
 }
 
 // NewTruthTableFromItems creates a new truth table with items
@@ -23,9 +66,21 @@ func NewTruthTableFromItems(items []string, defaultValue *bool) *TruthTable {
 func NewTruthTable(froms, tos []string, defaultValue *bool) *TruthTable {
 	values := map[string]map[string]bool{}
 	bandwidths := map[string]map[string]*ProbeJobBandwidthResults{}
+	latencies := map[string]map[string]*ProbeJobLatencyResults{}
+	outcomes := map[string]map[string]Outcome{}
+	samples := map[string]map[string]*SampleCount{}
+	sourceIPs := map[string]map[string]string{}
+	attempts := map[string]map[string]int{}
+	details := map[string]map[string]*ProbeDetails{}
 	for _, from := range froms {
 		values[from] = map[string]bool{}
 		bandwidths[from] = map[string]*ProbeJobBandwidthResults{}
+		latencies[from] = map[string]*ProbeJobLatencyResults{}
+		outcomes[from] = map[string]Outcome{}
+		samples[from] = map[string]*SampleCount{}
+		sourceIPs[from] = map[string]string{}
+		attempts[from] = map[string]int{}
+		details[from] = map[string]*ProbeDetails{}
 		for _, to := range tos {
 			if defaultValue != nil {
 				values[from][to] = *defaultValue
@@ -42,6 +97,12 @@ func NewTruthTable(froms, tos []string, defaultValue *bool) *TruthTable {
 		toSet:      toSet,
 		Values:     values,
 		Bandwidths: bandwidths,
+		Latencies:  latencies,
+		Outcomes:   outcomes,
+		Samples:    samples,
+		SourceIPs:  sourceIPs,
+		Attempts:   attempts,
+		Details:    details,
 	}
 }
 
@@ -64,17 +125,25 @@ func (tt *TruthTable) Compare(other *TruthTable) *TruthTable {
 	}
 
 	values := map[string]map[string]bool{}
+	outcomes := map[string]map[string]Outcome{}
 	for from, dict := range tt.Values {
 		values[from] = map[string]bool{}
+		outcomes[from] = map[string]Outcome{}
 		for to, val := range dict {
-			values[from][to] = val == other.Values[from][to]
+			// a cancelled probe never matches the expectation
+			cancelled := other.IsCancelled(from, to)
+			if cancelled {
+				outcomes[from][to] = OutcomeCancelled
+			}
+			values[from][to] = val == other.Values[from][to] && !cancelled
 		}
 	}
 	return &TruthTable{
-		Froms:  tt.Froms,
-		Tos:    tt.Tos,
-		toSet:  tt.toSet,
-		Values: values,
+		Froms:    tt.Froms,
+		Tos:      tt.Tos,
+		toSet:    tt.toSet,
+		Values:   values,
+		Outcomes: outcomes,
 	}
 }
 
@@ -90,6 +159,19 @@ func (tt *TruthTable) IsComplete() bool {
 	return true
 }
 
+// hasPair returns true if from->to is a pair of the table, logging the unknown keys
+func (tt *TruthTable) hasPair(from, to string) bool {
+	if _, ok := tt.Values[from]; !ok {
+		zap.L().Error("Unknown from-key of the truth table.", zap.String("from", from))
+		return false
+	}
+	if !tt.toSet[to] {
+		zap.L().Error("Unknown to-key of the truth table.", zap.String("to", to))
+		return false
+	}
+	return true
+}
+
 // Set sets the value for from->to
 func (tt *TruthTable) Set(from, to string, value bool) {
 	dict, ok := tt.Values[from]
@@ -114,6 +196,174 @@ func (tt *TruthTable) SetBandwidth(from, to string, bandwidth *ProbeJobBandwidth
 	dict[to] = bandwidth
 }
 
+// SetLatency sets the latency for from->to
+func (tt *TruthTable) SetLatency(from, to string, latency *ProbeJobLatencyResults) {
+	if !tt.hasPair(from, to) {
+		return
+	}
+	dict := tt.Latencies[from]
+	dict[to] = latency
+}
+
+// GetLatency gets the latency for from->to, nil if not measured
+func (tt *TruthTable) GetLatency(from, to string) *ProbeJobLatencyResults {
+	return tt.Latencies[from][to]
+}
+
+// HasLatencies returns true if the latency of any pair was measured
+func (tt *TruthTable) HasLatencies() bool {
+	for _, dict := range tt.Latencies {
+		for _, latency := range dict {
+			if latency != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetSourceIP sets the client IP seen by the target of from->to, an empty IP removes it
+func (tt *TruthTable) SetSourceIP(from, to, sourceIP string) {
+	if !tt.hasPair(from, to) {
+		return
+	}
+	dict := tt.SourceIPs[from]
+	if sourceIP == "" {
+		delete(dict, to)
+		return
+	}
+	dict[to] = sourceIP
+}
+
+// GetSourceIP gets the client IP seen by the target of from->to, empty if not probed
+func (tt *TruthTable) GetSourceIP(from, to string) string {
+	return tt.SourceIPs[from][to]
+}
+
+// HasSourceIPs returns true if the source IP of any pair was recorded
+func (tt *TruthTable) HasSourceIPs() bool {
+	for _, dict := range tt.SourceIPs {
+		if len(dict) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOutcome sets the outcome of the from->to probe
+func (tt *TruthTable) SetOutcome(from, to string, outcome Outcome) {
+	if !tt.hasPair(from, to) {
+		return
+	}
+	dict := tt.Outcomes[from]
+	dict[to] = outcome
+}
+
+// GetOutcome returns the outcome of the from->to probe, OutcomeUnknown if not set
+func (tt *TruthTable) GetOutcome(from, to string) Outcome {
+	return tt.Outcomes[from][to]
+}
+
+// IsCancelled returns true if the from->to probe was cancelled before completion
+func (tt *TruthTable) IsCancelled(from, to string) bool {
+	return tt.GetOutcome(from, to) == OutcomeCancelled
+}
+
+// CountOutcomes returns the number of probes in the table by outcome
+func (tt *TruthTable) CountOutcomes() map[Outcome]int {
+	counts := map[Outcome]int{}
+	for _, dict := range tt.Outcomes {
+		for _, outcome := range dict {
+			if outcome != OutcomeUnknown {
+				counts[outcome]++
+			}
+		}
+	}
+	return counts
+}
+
+// AddSample counts a new sample of the from->to probe and returns the updated count
+func (tt *TruthTable) AddSample(from, to string, connected bool) *SampleCount {
+	if !tt.hasPair(from, to) {
+		return &SampleCount{}
+	}
+	dict := tt.Samples[from]
+	count, ok := dict[to]
+	if !ok {
+		count = &SampleCount{}
+		dict[to] = count
+	}
+	count.Total++
+	if connected {
+		count.Successes++
+	}
+	return count
+}
+
+// GetSamples returns the samples of the from->to probe, nil if not sampled
+func (tt *TruthTable) GetSamples(from, to string) *SampleCount {
+	return tt.Samples[from][to]
+}
+
+// ResetSamples forgets the samples of the from->to probe
+func (tt *TruthTable) ResetSamples(from, to string) {
+	delete(tt.Samples[from], to)
+}
+
+// CountIntermittent returns the number of pairs with both successful and failed samples
+func (tt *TruthTable) CountIntermittent() int {
+	count := 0
+	for _, dict := range tt.Samples {
+		for _, samples := range dict {
+			if samples.IsIntermittent() {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// AddAttempt counts a new attempt at probing the from->to pair and returns the updated count
+func (tt *TruthTable) AddAttempt(from, to string) int {
+	if !tt.hasPair(from, to) {
+		return 0
+	}
+	dict := tt.Attempts[from]
+	dict[to]++
+	return dict[to]
+}
+
+// GetAttempts returns the times the from->to pair was probed, zero if never
+func (tt *TruthTable) GetAttempts(from, to string) int {
+	return tt.Attempts[from][to]
+}
+
+// HasRetries returns true if a pair was probed more than once
+func (tt *TruthTable) HasRetries() bool {
+	for _, dict := range tt.Attempts {
+		for _, attempts := range dict {
+			if attempts > 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetDetails sets the details of the probe of from->to
+func (tt *TruthTable) SetDetails(from, to string, details *ProbeDetails) {
+	if !tt.hasPair(from, to) {
+		return
+	}
+	dict := tt.Details[from]
+	dict[to] = details
+}
+
+// GetDetails returns the details of the probe of from->to, nil if not probed
+func (tt *TruthTable) GetDetails(from, to string) *ProbeDetails {
+	return tt.Details[from][to]
+}
+
 // Get gets the specified value
 func (tt *TruthTable) Get(from, to string) bool {
 	dict, ok := tt.Values[from]
@@ -140,44 +390,53 @@ func (tt *TruthTable) GetBandwidth(from, to string) *ProbeJobBandwidthResults {
 	return bandwidth
 }
 
-// PrettyPrint produces a nice visual representation.
-func (tt *TruthTable) PrettyPrint(indent string) string {
-	header := indent + strings.Join(append([]string{"-\t"}, tt.Tos...), "\t")
-	lines := []string{header}
+// Glyph returns the mark printing the observation of the pair in a matrix
+func (tt *TruthTable) Glyph(from, to string) string {
+	val, ok := tt.Values[from][to]
+	if !ok {
+		return "?"
+	}
+	if outcome := tt.GetOutcome(from, to); outcome != OutcomeUnknown {
+		return outcome.Glyph()
+	}
+	if val {
+		return "."
+	}
+	return "X"
+}
+
+// signature returns the marks of all the pairs, in order, telling apart matrices with different observations
+func (tt *TruthTable) signature() string {
+	var marks strings.Builder
 	for _, from := range tt.Froms {
-		line := []string{from}
 		for _, to := range tt.Tos {
-			mark := "X"
-			val, ok := tt.Values[from][to]
-			if !ok {
-				mark = "?"
-			} else if val {
-				mark = "."
-			}
-			line = append(line, mark+"\t")
+			marks.WriteString(tt.Glyph(from, to))
 		}
-		lines = append(lines, indent+strings.Join(line, "\t"))
 	}
-	return strings.Join(lines, "\n")
+	return marks.String()
+}
+
+// PrettyPrint produces a nice visual representation.
+func (tt *TruthTable) PrettyPrint(indent string) string {
+	return (&TextRenderer{Indent: indent}).Render(tt, GlyphValue)
 }
 
 // PrettyPrintBandwidth produces a nice visual representation for measured bandwidths.
 func (tt *TruthTable) PrettyPrintBandwidth(indent string) string {
-	header := indent + strings.Join(append([]string{"-\t"}, tt.Tos...), "\t")
-	lines := []string{header}
-	for _, from := range tt.Froms {
-		line := []string{from}
-		for _, to := range tt.Tos {
-			bandwidth := tt.Bandwidths[from][to]
-			var mark string
-			if bandwidth == nil {
-				mark = "nil"
-			} else {
-				mark = tt.Bandwidths[from][to].PrettyString(true)
-			}
-			line = append(line, mark+"\t")
-		}
-		lines = append(lines, indent+strings.Join(line, "\t"))
-	}
-	return strings.Join(lines, "\n")
+	return (&TextRenderer{Indent: indent}).Render(tt, BandwidthValue)
+}
+
+// PrettyPrintLatency produces a nice visual representation for the given percentile of the measured latencies.
+func (tt *TruthTable) PrettyPrintLatency(indent string, percentile float64) string {
+	return (&TextRenderer{Indent: indent}).Render(tt, LatencyValue(percentile))
+}
+
+// PrettyPrintSourceIP produces a nice visual representation for the client IPs seen by the targets.
+func (tt *TruthTable) PrettyPrintSourceIP(indent string) string {
+	return (&TextRenderer{Indent: indent}).Render(tt, SourceIPValue)
+}
+
+// PrettyPrintAttempts produces a nice visual representation for the times each pair was probed.
+func (tt *TruthTable) PrettyPrintAttempts(indent string) string {
+	return (&TextRenderer{Indent: indent}).Render(tt, AttemptsValue)
 }
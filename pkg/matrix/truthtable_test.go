@@ -0,0 +1,27 @@
+package matrix
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("truth table", func() {
+	It("should ignore the pairs of unknown pods", func() {
+		right := true
+		tt := NewTruthTableFromItems([]string{"a", "b"}, &right)
+		Expect(func() {
+			tt.SetOutcome("c", "a", OutcomeRefused)
+			tt.SetOutcome("a", "c", OutcomeRefused)
+			tt.SetLatency("c", "a", &ProbeJobLatencyResults{})
+			tt.SetSourceIP("c", "a", "10.0.0.1")
+			tt.SetDetails("c", "a", &ProbeDetails{})
+			Expect(tt.AddSample("c", "a", true).Total).To(BeZero())
+			Expect(tt.AddAttempt("c", "a")).To(BeZero())
+		}).NotTo(Panic())
+		Expect(tt.CountOutcomes()).To(BeEmpty())
+
+		tt.SetOutcome("a", "b", OutcomeRefused)
+		Expect(tt.GetOutcome("a", "b")).To(Equal(OutcomeRefused))
+		Expect(tt.AddAttempt("a", "b")).To(Equal(1))
+	})
+})
@@ -46,7 +46,7 @@ func TestBandwidth(t *testing.T) {
 			}
 			zap.L().Info("Wait and set iPerf pods IP.")
 			for _, pod := range model.AllPods() {
-				if err = manager.WaitAndSetIPs(pod); err != nil {
+				if err = manager.WaitAndSetIPs(ctx, pod); err != nil {
 					log.Fatal(err)
 				}
 			}
@@ -72,9 +72,9 @@ func TestBandwidth(t *testing.T) {
 						toPod.SkipProbe = true
 					}
 				}
-				tools.MustNoWrong(matrix.ValidateAndMeasureBandwidthOrFail(manager, model, &matrix.TestCase{
+				tools.MustNoWrong(matrix.ValidateAndMeasureBandwidthOrFail(ctx, prober, model, &matrix.TestCase{
 					ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.PodIP,
-				}, false, false, true), t)
+				}, probeOptions(matrix.ProbeModeBandwidth)), t)
 				return ctx
 			}).
 		Feature()
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"testing"
-	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -19,10 +18,7 @@ import (
 	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
 )
 
-var (
-	ctx   = context.Background()
-	delay = 5 * time.Second
-)
+var ctx = context.Background()
 
 // TestBasicService starts up the basic Kubernetes services available
 func TestBasicService(t *testing.T) { // nolint
@@ -46,14 +42,15 @@ func TestBasicService(t *testing.T) { // nolint
 				}
 
 				// wait for final status
-				if result, err = service.WaitForEndpoint(); err != nil || !result {
+				if result, err = service.WaitForEndpoint(ctx); err != nil || !result {
 					t.Error(errors.New("no endpoint available"))
 				}
 
-				if clusterIP, err = service.WaitForClusterIP(); err != nil || clusterIP == "" {
+				if clusterIP, err = service.WaitForClusterIP(ctx); err != nil || clusterIP == "" {
 					t.Error(errors.New("no cluster IP available"))
 				}
 				pod.SetClusterIP(clusterIP)
+				pod.SetServiceName(clusterSvc.Name)
 				services = append(services, service.(*kubernetes.Service))
 			}
 			return ctx
@@ -63,17 +60,65 @@ func TestBasicService(t *testing.T) { // nolint
 			return ctx
 		}).
 		Assess("should be reachable via cluster IP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
-			zap.L().Info("Testing ClusterIP with TCP protocol.")
-			reachabilityTCP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
-				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			zap.L().Info("Testing ClusterIP on all the ports and protocols.")
+			cube := matrix.NewCubeTestCase(model, entities.ClusterIP, true)
+			tools.MustNoWrong(matrix.ValidateCubeOrFail(ctx, prober, model, cube, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).
+		Assess("should be reachable via the service DNS name", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing ClusterIP DNS name with TCP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.ClusterIP,
+			}, probeOptions(matrix.ProbeModeConnect).WithServiceDNS()), t)
+
+			zap.L().Info("Testing ClusterIP DNS name with UDP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolUDP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.ClusterIP,
+			}, probeOptions(matrix.ProbeModeConnect).WithServiceDNS()), t)
+			return ctx
+		}).
+		Assess("should measure the latency via pod IP and cluster IP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			if !probeAgent {
+				t.Skip("the latency is measured by the probe agent, run with -probe-agent")
+			}
+			zap.L().Info("Measuring TCP connect latency via pod IP.")
+			tools.MustNoWrong(matrix.ValidateAndMeasureLatencyOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.PodIP,
+			}, probeOptions(matrix.ProbeModeLatency)), t)
+
+			zap.L().Info("Measuring TCP connect latency via cluster IP.")
+			tools.MustNoWrong(matrix.ValidateAndMeasureLatencyOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.ClusterIP,
+			}, probeOptions(matrix.ProbeModeLatency)), t)
+			return ctx
+		}).Feature()
 
-			zap.L().Info("Testing ClusterIP with UDP protocol.")
-			reachabilityUDP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
-				ToPort: 80, Protocol: v1.ProtocolUDP, Reachability: reachabilityUDP, ServiceType: entities.ClusterIP,
-			}, false, false), t)
+	featureHeadless := features.New("Headless").WithLabel("type", "headless").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				headlessSvc := pod.HeadlessService()
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), headlessSvc)
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				pod.SetServiceName(headlessSvc.Name)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, model)
+			return ctx
+		}).
+		Assess("should resolve the headless service DNS name to the pod", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing headless service DNS name with TCP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.Headless,
+			}, probeOptions(matrix.ProbeModeReachTargetPod).WithServiceDNS()), t)
 			return ctx
 		}).Feature()
 
@@ -95,7 +140,7 @@ func TestBasicService(t *testing.T) { // nolint
 					},
 					Labels: map[string]string{labelKey: labelValue},
 				}
-				err := manager.InitializePod(newPod)
+				err := manager.InitializePod(ctx, newPod)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -103,7 +148,7 @@ func TestBasicService(t *testing.T) { // nolint
 				podsWithAffinity[i] = newPod
 			}
 			// create cluster IP service with the new label and session affinity: clientIP
-			_, service, clusterIP, err := matrix.CreateServiceFromTemplate(manager.GetClientSet(), entities.ServiceTemplate{
+			_, service, clusterIP, err := matrix.CreateServiceFromTemplate(ctx, manager.GetClientSet(), entities.ServiceTemplate{
 				Name:            "service-session-affinity",
 				Namespace:       namespace,
 				Selector:        map[string]string{labelKey: labelValue},
@@ -145,14 +190,14 @@ func TestBasicService(t *testing.T) { // nolint
 			// setup affinity
 			fromToPeer := map[string]string{}
 			for _, p := range pods {
-				connected, endpoint, connectCmd, err := manager.ProbeConnectivityWithNc(namespace, p.Name, p.Containers[0].Name, clusterIPWithSessionAffinity, v1.ProtocolTCP, 80)
-				if err != nil {
-					t.Error(errors.Wrapf(err, "failed to establish affinity with cmd: %v", connectCmd))
+				result := manager.ProbeConnectivityWithNc(ctx, namespace, p.Name, p.Containers[0].Name, clusterIPWithSessionAffinity, v1.ProtocolTCP, 80)
+				if result.Err != nil {
+					t.Error(errors.Wrapf(result.Err, "failed to establish affinity with cmd: %v", result.Command))
 				}
-				if !connected {
-					t.Error(errors.New("failed to connect the ClusterIP service with sessionAffinity"))
+				if !result.IsConnected {
+					t.Error(errors.Errorf("failed to connect the ClusterIP service with sessionAffinity: %s", result.Outcome))
 				}
-				fromToPeer[p.Name] = endpoint
+				fromToPeer[p.Name] = result.Endpoint
 			}
 
 			// to validate if affiliation applies to same port
@@ -165,9 +210,9 @@ func TestBasicService(t *testing.T) { // nolint
 				for from, to := range fromToPeer {
 					reachabilityPort80.ExpectPeer(&matrix.Peer{Namespace: namespace, Pod: from}, &matrix.Peer{Namespace: namespace, Pod: to}, true)
 				}
-				tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+				tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 					ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachabilityPort80, ServiceType: entities.ClusterIP,
-				}, false, true), t)
+				}, probeOptions(matrix.ProbeModeReachTargetPod)), t)
 			}
 
 			// to validate if affiliation applies to other ports
@@ -177,9 +222,9 @@ func TestBasicService(t *testing.T) { // nolint
 			for from, to := range fromToPeer {
 				reachabilityPort81.ExpectPeer(&matrix.Peer{Namespace: namespace, Pod: from}, &matrix.Peer{Namespace: namespace, Pod: to}, true)
 			}
-			wrongNum := matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			wrongNum := matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 81, Protocol: v1.ProtocolTCP, Reachability: reachabilityPort81, ServiceType: entities.ClusterIP,
-			}, false, true)
+			}, probeOptions(matrix.ProbeModeReachTargetPod))
 			if wrongNum > 0 {
 				zap.L().Warn("Reproduced issue for testing session affinity https://github.com/kubernetes/kubernetes/issues/103000, " +
 					"same client reach to different target pods via different ports. Warning as issue still open...")
@@ -187,13 +232,97 @@ func TestBasicService(t *testing.T) { // nolint
 			return ctx
 		}).Feature()
 
+	// Test the distribution of the connections over the backends of a service, through its cluster IP, its node
+	// port and its load balancer, the targets not available in the cluster being skipped
+	backends := make([]*entities.Pod, 3)
+	var distributionTargets map[string]*matrix.ServiceTarget
+	validateDistribution := func(ctx context.Context, t *testing.T, serviceType string) {
+		target, ok := distributionTargets[serviceType]
+		if !ok {
+			t.Skipf("the load balancing service has no %s address", serviceType)
+		}
+		zap.L().Info("Testing the distribution of the connections over the backends.", zap.String("type", serviceType))
+		tools.MustNoWrong(matrix.ValidateDistributionOrFail(ctx, prober, model.AllPods(), target, probeOptions(matrix.ProbeModeReachTargetPod)), t)
+	}
+	featureLoadBalancing := features.New("LoadBalancing").WithLabel("type", "cluster_ip_load_balancing").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			labelKey := "app"
+			labelValue := "test-load-balancing"
+			backendNames := make([]string, len(backends))
+			for i := 0; i < len(backends); i++ {
+				backends[i] = &entities.Pod{
+					Name:       fmt.Sprintf("plb-%d", i),
+					Namespace:  namespace,
+					Containers: []*entities.Container{{Port: 80, Protocol: v1.ProtocolTCP}},
+					Labels:     map[string]string{labelKey: labelValue},
+				}
+				if err := manager.InitializePod(ctx, backends[i]); err != nil {
+					t.Fatal(err)
+				}
+				backendNames[i] = backends[i].Name
+			}
+			// a load balancer service also has a cluster IP and a node port
+			_, service, clusterIP, err := matrix.CreateServiceFromTemplate(ctx, manager.GetClientSet(), entities.ServiceTemplate{
+				Name:          "service-load-balancing",
+				Namespace:     namespace,
+				Selector:      map[string]string{labelKey: labelValue},
+				ProtocolPorts: []entities.ProtocolPortPair{{Protocol: v1.ProtocolTCP, Port: 80}},
+				Type:          v1.ServiceTypeLoadBalancer,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+				t.Error(errors.New("no endpoint available"))
+			}
+			newTarget := func(address string, port int, serviceType string) *matrix.ServiceTarget {
+				return &matrix.ServiceTarget{
+					Address: address, Port: port, Protocol: v1.ProtocolTCP, ServiceType: serviceType, Backends: backendNames,
+				}
+			}
+			distributionTargets = map[string]*matrix.ServiceTarget{entities.ClusterIP: newTarget(clusterIP, 80, entities.ClusterIP)}
+			if nodePort, err := service.WaitForNodePort(ctx); err != nil {
+				zap.L().Warn("No node port for the load balancing service.", zap.Error(err))
+			} else if nodeIP := backends[0].GetHostIP(); nodeIP != "" {
+				distributionTargets[entities.NodePort] = newTarget(nodeIP, int(nodePort), entities.NodePort)
+			}
+			if ips, err := service.WaitForExternalIP(ctx); err != nil || len(ips) == 0 {
+				zap.L().Warn("No load balancer ingress IP for the load balancing service.", zap.Error(err))
+			} else {
+				distributionTargets[entities.LoadBalancer] = newTarget(ips[0], 80, entities.LoadBalancer)
+			}
+			services = []*kubernetes.Service{service.(*kubernetes.Service)}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			for _, p := range backends {
+				if err := manager.DeletePod(p.Name, p.Namespace); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tools.ResetTestBoard(t, services, model)
+			return ctx
+		}).
+		Assess("should balance the connections over all the backends through the cluster IP.", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateDistribution(ctx, t, entities.ClusterIP)
+			return ctx
+		}).
+		Assess("should balance the connections over all the backends through the node port.", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateDistribution(ctx, t, entities.NodePort)
+			return ctx
+		}).
+		Assess("should balance the connections over all the backends through the load balancer.", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateDistribution(ctx, t, entities.LoadBalancer)
+			return ctx
+		}).Feature()
+
 	// Test endless service
 	featureEndlessService := features.New("EndlessService").WithLabel("type", "cluster_ip_endless").
 		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
 			services = make(kubernetes.Services, len(pods))
 			var endlessServicePort int32 = 80
 			// Create a service with no endpoints
-			_, service, clusterIP, err := matrix.CreateServiceFromTemplate(manager.GetClientSet(), entities.ServiceTemplate{
+			_, service, clusterIP, err := matrix.CreateServiceFromTemplate(ctx, manager.GetClientSet(), entities.ServiceTemplate{
 				Name:          "endless",
 				Namespace:     namespace,
 				ProtocolPorts: []entities.ProtocolPortPair{{Protocol: v1.ProtocolTCP, Port: endlessServicePort}},
@@ -218,9 +347,9 @@ func TestBasicService(t *testing.T) { // nolint
 			zap.L().Info("Testing Endless service.")
 			reachability := matrix.NewReachability(model.AllPods(), true)
 			reachability.ExpectPeer(&matrix.Peer{Namespace: namespace}, &matrix.Peer{Namespace: namespace}, false)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 			return ctx
 		}).Feature()
 
@@ -229,7 +358,7 @@ func TestBasicService(t *testing.T) { // nolint
 		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
 			services = make(kubernetes.Services, len(pods))
 			// Create a clusterIP service
-			serviceName, service, _, err := matrix.CreateServiceFromTemplate(manager.GetClientSet(), entities.ServiceTemplate{
+			serviceName, service, _, err := matrix.CreateServiceFromTemplate(ctx, manager.GetClientSet(), entities.ServiceTemplate{
 				Name:          "hairpin",
 				Namespace:     namespace,
 				ProtocolPorts: []entities.ProtocolPortPair{{Protocol: pods[0].Containers[0].Protocol, Port: 80}},
@@ -251,9 +380,9 @@ func TestBasicService(t *testing.T) { // nolint
 			zap.L().Info("Testing hairpin.")
 			reachability := matrix.NewReachability(model.AllPods(), true)
 			reachability.ExpectPeer(&matrix.Peer{Namespace: namespace}, &matrix.Peer{Namespace: namespace, Pod: pods[0].Name}, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 			return ctx
 		}).Feature()
 
@@ -270,23 +399,25 @@ func TestBasicService(t *testing.T) { // nolint
 				}
 
 				// Wait for final status
-				result, err := service.WaitForEndpoint()
+				result, err := service.WaitForEndpoint(ctx)
 				if err != nil || !result {
 					t.Error(errors.New("no endpoint available"))
 				}
 
-				nodePort, err := service.WaitForNodePort()
+				nodePort, err := service.WaitForNodePort(ctx)
 				if err != nil {
 					t.Error(err)
 				}
 
-				// required for wait complete ip rules creation
-				time.Sleep(delay)
-
 				// Set pod specification on entity model
 				pod.SetToPort(nodePort)
 				services = append(services, service.(*kubernetes.Service))
 			}
+
+			// Wait for the proxies to program the node ports
+			waitForDataplane(ctx, model, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect))
 			return ctx
 		}).
 		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
@@ -296,15 +427,19 @@ func TestBasicService(t *testing.T) { // nolint
 		Assess("should reachable on node port TCP and UDP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
 			zap.L().Info("Testing NodePort with TCP protocol.")
 			reachabilityTCP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.NodePort,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 
 			zap.L().Info("Testing NodePort with UDP protocol.")
 			reachabilityUDP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolUDP, Reachability: reachabilityUDP, ServiceType: entities.NodePort,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).
+		Assess("should be reachable on node port from outside of the cluster", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateFromExternal(ctx, t, entities.NodePort)
 			return ctx
 		}).Feature()
 
@@ -327,23 +462,23 @@ func TestBasicService(t *testing.T) { // nolint
 				}
 
 				// Wait for final status
-				result, err := serviceTCP.WaitForEndpoint()
+				result, err := serviceTCP.WaitForEndpoint(ctx)
 				if err != nil || !result {
 					t.Error(errors.New("no endpoint available"))
 				}
 
-				result, err = serviceUDP.WaitForEndpoint()
+				result, err = serviceUDP.WaitForEndpoint(ctx)
 				if err != nil || !result {
 					t.Error(errors.New("no endpoint available"))
 				}
 
-				ipsForTCP, err := serviceTCP.WaitForExternalIP()
+				ipsForTCP, err := serviceTCP.WaitForExternalIP(ctx)
 				if err != nil {
 					t.Error(err)
 				}
 				ips = append(ips, entities.NewExternalIPs(ipsForTCP, v1.ProtocolTCP)...)
 
-				ipsForUDP, err := serviceUDP.WaitForExternalIP()
+				ipsForUDP, err := serviceUDP.WaitForExternalIP(ctx)
 				if err != nil {
 					t.Error(err)
 				}
@@ -368,19 +503,23 @@ func TestBasicService(t *testing.T) { // nolint
 		Assess("should be reachable via load balancer", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
 			zap.L().Info("Creating load balancer with TCP protocol")
 			reachabilityTCP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.LoadBalancer,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 
 			zap.L().Info("Creating Loadbalancer with UDP protocol")
 			reachabilityUDP := matrix.NewReachability(pods, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolUDP, Reachability: reachabilityUDP, ServiceType: entities.LoadBalancer,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).
+		Assess("should be reachable via load balancer from outside of the cluster", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateFromExternal(ctx, t, entities.LoadBalancer)
 			return ctx
 		}).Feature()
 
-	testenv.Test(t, featureClusterIP, featureNodePort, featureLoadBalancer, featureEndlessService, featureHairpin, featureSessionAffinity)
+	testenv.Test(t, featureClusterIP, featureHeadless, featureNodePort, featureLoadBalancer, featureEndlessService, featureHairpin, featureSessionAffinity, featureLoadBalancing)
 }
 
 func TestExternalService(t *testing.T) {
@@ -405,27 +544,33 @@ func TestExternalService(t *testing.T) {
 			}
 
 			// Wait for final status
-			if _, err := service.WaitForClusterIP(); err != nil {
+			if _, err := service.WaitForClusterIP(ctx); err != nil {
 				t.Error(errors.New("no clusterIP available"))
 			}
 
-			if _, err := service.WaitForEndpoint(); err != nil {
+			if _, err := service.WaitForEndpoint(ctx); err != nil {
 				t.Error(errors.New("no endpoint available"))
 			}
 
-			nodePort, err := service.WaitForNodePort()
+			nodePort, err := service.WaitForNodePort(ctx)
 			if err != nil {
 				t.Error(err)
 			}
 
-			// required for wait complete ip rules creation
-			time.Sleep(delay)
-
 			// Set pod specification on entity model
 			for _, pod := range pods {
 				pod.SetToPort(nodePort)
 			}
 
+			// Wait for the proxies to program the node port, reachable only on the node of the testing pod
+			loopbackIgnored := probeOptions(matrix.ProbeModeConnect)
+			loopbackIgnored.IgnoreLoopback = true
+			reachability := matrix.NewReachability(pods, false)
+			reachability.ExpectPeer(&matrix.Peer{Namespace: namespace}, &matrix.Peer{Namespace: namespace, Pod: testingPodForNodePortLocal.Name}, true)
+			waitForDataplane(ctx, model, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.NodePort,
+			}, loopbackIgnored)
+
 			zap.L().Debug("Nodeport for traffic local policy.", zap.Int32("nodeport", nodePort))
 
 			services = append(services, service.(*kubernetes.Service))
@@ -436,19 +581,22 @@ func TestExternalService(t *testing.T) {
 			return ctx
 		}).
 		Assess("should be reachable via NodePortLocal k8s service", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			loopbackIgnored := probeOptions(matrix.ProbeModeConnect)
+			loopbackIgnored.IgnoreLoopback = true
+
 			zap.L().Info("Testing NodePortLocal with TCP protocol.")
 			reachabilityTCP := matrix.NewReachability(pods, false)
 			reachabilityTCP.ExpectPeer(&matrix.Peer{Namespace: namespace}, &matrix.Peer{Namespace: namespace, Pod: testingPodForNodePortLocal.Name}, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.NodePort,
-			}, true, false), t)
+			}, loopbackIgnored), t)
 
 			zap.L().Info("Testing NodePortLocal with UDP protocol.")
 			reachabilityUDP := matrix.NewReachability(pods, false)
 			reachabilityUDP.ExpectPeer(&matrix.Peer{Namespace: namespace}, &matrix.Peer{Namespace: namespace, Pod: testingPodForNodePortLocal.Name}, true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				Protocol: v1.ProtocolUDP, Reachability: reachabilityUDP, ServiceType: entities.NodePort,
-			}, true, false), t)
+			}, loopbackIgnored), t)
 			return ctx
 		}).Feature()
 
@@ -475,9 +623,16 @@ func TestExternalService(t *testing.T) {
 		Assess("should be reachable via ExternalName k8s service", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
 			zap.L().Info("Creating External service")
 			reachability := matrix.NewReachability(model.AllPods(), true)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.ExternalName,
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).
+		Assess("should be reachable via the qualified ExternalName service DNS name", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			reachability := matrix.NewReachability(model.AllPods(), true)
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.ExternalName,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect).WithServiceDNS()), t)
 			return ctx
 		}).Feature()
 
@@ -497,7 +652,7 @@ func TestPerformance(t *testing.T) {
 					{Port: 80, Protocol: v1.ProtocolTCP, Command: iperf.ServeCommand()},
 				},
 			}
-			err := manager.InitializePod(perfPod)
+			err := manager.InitializePod(ctx, perfPod)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -517,9 +672,9 @@ func TestPerformance(t *testing.T) {
 				}
 			}
 			reachabilityTCP := matrix.NewReachability(model.AllPods(), true)
-			tools.MustNoWrong(matrix.ValidateAndMeasureBandwidthOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateAndMeasureBandwidthOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachabilityTCP, ServiceType: entities.PodIP,
-			}, false, false, true), t)
+			}, probeOptions(matrix.ProbeModeBandwidth)), t)
 			return ctx
 		}).Feature()
 
@@ -38,7 +38,7 @@ func podUDPStaleServer(podName, nodeName string) (*entities.Pod, error) {
 	if _, err := manager.CreatePod(pod.ToK8SSpec()); err != nil {
 		return nil, err
 	}
-	if err := manager.WaitAndSetIPs(pod); err != nil {
+	if err := manager.WaitAndSetIPs(ctx, pod); err != nil {
 		return nil, err
 	}
 
@@ -62,7 +62,7 @@ func podUDPStaleClient(podName, clusterIP, nodeName string) (*entities.Pod, erro
 	if _, err := manager.CreatePod(pod.ToK8SSpec()); err != nil {
 		return nil, err
 	}
-	if err := manager.WaitAndSetIPs(pod); err != nil {
+	if err := manager.WaitAndSetIPs(ctx, pod); err != nil {
 		return nil, err
 	}
 
@@ -109,10 +109,10 @@ func TestUDPInitContainer(t *testing.T) {
 			}
 			var clusterIP string
 			// wait for final status
-			if result, err = service.WaitForEndpoint(); err != nil || !result {
+			if result, err = service.WaitForEndpoint(ctx); err != nil || !result {
 				t.Fatal(errors.New("no endpoint available"))
 			}
-			if clusterIP, err = service.WaitForClusterIP(); err != nil || clusterIP == "" {
+			if clusterIP, err = service.WaitForClusterIP(ctx); err != nil || clusterIP == "" {
 				t.Fatal(errors.New("no cluster IP available"))
 			}
 
@@ -150,7 +150,7 @@ func TestUDPInitContainer(t *testing.T) {
 			// Based on the above check if the pod receives the traffic.
 
 			testCase := matrix.TestCase{ToPort: 80, Protocol: v1.ProtocolUDP, Reachability: reachability, ServiceType: entities.ClusterIP}
-			wrong := matrix.ValidateOrFail(manager, &udpModel, &testCase, false, false)
+			wrong := matrix.ValidateOrFail(ctx, prober, &udpModel, &testCase, probeOptions(matrix.ProbeModeConnect))
 			if wrong > 0 {
 				t.Error("Wrong result number ")
 			}
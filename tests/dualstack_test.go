@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
+)
+
+// ipFamilyCase is a service IP family configuration and the families its cluster IPs are expected on
+type ipFamilyCase struct {
+	policy   v1.IPFamilyPolicyType
+	families []v1.IPFamily
+}
+
+// TestIPFamilies creates the services with each IP family policy, and validates the pods, cluster IPs and
+// node ports on every IP family of the service. The policies requiring a family missing from the cluster are skipped.
+func TestIPFamilies(t *testing.T) { // nolint
+	var services kubernetes.Services
+	pods := model.AllPods()
+	clusterFamilies := model.IPFamilies()
+
+	cases := []ipFamilyCase{
+		{policy: v1.IPFamilyPolicySingleStack, families: []v1.IPFamily{v1.IPv4Protocol}},
+		{policy: v1.IPFamilyPolicySingleStack, families: []v1.IPFamily{v1.IPv6Protocol}},
+		{policy: v1.IPFamilyPolicyPreferDualStack, families: clusterFamilies},
+		{policy: v1.IPFamilyPolicyRequireDualStack, families: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}},
+	}
+
+	var testFeatures []features.Feature
+	for _, c := range cases {
+		c := c
+		name := fmt.Sprintf("%s %s", c.policy, familiesName(c.families))
+		testFeatures = append(testFeatures, features.New("IP families "+name).WithLabel("type", "ip_families").
+			Setup(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				for _, family := range c.families {
+					if !entities.IPFamilyOnSlice(family, clusterFamilies) {
+						t.Skipf("the cluster pods have no %s address", family)
+					}
+				}
+				services = make(kubernetes.Services, len(pods))
+				for _, pod := range pods {
+					// PreferDualStack picks the families of the cluster, the others are given explicitly
+					serviceFamilies := c.families
+					if c.policy == v1.IPFamilyPolicyPreferDualStack {
+						serviceFamilies = nil
+					}
+					service := kubernetes.NewService(manager.GetClientSet(), entities.WithIPFamilies(pod.NodePortService(), c.policy, serviceFamilies...))
+					if _, err := service.Create(); err != nil {
+						t.Error(err)
+					}
+					if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+						t.Error(errors.New("no endpoint available"))
+					}
+					clusterIPs, err := service.WaitForClusterIPs(ctx)
+					if err != nil || len(clusterIPs) != len(c.families) {
+						t.Error(errors.Errorf("expected cluster IPs on %s, got %v", familiesName(c.families), clusterIPs))
+					}
+					nodePort, err := service.WaitForNodePort(ctx)
+					if err != nil {
+						t.Error(err)
+					}
+					pod.SetClusterIPs(clusterIPs)
+					pod.SetToPort(nodePort)
+					services = append(services, service)
+				}
+				for _, family := range c.families {
+					waitForDataplane(ctx, model, &matrix.TestCase{
+						Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(model.AllPods(), true),
+						ServiceType: entities.NodePort, IPFamily: family,
+					}, probeOptions(matrix.ProbeModeConnect))
+				}
+				return ctx
+			}).
+			Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+				tools.ResetTestBoard(t, services, model)
+				return ctx
+			}).
+			Assess("should reach the pods on each IP family", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				validateIPFamilies(ctx, t, c.families, 80, entities.PodIP)
+				return ctx
+			}).
+			Assess("should be reachable via cluster IP on each IP family", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				validateIPFamilies(ctx, t, c.families, 80, entities.ClusterIP)
+				return ctx
+			}).
+			Assess("should be reachable on node port on each IP family", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				validateIPFamilies(ctx, t, c.families, 0, entities.NodePort)
+				return ctx
+			}).Feature())
+	}
+
+	testenv.Test(t, testFeatures...)
+}
+
+// validateIPFamilies validates the TCP matrix of the service type once per IP family
+func validateIPFamilies(ctx context.Context, t *testing.T, families []v1.IPFamily, toPort int, serviceType string) {
+	pods := model.AllPods()
+	tools.MustNoWrong(matrix.ValidateIPFamiliesOrFail(ctx, prober, model, families, func(v1.IPFamily) *matrix.TestCase {
+		return &matrix.TestCase{
+			ToPort: toPort, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: serviceType,
+		}
+	}, probeOptions(matrix.ProbeModeConnect)), t)
+}
+
+func familiesName(families []v1.IPFamily) string {
+	names := make([]string, len(families))
+	for i, family := range families {
+		names[i] = string(family)
+	}
+	return strings.Join(names, "/")
+}
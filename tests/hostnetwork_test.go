@@ -28,7 +28,7 @@ func TestHostNetwork(t *testing.T) {
 					{Port: 80, Protocol: v1.ProtocolTCP},
 				},
 			}
-			err := manager.InitializePod(newPod)
+			err := manager.InitializePod(ctx, newPod)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -53,7 +53,7 @@ func TestHostNetwork(t *testing.T) {
 			reachability := matrix.NewReachability(model.AllPods(), true)
 
 			testCase := matrix.TestCase{ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.PodIP}
-			wrong := matrix.ValidateOrFail(manager, model, &testCase, false, false)
+			wrong := matrix.ValidateOrFail(ctx, prober, model, &testCase, probeOptions(matrix.ProbeModeConnect))
 			if wrong > 0 {
 				t.Error("Wrong result number ")
 			}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
+)
+
+// TestHTTPService starts HTTP servers in their own namespace and checks the HTTP requests through each
+// service type are answered by the right pod with a 200
+func TestHTTPService(t *testing.T) { // nolint
+	var services kubernetes.Services
+
+	httpModel, cleanup := startNamespaceModel(t, "http", func(ns string, podNames []string) *matrix.Model {
+		return matrix.NewModelWithNamespace([]*entities.Namespace{entities.NewNamespaceWithHTTPPods(ns, podNames, []int32{80})}, dnsDomain)
+	})
+	defer cleanup()
+	if err := manager.WaitForHTTPServers(ctx, httpModel); err != nil {
+		t.Fatal(err)
+	}
+	pods := httpModel.AllPods()
+
+	// validateHTTP requests each pod over HTTP through the service type and checks the answers
+	validateHTTP := func(ctx context.Context, t *testing.T, toPort int, serviceType string) {
+		zap.L().Info("Testing HTTP requests.", zap.String("service", serviceType))
+		tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, httpModel, &matrix.TestCase{
+			ToPort: toPort, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: serviceType,
+		}, probeOptions(matrix.ProbeModeHTTP)), t)
+	}
+
+	featureClusterIP := features.New("HTTP ClusterIP").WithLabel("type", "http_cluster_ip").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.ClusterIPService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				clusterIP, err := service.WaitForClusterIP(ctx)
+				if err != nil || clusterIP == "" {
+					t.Error(errors.New("no cluster IP available"))
+				}
+				pod.SetClusterIP(clusterIP)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, httpModel)
+			return ctx
+		}).
+		Assess("should answer HTTP requests via pod IP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateHTTP(ctx, t, 80, entities.PodIP)
+			return ctx
+		}).
+		Assess("should answer HTTP requests via cluster IP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateHTTP(ctx, t, 80, entities.ClusterIP)
+			return ctx
+		}).Feature()
+
+	featureNodePort := features.New("HTTP NodePort").WithLabel("type", "http_node_port").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.NodePortService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				nodePort, err := service.WaitForNodePort(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				pod.SetToPort(nodePort)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			waitForDataplane(ctx, httpModel, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect))
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, httpModel)
+			return ctx
+		}).
+		Assess("should answer HTTP requests on node port", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateHTTP(ctx, t, 0, entities.NodePort)
+			return ctx
+		}).Feature()
+
+	featureLoadBalancer := features.New("HTTP LoadBalancer").WithLabel("type", "http_load_balancer").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				service := kubernetes.NewService(manager.GetClientSet(), pod.LoadBalancerServiceByProtocol(v1.ProtocolTCP))
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				ips, err := service.WaitForExternalIP(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				if len(ips) == 0 {
+					t.Error(errors.New("invalid external TCP IPs setup"))
+				}
+
+				pod.SetToPort(80)
+				pod.SetExternalIPs(entities.NewExternalIPs(ips, v1.ProtocolTCP))
+				services = append(services, service)
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, httpModel)
+			return ctx
+		}).
+		Assess("should answer HTTP requests via load balancer", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			validateHTTP(ctx, t, 0, entities.LoadBalancer)
+			return ctx
+		}).Feature()
+
+	testenv.Test(t, featureClusterIP, featureNodePort, featureLoadBalancer)
+}
@@ -48,11 +48,11 @@ func TestLabels(t *testing.T) { // nolint
 		}
 
 		// wait for the toggled service
-		if result, err := toggledService.WaitForEndpoint(); err != nil || !result {
+		if result, err := toggledService.WaitForEndpoint(ctx); err != nil || !result {
 			t.Fatal(errors.New("no endpoint available"))
 		}
 
-		if toggledClusterIP, err := toggledService.WaitForClusterIP(); err != nil || toggledClusterIP == "" {
+		if toggledClusterIP, err := toggledService.WaitForClusterIP(ctx); err != nil || toggledClusterIP == "" {
 			t.Fatal(errors.New("no cluster IP available"))
 		}
 		return ctx
@@ -71,34 +71,34 @@ func TestLabels(t *testing.T) { // nolint
 		return func(_ context.Context, t *testing.T, cfg *envconf.Config) context.Context {
 			zap.L().Info("verify the toggledService is up without", zap.String("label", labelKey))
 			toPod.SetClusterIP(toggledService.GetClusterIP())
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: upReachability,
 				ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 
 			zap.L().Info("add label to the toggledService", zap.String("label", labelKey))
 			mustOrFatal(toggledService.SetLabel(labelKey, labelValue), t)
 
 			zap.L().Info("verify the toggledService is not up with", zap.String("label", labelKey))
 			toPod.SetClusterIP(toggledService.GetClusterIP())
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: downReachability,
 				ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 
 			zap.L().Info("remove label from the toggledService", zap.String("label", labelKey))
 			mustOrFatal(toggledService.RemoveLabel(labelKey), t)
 
 			zap.L().Info("verify the toggledService is up again without", zap.String("label", labelKey))
-			clusterIP, err := toggledService.WaitForClusterIP()
+			clusterIP, err := toggledService.WaitForClusterIP(ctx)
 			if err != nil {
 				t.Fatal(err)
 			}
 			toPod.SetClusterIP(clusterIP)
-			tools.MustNoWrong(matrix.ValidateOrFail(manager, model, &matrix.TestCase{
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, model, &matrix.TestCase{
 				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: upReachability,
 				ServiceType: entities.ClusterIP,
-			}, false, false), t)
+			}, probeOptions(matrix.ProbeModeConnect)), t)
 			return ctx
 		}
 	}
@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
 
 	pluginhelper "github.com/vmware-tanzu/sonobuoy-plugins/plugin-helper"
 	"go.uber.org/zap"
@@ -16,18 +20,57 @@ import (
 	"sigs.k8s.io/e2e-framework/pkg/envconf"
 	"sigs.k8s.io/e2e-framework/pkg/features"
 
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
 	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
 )
 
 const dnsDomain = "cluster.local"
 
 var (
 	// flags
-	debug     bool
-	namespace string
+	debug          bool
+	namespace      string
+	probeWorkers   int
+	maxExecPerNode int
+	probeRetries   int
+	retryBackoff   time.Duration
+	retryDeadline  time.Duration
+	probeSamples   int
+	probeThreshold float64
+	externalProbes bool
+	batchProbes    bool
+	probeAgent     bool
+	agentImage     string
+
+	// dataplaneTimeout bounds the wait for the proxies to program new services
+	dataplaneTimeout time.Duration
+
+	// monitor flags, the monitoring is disabled if monitorDuration is zero
+	monitorDuration time.Duration
+	monitorInterval time.Duration
+	monitorMatrices string
+	monitorOutput   string
+
+	// outputDir is the directory the results of each test case are written to, in outputFormat
+	outputDir    string
+	outputFormat string
+	// currentFeature is the name of the running feature, its results are written to a sub directory of outputDir
+	currentFeature string
+	// currentLabels are the labels of the running feature, collected with its results
+	currentLabels []matrix.Label
+	// summaryOutput is the file the summary of the run is written to, in outputFormat
+	summaryOutput string
+	// matrixFormat selects the renderer of the matrices printed in the summaries
+	matrixFormat string
 
 	manager *matrix.KubeManager
-	testenv env.Environment
+	// prober probes the matrices, the manager or the probe agents of the pods
+	prober matrix.Prober
+	// renderer renders the matrices printed in the summaries, selected by -matrix-format
+	renderer matrix.Renderer
+	testenv  env.Environment
 
 	model *matrix.Model
 )
@@ -35,6 +78,118 @@ var (
 func init() {
 	flag.BoolVar(&debug, "debug", false, "Enable debug log level.")
 	flag.StringVar(&namespace, "namespace", matrix.GetNamespace(), "Set namespace used to run the tests.")
+	flag.IntVar(&probeWorkers, "probe-workers", matrix.DefaultProbeWorkers, "Number of probes running concurrently.")
+	flag.IntVar(&maxExecPerNode, "max-exec-per-node", 0, "Max concurrent probes from pods of the same node, no limit if 0.")
+	flag.IntVar(&probeRetries, "probe-retries", matrix.DefaultProbeRetries, "Number of times the wrong pairs of a matrix are probed again, negative to disable.")
+	flag.DurationVar(&retryBackoff, "probe-retry-backoff", time.Second, "Wait before the first retry of the wrong pairs, doubled on each next retry.")
+	flag.DurationVar(&retryDeadline, "probe-retry-deadline", 0, "Time from the first probe of a matrix after which no retry is started, no limit if 0.")
+	flag.IntVar(&probeSamples, "probe-samples", matrix.DefaultProbeSamples, "Number of probes executed for each pair of pods.")
+	flag.Float64Var(&probeThreshold, "probe-success-threshold", matrix.DefaultSuccessThreshold, "Ratio of successful samples for a pair to be connected.")
+	flag.BoolVar(&externalProbes, "external-probes", false, "Also probe NodePort and LoadBalancer services from the validator process, outside of the cluster.")
+	flag.BoolVar(&batchProbes, "batch-probes", false, "Probe the connections of a source pod to all its targets in a single exec.")
+	flag.BoolVar(&probeAgent, "probe-agent", false, "Probe through a probe agent sidecar in the pods, a single exec per source pod instead of one per probe.")
+	flag.StringVar(&agentImage, "probe-agent-image", string(entities.ProbeAgentImage), "Image of the probe agent sidecar.")
+	flag.DurationVar(&dataplaneTimeout, "dataplane-timeout", time.Minute, "Max wait for the dataplane to reflect new services before validating them.")
+	flag.DurationVar(&monitorDuration, "monitor", 0, "Keep the services in place and probe the matrices on an interval for this duration, reporting the pairs changing, disabled if 0.")
+	flag.DurationVar(&monitorInterval, "monitor-interval", matrix.DefaultMonitorInterval, "Wait between two rounds of the monitoring.")
+	flag.StringVar(&monitorMatrices, "monitor-matrices", strings.Join(monitorMatrixNames, ","), "Comma separated matrices probed by the monitoring.")
+	flag.StringVar(&monitorOutput, "monitor-output", "", "File the transitions of the monitoring are written to as JSON lines.")
+	flag.StringVar(&outputDir, "output-dir", "", "Directory the results of each test case are written to, not written if empty.")
+	flag.StringVar(&outputFormat, "output-format", string(matrix.ResultsFormatJSON), "Encoding of the results written to -output-dir, json or yaml.")
+	flag.StringVar(&summaryOutput, "summary-output", "", "File the summary of the results of the run is written to, in -output-format, not written if empty.")
+	flag.StringVar(&matrixFormat, "matrix-format", matrix.RendererText, "Format of the printed matrices, one of "+strings.Join(matrix.RendererFormats, ", ")+".")
+}
+
+// probeOptions returns the probe options set by the flags, for the given probe mode
+func probeOptions(mode matrix.ProbeMode) *matrix.ProbeOptions {
+	return &matrix.ProbeOptions{
+		Workers:          probeWorkers,
+		MaxExecPerNode:   maxExecPerNode,
+		Retries:          probeRetries,
+		RetryBackoff:     retryBackoff,
+		RetryDeadline:    retryDeadline,
+		Mode:             mode,
+		Samples:          probeSamples,
+		SuccessThreshold: probeThreshold,
+		OutputDir:        featureOutputDir(),
+		OutputFormat:     matrix.ResultsFormat(outputFormat),
+		Renderer:         renderer,
+		Feature:          currentFeature,
+		Labels:           currentLabels,
+	}
+}
+
+// featureOutputDir returns the directory the results of the running feature are written to, named after the
+// feature, e.g. "nodeport-traffic-local", empty if the results are not written
+func featureOutputDir() string {
+	if outputDir == "" {
+		return ""
+	}
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, currentFeature), "-")
+	return filepath.Join(outputDir, name)
+}
+
+// waitForDataplane waits until the probes of the test case match its expectation, e.g. until the proxies programmed
+// the rules of new services, the validation reporting the wrong pairs left once the wait timed out
+func waitForDataplane(ctx context.Context, m *matrix.Model, testCase *matrix.TestCase, opts *matrix.ProbeOptions) {
+	if err := matrix.WaitUntilDataplaneReflects(ctx, prober, m, testCase, opts, dataplaneTimeout); err != nil {
+		zap.L().Warn("Dataplane did not reflect the services.", zap.Error(err))
+	}
+}
+
+// validateFromExternal probes the pods from the pods and from the validator process, outside of the cluster,
+// skipping the test unless external probes are enabled
+func validateFromExternal(ctx context.Context, t *testing.T, serviceType string) {
+	if !externalProbes {
+		t.Skip("external probes are disabled, enable them with -external-probes")
+	}
+	pods := model.AllPods()
+	externals := []*entities.Pod{matrix.NewExternalPod()}
+	// the probes from the pods go through the configured prober, as in the other features
+	externalProber := matrix.NewExternalProber(prober)
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP} {
+		zap.L().Info("Testing from outside of the cluster.", zap.String("service", serviceType), zap.String("protocol", string(protocol)))
+		tools.MustNoWrong(matrix.ValidateOrFail(ctx, externalProber, model, &matrix.TestCase{
+			Protocol: protocol, Reachability: matrix.NewReachabilityWithExternals(pods, externals, true), ServiceType: serviceType,
+		}, probeOptions(matrix.ProbeModeConnect)), t)
+	}
+}
+
+// startNamespaceModel starts the pods of a model of their own, built by newModel in a new namespace with a pod per node,
+// and returns the cleanup deleting the namespace
+func startNamespaceModel(t *testing.T, name string, newModel func(namespace string, podNames []string) *matrix.Model) (*matrix.Model, func()) {
+	nodes, err := manager.GetReadyNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var podNames []string
+	for i := 1; i <= len(nodes); i++ {
+		podNames = append(podNames, fmt.Sprintf("%s-%d", name, i))
+	}
+	ns := fmt.Sprintf("%s-%s", namespace, name)
+	cleanup := func() {
+		zap.L().Info("Cleanup namespace.", zap.String("namespace", ns))
+		kubernetes.StopSharedWaiter(manager.GetClientSet(), ns)
+		if err := manager.DeleteNamespaces([]string{ns}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	nsModel := newModel(ns, podNames)
+	if err := manager.StartPods(context.Background(), nsModel, nodes); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := manager.RemovePendingPodsInNamespace(nsModel, ns); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return nsModel, cleanup
 }
 
 // NewLoggerConfig return the configuration object for the logger
@@ -62,9 +217,16 @@ func TestMain(m *testing.M) {
 	}
 
 	zap.ReplaceGlobals(NewLoggerConfig())
+	if renderer, err = matrix.NewRenderer(matrixFormat); err != nil {
+		log.Fatal(err)
+	}
 
 	clientSet, config := matrix.NewClientSet()
 	manager = matrix.NewKubeManager(clientSet, config)
+	prober = manager
+	if batchProbes {
+		prober = matrix.NewExecBatchProber(manager)
+	}
 	namespace = matrix.GetNamespace()
 	sonobuoyResultsWriter := pluginhelper.NewDefaultSonobuoyResultsWriter()
 	progressReporter := pluginhelper.NewProgressReporter(12)
@@ -89,7 +251,13 @@ func TestMain(m *testing.M) {
 
 			// Initialize environment pods model and cluster.
 			model = matrix.NewModel([]string{namespace}, pods, []int32{80, 81}, []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP}, dnsDomain)
-			if err = manager.StartPods(model, nodes); err != nil {
+			if probeAgent {
+				model.AddProbeAgents(entities.ContainerImage(agentImage))
+				agentProber := matrix.NewAgentProber(manager)
+				agentProber.Workers = probeWorkers
+				prober = agentProber
+			}
+			if err = manager.StartPods(ctx, model, nodes); err != nil {
 				log.Fatal(err)
 			}
 
@@ -98,12 +266,17 @@ func TestMain(m *testing.M) {
 			}
 
 			// Wait until HTTP servers are up.
-			if err = manager.WaitForHTTPServers(model); err != nil {
+			if err = manager.WaitForHTTPServers(ctx, model); err != nil {
 				log.Fatal(err)
 			}
 			return ctx, nil
 		},
-	).AfterEachFeature(
+	).BeforeEachFeature(
+		func(ctx context.Context, config *envconf.Config, t *testing.T, f features.Feature) (context.Context, error) {
+			currentFeature = f.Name()
+			currentLabels = matrix.NewLabels(f.Labels())
+			return ctx, nil
+		}).AfterEachFeature(
 		func(ctx context.Context, config *envconf.Config, t *testing.T, f features.Feature) (context.Context, error) {
 			// Add basic info for test pass/fail for Sonobuoy output.
 			result := "passed"
@@ -119,6 +292,16 @@ func TestMain(m *testing.M) {
 		}).Finish(
 		// Finished cleans up the namespace in the end of the suite.
 		func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
+			kubernetes.StopSharedWaiters()
+
+			summary := matrix.MatrixResults.Summary()
+			zap.L().Info(fmt.Sprintf("run summary:\n\n%s\n\n\n", summary.PrettyPrint("")))
+			if summaryOutput != "" {
+				if err := matrix.MatrixResults.WriteSummary(summaryOutput, matrix.ResultsFormat(outputFormat)); err != nil {
+					zap.L().Error("Unable to write the summary.", zap.Error(err))
+				}
+			}
+
 			zap.L().Info("Cleanup namespace.", zap.String("namespace", namespace))
 			if err := manager.DeleteNamespaces([]string{namespace}); err != nil {
 				log.Fatal(err)
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
+)
+
+// monitorMatrixNames are the matrices the monitoring can probe, in order
+var monitorMatrixNames = []string{"podip-tcp", "clusterip-tcp", "clusterip-udp", "nodeport-tcp", "nodeport-udp"}
+
+// monitorCases returns the cases of the matrices selected by -monitor-matrices
+func monitorCases(t *testing.T, pods []*entities.Pod) []*matrix.MonitorCase {
+	newCase := func(name string, toPort int, protocol v1.Protocol, serviceType string) *matrix.MonitorCase {
+		return &matrix.MonitorCase{Name: name, NewTestCase: func() *matrix.TestCase {
+			return &matrix.TestCase{
+				ToPort: toPort, Protocol: protocol, Reachability: matrix.NewReachability(pods, true), ServiceType: serviceType,
+			}
+		}}
+	}
+	all := map[string]*matrix.MonitorCase{
+		"podip-tcp":     newCase("podip-tcp", 80, v1.ProtocolTCP, entities.PodIP),
+		"clusterip-tcp": newCase("clusterip-tcp", 80, v1.ProtocolTCP, entities.ClusterIP),
+		"clusterip-udp": newCase("clusterip-udp", 80, v1.ProtocolUDP, entities.ClusterIP),
+		"nodeport-tcp":  newCase("nodeport-tcp", 0, v1.ProtocolTCP, entities.NodePort),
+		"nodeport-udp":  newCase("nodeport-udp", 0, v1.ProtocolUDP, entities.NodePort),
+	}
+	var cases []*matrix.MonitorCase
+	for _, name := range strings.Split(monitorMatrices, ",") {
+		monitorCase, ok := all[strings.TrimSpace(name)]
+		if !ok {
+			t.Fatalf("unknown matrix %q, expected one of %s", name, strings.Join(monitorMatrixNames, ","))
+		}
+		cases = append(cases, monitorCase)
+	}
+	return cases
+}
+
+// TestMonitor keeps a node port service per pod in place and probes the selected matrices on an interval,
+// reporting only the pairs whose connectivity changes, e.g. while the nodes are upgraded
+func TestMonitor(t *testing.T) { // nolint
+	if monitorDuration == 0 {
+		t.Skip("monitoring is disabled, enable it with -monitor")
+	}
+	pods := model.AllPods()
+	var services kubernetes.Services
+
+	featureMonitor := features.New("Monitor").WithLabel("type", "monitor").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				// a node port service also has a cluster IP
+				service := kubernetes.NewService(manager.GetClientSet(), pod.NodePortService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				clusterIP, err := service.WaitForClusterIP(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				nodePort, err := service.WaitForNodePort(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				pod.SetClusterIP(clusterIP)
+				pod.SetToPort(nodePort)
+				services = append(services, service)
+			}
+			waitForDataplane(ctx, model, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect))
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, model)
+			return ctx
+		}).
+		Assess("should report the transitions of the matrices", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			monitor := matrix.NewMonitor(prober, model, probeOptions(matrix.ProbeModeConnect), monitorCases(t, pods)...)
+			monitor.Interval = monitorInterval
+			if monitorOutput != "" {
+				output, err := os.Create(monitorOutput)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer output.Close()
+				monitor.Export = output
+			}
+
+			zap.L().Info("Monitoring the matrices.", zap.Duration("duration", monitorDuration), zap.Duration("interval", monitorInterval))
+			monitorCtx, cancel := context.WithTimeout(ctx, monitorDuration)
+			defer cancel()
+			if err := monitor.Run(monitorCtx); err != nil {
+				t.Error(err)
+			}
+			return ctx
+		}).Feature()
+
+	testenv.Test(t, featureMonitor)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
+)
+
+// TestSCTPService starts SCTP servers in their own namespace and validates the services on SCTP,
+// the test is skipped when the nodes lack the SCTP kernel module
+func TestSCTPService(t *testing.T) { // nolint
+	var services kubernetes.Services
+
+	sctpModel, cleanup := startNamespaceModel(t, "sctp", func(ns string, podNames []string) *matrix.Model {
+		return matrix.NewModel([]string{ns}, podNames, []int32{80}, []v1.Protocol{v1.ProtocolSCTP}, dnsDomain)
+	})
+	defer cleanup()
+	pods := sctpModel.AllPods()
+	if !manager.SCTPSupported(ctx, pods) {
+		t.Skip("SCTP is not supported by the nodes, the sctp kernel module may not be loaded")
+	}
+
+	featureClusterIP := features.New("SCTP ClusterIP").WithLabel("type", "sctp_cluster_ip").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.ClusterIPService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				clusterIP, err := service.WaitForClusterIP(ctx)
+				if err != nil || clusterIP == "" {
+					t.Error(errors.New("no cluster IP available"))
+				}
+				pod.SetClusterIP(clusterIP)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, sctpModel)
+			return ctx
+		}).
+		Assess("should be reachable via cluster IP on SCTP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing ClusterIP with SCTP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, sctpModel, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolSCTP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.ClusterIP,
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).Feature()
+
+	featureNodePort := features.New("SCTP NodePort").WithLabel("type", "sctp_node_port").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.NodePortService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				nodePort, err := service.WaitForNodePort(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				pod.SetToPort(nodePort)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			waitForDataplane(ctx, sctpModel, &matrix.TestCase{
+				Protocol: v1.ProtocolSCTP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect))
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, sctpModel)
+			return ctx
+		}).
+		Assess("should be reachable on node port SCTP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing NodePort with SCTP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, sctpModel, &matrix.TestCase{
+				Protocol: v1.ProtocolSCTP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).Feature()
+
+	featureLoadBalancer := features.New("SCTP LoadBalancer").WithLabel("type", "sctp_load_balancer").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				service := kubernetes.NewService(manager.GetClientSet(), pod.LoadBalancerServiceByProtocol(v1.ProtocolSCTP))
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				ips, err := service.WaitForExternalIP(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				if len(ips) == 0 {
+					t.Error(errors.New("invalid external SCTP IPs setup"))
+				}
+
+				pod.SetToPort(80)
+				pod.SetExternalIPs(entities.NewExternalIPs(ips, v1.ProtocolSCTP))
+				services = append(services, service)
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, sctpModel)
+			return ctx
+		}).
+		Assess("should be reachable via load balancer on SCTP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing load balancer with SCTP protocol.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, sctpModel, &matrix.TestCase{
+				Protocol: v1.ProtocolSCTP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.LoadBalancer,
+			}, probeOptions(matrix.ProbeModeConnect)), t)
+			return ctx
+		}).Feature()
+
+	testenv.Test(t, featureClusterIP, featureNodePort, featureLoadBalancer)
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/entities/kubernetes"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/matrix"
+	"github.com/k8sbykeshed/k8s-service-validator/pkg/tools"
+)
+
+// TestSourceIP starts agnhost netexec backends in their own namespace and checks the client IP they see,
+// the client IP is masqueraded by the Cluster traffic policy and preserved by the Local one
+func TestSourceIP(t *testing.T) { // nolint
+	var services kubernetes.Services
+
+	srcModel, cleanup := startNamespaceModel(t, "srcip", func(ns string, podNames []string) *matrix.Model {
+		return matrix.NewModelWithNamespace([]*entities.Namespace{entities.NewNamespaceWithNetexecPods(ns, podNames, []int32{80})}, dnsDomain)
+	})
+	defer cleanup()
+	if err := manager.WaitForHTTPServers(ctx, srcModel); err != nil {
+		t.Fatal(err)
+	}
+	pods := srcModel.AllPods()
+	srcNamespace := pods[0].Namespace
+
+	// hairpin connections are always masqueraded, whatever the policy
+	loopbackIgnored := probeOptions(matrix.ProbeModeClientIP)
+	loopbackIgnored.IgnoreLoopback = true
+
+	featureClusterIP := features.New("Source IP ClusterIP").WithLabel("type", "source_ip_cluster_ip").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.ClusterIPService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				clusterIP, err := service.WaitForClusterIP(ctx)
+				if err != nil || clusterIP == "" {
+					t.Error(errors.New("no cluster IP available"))
+				}
+				pod.SetClusterIP(clusterIP)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, srcModel)
+			return ctx
+		}).
+		Assess("should preserve the client IP via cluster IP", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing the source IP via cluster IP.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, srcModel, &matrix.TestCase{
+				ToPort: 80, Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true),
+				ServiceType: entities.ClusterIP, SourceIP: matrix.SourceIPPreserved,
+			}, loopbackIgnored), t)
+			return ctx
+		}).Feature()
+
+	featureNodePortCluster := features.New("Source IP NodePort Traffic Cluster").WithLabel("type", "source_ip_node_port_cluster").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			for _, pod := range pods {
+				var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), pod.NodePortService())
+				if _, err := service.Create(); err != nil {
+					t.Error(err)
+				}
+				if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+					t.Error(errors.New("no endpoint available"))
+				}
+				nodePort, err := service.WaitForNodePort(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				pod.SetToPort(nodePort)
+				services = append(services, service.(*kubernetes.Service))
+			}
+			waitForDataplane(ctx, srcModel, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true), ServiceType: entities.NodePort,
+			}, probeOptions(matrix.ProbeModeConnect))
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, srcModel)
+			return ctx
+		}).
+		Assess("should masquerade the client IP on node port with the Cluster policy", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing the source IP via node port with the Cluster policy.")
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, srcModel, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: matrix.NewReachability(pods, true),
+				ServiceType: entities.NodePort, SourceIP: matrix.SourceIPSNAT,
+			}, probeOptions(matrix.ProbeModeClientIP)), t)
+			return ctx
+		}).Feature()
+
+	// Create a node port traffic local service for one pod only and share the NodePort with all other pods,
+	// only the node of the backend answers
+	backend := pods[0]
+	featureNodePortLocal := features.New("Source IP NodePort Traffic Local").WithLabel("type", "source_ip_node_port_local").
+		Setup(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			services = make(kubernetes.Services, len(pods))
+			var service kubernetes.ServiceBase = kubernetes.NewService(manager.GetClientSet(), backend.NodePortLocalService())
+			if _, err := service.Create(); err != nil {
+				t.Error(err)
+			}
+			if result, err := service.WaitForEndpoint(ctx); err != nil || !result {
+				t.Error(errors.New("no endpoint available"))
+			}
+			nodePort, err := service.WaitForNodePort(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			for _, pod := range pods {
+				pod.SetToPort(nodePort)
+			}
+			services = append(services, service.(*kubernetes.Service))
+
+			waitOptions := probeOptions(matrix.ProbeModeConnect)
+			waitOptions.IgnoreLoopback = true
+			reachability := matrix.NewReachability(pods, false)
+			reachability.ExpectPeer(&matrix.Peer{Namespace: srcNamespace}, &matrix.Peer{Namespace: srcNamespace, Pod: backend.Name}, true)
+			waitForDataplane(ctx, srcModel, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: reachability, ServiceType: entities.NodePort,
+			}, waitOptions)
+			return ctx
+		}).
+		Teardown(func(context.Context, *testing.T, *envconf.Config) context.Context {
+			tools.ResetTestBoard(t, services, srcModel)
+			return ctx
+		}).
+		Assess("should preserve the client IP on node port with the Local policy", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			zap.L().Info("Testing the source IP via node port with the Local policy.")
+			reachability := matrix.NewReachability(pods, false)
+			reachability.ExpectPeer(&matrix.Peer{Namespace: srcNamespace}, &matrix.Peer{Namespace: srcNamespace, Pod: backend.Name}, true)
+			tools.MustNoWrong(matrix.ValidateOrFail(ctx, prober, srcModel, &matrix.TestCase{
+				Protocol: v1.ProtocolTCP, Reachability: reachability,
+				ServiceType: entities.NodePort, SourceIP: matrix.SourceIPPreserved,
+			}, loopbackIgnored), t)
+			return ctx
+		}).Feature()
+
+	testenv.Test(t, featureClusterIP, featureNodePortCluster, featureNodePortLocal)
+}